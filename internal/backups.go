@@ -0,0 +1,408 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// max length of backuper log line scanned for BACKUP_SUCCESS_LOG_REGEX
+const maxLogLineSize = 1024 * 1024
+
+// backuper logs are scanned at most this often, more frequent calls use last known backup from state
+const backupLogScanInterval = time.Minute
+
+// Sources of last successful backup time
+const (
+	BackupSourceForceBackup = "force-backup"
+	BackupSourceLog         = "log"
+	BackupSourceMarker      = "marker"
+)
+
+type BackupState struct {
+	Host             string     `json:"host,omitempty" yaml:"host,omitempty"`
+	Name             string     `json:"name" yaml:"name"`
+	LastBackup       *time.Time `json:"last_backup,omitempty" yaml:"last_backup,omitempty"`
+	LastBackupSource string     `json:"last_backup_source,omitempty" yaml:"last_backup_source,omitempty"`
+	LastRestore      *time.Time `json:"last_restore,omitempty" yaml:"last_restore,omitempty"`
+	LastJob          *JobResult `json:"last_job,omitempty" yaml:"last_job,omitempty"`
+}
+
+// JobResult is result of finished restore or force-backup container: exit code, timeout, canceled or error
+type JobResult struct {
+	Type   string    `json:"type" yaml:"type"`
+	Result string    `json:"result" yaml:"result"`
+	At     time.Time `json:"at" yaml:"at"`
+}
+
+func (res JobResult) String() string {
+	return fmt.Sprintf("%s %s %s", res.Type, res.Result, res.At.Local().Format(time.DateTime))
+}
+
+// IsStale reports if there was no successful backup since now - maxAge
+func (state BackupState) IsStale(maxAge time.Duration, now time.Time) bool {
+	return state.LastBackup == nil || now.Sub(*state.LastBackup) > maxAge
+}
+
+// backupTracker keeps last successful backups and restores per backup name.
+// If path is set, state is kept in file, so it survives restarts and is shared
+// between daemon and cli commands run in direct mode
+type backupTracker struct {
+	mu     sync.Mutex
+	path   string
+	states map[string]BackupState
+}
+
+func newBackupTracker(path string) *backupTracker {
+	return &backupTracker{
+		path:   path,
+		states: map[string]BackupState{},
+	}
+}
+
+func (bt *backupTracker) recordBackup(name, source string, at time.Time) error {
+	return bt.update(func() {
+		state := bt.states[name]
+		if state.LastBackup != nil && !at.After(*state.LastBackup) {
+			return
+		}
+
+		state.Name = name
+		state.LastBackup = &at
+		state.LastBackupSource = source
+		bt.states[name] = state
+	})
+}
+
+func (bt *backupTracker) recordRestore(name string, at time.Time) error {
+	return bt.update(func() {
+		state := bt.states[name]
+		state.Name = name
+		state.LastRestore = &at
+		bt.states[name] = state
+	})
+}
+
+func (bt *backupTracker) recordJob(name string, res JobResult) error {
+	return bt.update(func() {
+		state := bt.states[name]
+		state.Name = name
+		state.LastJob = &res
+		bt.states[name] = state
+	})
+}
+
+func (bt *backupTracker) get(name string) (BackupState, error) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	err := bt.load()
+	if err != nil {
+		return BackupState{}, err
+	}
+
+	state := bt.states[name]
+	state.Name = name
+
+	return state, nil
+}
+
+func (bt *backupTracker) update(fn func()) error {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+
+	err := bt.load()
+	if err != nil {
+		return err
+	}
+
+	fn()
+
+	return bt.save()
+}
+
+// load and save must be called with lock held
+func (bt *backupTracker) load() error {
+	if len(bt.path) == 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(bt.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to read state file %s: %w", bt.path, err)
+	}
+
+	states := map[string]BackupState{}
+
+	err = json.Unmarshal(data, &states)
+	if err != nil {
+		return fmt.Errorf("failed to parse state file %s: %w", bt.path, err)
+	}
+
+	bt.states = states
+
+	return nil
+}
+
+func (bt *backupTracker) save() error {
+	if len(bt.path) == 0 {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(bt.states, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to temp file and rename, so state file is never left half-written
+	tmpPath := bt.path + ".tmp"
+
+	err = os.WriteFile(tmpPath, data, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write state file %s: %w", tmpPath, err)
+	}
+
+	err = os.Rename(tmpPath, bt.path)
+	if err != nil {
+		return fmt.Errorf("failed to write state file %s: %w", bt.path, err)
+	}
+
+	return nil
+}
+
+// LastBackups returns last successful backup and restore of all containers labeled for backup.
+// Marker files are checked on each call, backuper logs are scanned for lines written since last scan
+// no more often than backupLogScanInterval
+func (mngr *ContainerManager) LastBackups(ctx context.Context) ([]BackupState, error) {
+	var logRegex *regexp.Regexp
+
+	if len(mngr.conf.BackupSuccessLogRegex) > 0 {
+		var err error
+		logRegex, err = regexp.Compile(mngr.conf.BackupSuccessLogRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BACKUP_SUCCESS_LOG_REGEX - %w", err)
+		}
+	}
+
+	targets, err := mngr.listContainersWithLabel(ctx, mngr.labels.backupName, true)
+	if err != nil {
+		return nil, err
+	}
+
+	backuperIds := map[string]string{}
+
+	if logRegex != nil {
+		backupers, err := mngr.listContainersWithLabel(ctx, mngr.labels.backuperName, true)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, backuper := range backupers {
+			backuperIds[getContainerLabel(&backuper, mngr.labels.backuperName)] = backuper.ID
+		}
+	}
+
+	states := []BackupState{}
+
+	for _, target := range targets {
+		name := mngr.nameFromLabel(&target, mngr.labels.backupName)
+
+		state, err := mngr.backups.get(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(mngr.conf.BackupMarkerDir) > 0 {
+			markerAt, err := readBackupMarker(mngr.conf.BackupMarkerDir, name)
+			if err != nil {
+				return nil, err
+			}
+
+			if markerAt != nil {
+				err = mngr.backups.recordBackup(name, BackupSourceMarker, *markerAt)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if id, ok := backuperIds[name]; ok {
+			since, due := mngr.logScanSince(id, state.LastBackup, time.Now())
+
+			if due {
+				scanAt := time.Now()
+
+				logAt, err := mngr.scanBackuperLogs(ctx, id, logRegex, since)
+				if err != nil {
+					return nil, fmt.Errorf("failed to scan logs of backup container %s - %w", name, err)
+				}
+
+				mngr.recordLogScan(id, scanAt)
+
+				if logAt != nil {
+					err = mngr.backups.recordBackup(name, BackupSourceLog, *logAt)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+
+		state, err = mngr.backups.get(name)
+		if err != nil {
+			return nil, err
+		}
+
+		state.Host = mngr.host
+		states = append(states, state)
+	}
+
+	mngr.forgetLogScans(backuperIds)
+
+	slices.SortFunc(states, func(a, b BackupState) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return states, nil
+}
+
+// logScanSince returns time backuper logs should be scanned from and whether scan is due. Lines before
+// last scan or last known backup could not contain newer backup
+func (mngr *ContainerManager) logScanSince(cntrId string, lastBackup *time.Time, now time.Time) (*time.Time, bool) {
+	mngr.logScansMu.Lock()
+	scannedAt, ok := mngr.logScans[cntrId]
+	mngr.logScansMu.Unlock()
+
+	if !ok {
+		return lastBackup, true
+	}
+
+	if now.Sub(scannedAt) < backupLogScanInterval {
+		return nil, false
+	}
+
+	if lastBackup != nil && lastBackup.After(scannedAt) {
+		return lastBackup, true
+	}
+
+	return &scannedAt, true
+}
+
+func (mngr *ContainerManager) recordLogScan(cntrId string, at time.Time) {
+	mngr.logScansMu.Lock()
+	defer mngr.logScansMu.Unlock()
+
+	mngr.logScans[cntrId] = at
+}
+
+// forgetLogScans drops scans of backupers which are gone
+func (mngr *ContainerManager) forgetLogScans(backuperIds map[string]string) {
+	live := map[string]bool{}
+	for _, cntrId := range backuperIds {
+		live[cntrId] = true
+	}
+
+	mngr.logScansMu.Lock()
+	defer mngr.logScansMu.Unlock()
+
+	maps.DeleteFunc(mngr.logScans, func(cntrId string, _ time.Time) bool {
+		return !live[cntrId]
+	})
+}
+
+// StaleBackups filters states without successful backup for longer than maxAge
+func StaleBackups(states []BackupState, maxAge time.Duration, now time.Time) []BackupState {
+	stale := []BackupState{}
+
+	for _, state := range states {
+		if state.IsStale(maxAge, now) {
+			stale = append(stale, state)
+		}
+	}
+
+	return stale
+}
+
+// readBackupMarker returns modification time of marker file named after backup, nil if there is no marker
+func readBackupMarker(dir, name string) (*time.Time, error) {
+	info, err := os.Stat(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup marker for %s: %w", name, err)
+	}
+
+	modTime := info.ModTime()
+
+	return &modTime, nil
+}
+
+// scanBackuperLogs returns time of last backuper log line matching regex, nil if there is no such line
+func (mngr *ContainerManager) scanBackuperLogs(ctx context.Context, cntrId string, regex *regexp.Regexp, since *time.Time) (*time.Time, error) {
+	opts := container.LogsOptions{ShowStdout: true, ShowStderr: true, Timestamps: true}
+	if since != nil {
+		opts.Since = since.Format(time.RFC3339Nano)
+	}
+
+	tty, err := mngr.containerTty(ctx, cntrId)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := mngr.docker.ContainerLogs(ctx, cntrId, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	// logs are demultiplexed and scanned line by line, so they are never held in memory as a whole
+	logs, logsWriter := io.Pipe()
+	defer logs.Close()
+
+	go func() {
+		logsWriter.CloseWithError(copyLogs(logsWriter, reader, tty))
+	}()
+
+	var last *time.Time
+
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(nil, maxLogLineSize)
+	for scanner.Scan() {
+		// each line is prefixed with timestamp because of Timestamps option
+		timestamp, line, found := strings.Cut(scanner.Text(), " ")
+		if !found || !regex.MatchString(line) {
+			continue
+		}
+
+		at, err := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			continue
+		}
+
+		if last == nil || at.After(*last) {
+			last = &at
+		}
+	}
+
+	return last, scanner.Err()
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupTrackerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	first := time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)
+
+	bt := newBackupTracker(path)
+	require.NoError(t, bt.recordBackup("example", BackupSourceForceBackup, first))
+	require.NoError(t, bt.recordBackup("example", BackupSourceLog, first.Add(-time.Hour)))
+	require.NoError(t, bt.recordRestore("example", first))
+
+	// another tracker (e.g. cli in direct mode) sees the same state
+	state, err := newBackupTracker(path).get("example")
+	require.NoError(t, err)
+	require.Equal(t, "example", state.Name)
+	require.True(t, first.Equal(*state.LastBackup))
+	require.Equal(t, BackupSourceForceBackup, state.LastBackupSource)
+	require.True(t, first.Equal(*state.LastRestore))
+
+	state, err = newBackupTracker(path).get("other")
+	require.NoError(t, err)
+	require.Nil(t, state.LastBackup)
+}
+
+func TestLastBackups(t *testing.T) {
+	tm := newTestMngr(t, []string{"example", "example2", "example3"}, []string{"example2"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	markerDir := t.TempDir()
+	markerAt := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+
+	require.NoError(t, os.WriteFile(filepath.Join(markerDir, "example"), nil, 0o644))
+	require.NoError(t, os.Chtimes(filepath.Join(markerDir, "example"), markerAt, markerAt))
+
+	tm.mngr.conf.BackupMarkerDir = markerDir
+	tm.mngr.conf.BackupSuccessLogRegex = "^backup done"
+
+	var logs bytes.Buffer
+	stdout := stdcopy.NewStdWriter(&logs, stdcopy.Stdout)
+	stdout.Write([]byte("2024-05-01T03:00:00.000000000Z backup done\n"))
+	stdout.Write([]byte("2024-05-02T03:00:00.000000000Z backup done\n"))
+	stdout.Write([]byte("2024-05-03T03:00:00.000000000Z backup failed\n"))
+
+	tm.docker.EXPECT().ContainerLogs(mock.Anything, "backuperidexample2", container.LogsOptions{ShowStdout: true, ShowStderr: true, Timestamps: true}).Return(io.NopCloser(&logs), nil).Once()
+
+	states, err := tm.mngr.LastBackups(context.Background())
+	require.NoError(t, err)
+	require.Len(t, states, 3)
+
+	require.Equal(t, "example", states[0].Name)
+	require.Equal(t, BackupSourceMarker, states[0].LastBackupSource)
+	require.True(t, markerAt.Equal(*states[0].LastBackup))
+
+	require.Equal(t, "example2", states[1].Name)
+	require.Equal(t, BackupSourceLog, states[1].LastBackupSource)
+	require.True(t, time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC).Equal(*states[1].LastBackup))
+
+	require.Equal(t, "example3", states[2].Name)
+	require.Nil(t, states[2].LastBackup)
+
+	stale := StaleBackups(states, 26*time.Hour, time.Now())
+	require.Len(t, stale, 2)
+	require.Equal(t, "example2", stale[0].Name)
+	require.Equal(t, "example3", stale[1].Name)
+
+	// logs were just scanned, so they are not read again
+	states, err = tm.mngr.LastBackups(context.Background())
+	require.NoError(t, err)
+	require.True(t, time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC).Equal(*states[1].LastBackup))
+
+	// logs are read since last scan once interval passes
+	scannedAt := time.Now().Add(-2 * backupLogScanInterval)
+	tm.mngr.recordLogScan("backuperidexample2", scannedAt)
+
+	tm.docker.EXPECT().ContainerLogs(mock.Anything, "backuperidexample2", container.LogsOptions{ShowStdout: true, ShowStderr: true, Timestamps: true, Since: scannedAt.Format(time.RFC3339Nano)}).Return(io.NopCloser(&bytes.Buffer{}), nil).Once()
+
+	_, err = tm.mngr.LastBackups(context.Background())
+	require.NoError(t, err)
+
+	// scans of backupers which are not listed anymore are forgotten
+	tm.mngr.conf.BackupSuccessLogRegex = ""
+
+	_, err = tm.mngr.LastBackups(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, tm.mngr.logScans)
+}
+
+func TestLastBackupsTty(t *testing.T) {
+	tm := newTestMngr(t, []string{"example"}, []string{"example"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	tm.mngr.conf.BackupSuccessLogRegex = "^backup done"
+
+	// logs of tty container are not multiplexed
+	tm.ttyCntrs["backuperidexample"] = true
+
+	tm.docker.EXPECT().ContainerLogs(mock.Anything, "backuperidexample", mock.Anything).Return(io.NopCloser(strings.NewReader("2024-05-01T03:00:00.000000000Z backup done\r\n")), nil).Once()
+
+	states, err := tm.mngr.LastBackups(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, BackupSourceLog, states[0].LastBackupSource)
+	require.True(t, time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC).Equal(*states[0].LastBackup))
+}
+
+func TestLastBackupsForceBackup(t *testing.T) {
+	tm := newTestMngr(t, []string{"example"}, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	tm.expectImageList([]string{"alpine:latest"})
+	tm.expectForceBackupRun("example", "0")
+
+	require.NoError(t, tm.mngr.ForceBackup(context.Background(), "example", OneOffOptions{}))
+
+	states, err := tm.mngr.LastBackups(context.Background())
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	require.Equal(t, BackupSourceForceBackup, states[0].LastBackupSource)
+	require.Empty(t, StaleBackups(states, time.Hour, time.Now()))
+}
@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+const dockerignoreFile = ".dockerignore"
+
+// name of dockerfile from outside of build context inside context archive
+const externalDockerfileName = ".maestro.Dockerfile"
+
+// contextDockerfile returns name of dockerfile inside build context dir src. Dockerfile path is relative
+// to context, same as in compose. Dockerfile outside of context is sent under generated name, its path
+// is returned as external then
+func contextDockerfile(src string, dockerfile string) (name string, external string) {
+	if len(dockerfile) == 0 {
+		return "Dockerfile", ""
+	}
+
+	file := dockerfile
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(src, file)
+	}
+
+	rel, err := filepath.Rel(src, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return externalDockerfileName, file
+	}
+
+	return filepath.ToSlash(rel), ""
+}
+
+// readDockerignore returns patterns of .dockerignore in context root, nil if there is no such file.
+// Dockerfile (name inside context) and .dockerignore itself are always sent, same as docker cli does
+func readDockerignore(src string, dockerfile string) ([]string, error) {
+	f, err := os.Open(filepath.Join(src, dockerignoreFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s - %w", dockerignoreFile, err)
+	}
+	defer f.Close()
+
+	patterns, err := ignorefile.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s - %w", dockerignoreFile, err)
+	}
+
+	return append(patterns, "!"+dockerignoreFile, "!"+dockerfile), nil
+}
+
+// buildContextStream is tar of build context produced while it is read
+type buildContextStream struct {
+	*io.PipeReader
+	done chan error
+}
+
+// streamBuildContext archives build context dir src in background, so context is never held in memory
+func streamBuildContext(src string, dockerfile string, compress bool) *buildContextStream {
+	pr, pw := io.Pipe()
+	stream := &buildContextStream{PipeReader: pr, done: make(chan error, 1)}
+
+	go func() {
+		err := archiveBuildContext(src, dockerfile, compress, pw)
+		// reader gets archive error instead of EOF, so upload is aborted
+		pw.CloseWithError(err)
+		stream.done <- err
+	}()
+
+	return stream
+}
+
+// Close stops archiving if context was not read completely and returns archive error
+func (stream *buildContextStream) Close() error {
+	stream.PipeReader.Close()
+
+	err := <-stream.done
+	if errors.Is(err, io.ErrClosedPipe) {
+		return nil
+	}
+
+	return err
+}
+
+// archiveBuildContext writes tar of build context dir src, gzipped if compress is set. Files matching
+// .dockerignore are skipped, directories, symlinks and file modes are preserved. Dockerfile outside
+// of context is added under name returned by contextDockerfile
+func archiveBuildContext(src string, dockerfile string, compress bool, writer io.Writer) error {
+	// ensure the src actually exists before trying to tar it
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("unable to tar file %s - %v", src, err.Error())
+	}
+
+	dockerfile, external := contextDockerfile(src, dockerfile)
+
+	var externalInfo fs.FileInfo
+
+	if len(external) > 0 {
+		var err error
+
+		externalInfo, err = os.Stat(external)
+		if err != nil {
+			return fmt.Errorf("dockerfile %s outside of build context error: %w", external, err)
+		}
+	}
+
+	patterns, err := readDockerignore(src, dockerfile)
+	if err != nil {
+		return err
+	}
+
+	pm, err := patternmatcher.New(patterns)
+	if err != nil {
+		return fmt.Errorf("invalid %s - %w", dockerignoreFile, err)
+	}
+
+	var gzw *gzip.Writer
+
+	if compress {
+		gzw = gzip.NewWriter(writer)
+		writer = gzw
+	}
+
+	tw := tar.NewWriter(writer)
+
+	err = filepath.WalkDir(src, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("file %s error: %w", file, err)
+		}
+
+		name, err := filepath.Rel(src, file)
+		if err != nil {
+			return fmt.Errorf("file %s error: %w", file, err)
+		}
+
+		if name == "." {
+			return nil
+		}
+
+		name = filepath.ToSlash(name)
+
+		// replaced by dockerfile from outside of context
+		if len(external) > 0 && name == dockerfile {
+			return nil
+		}
+
+		excluded, err := pm.MatchesOrParentMatches(name)
+		if err != nil {
+			return fmt.Errorf("file %s error: %w", file, err)
+		}
+
+		if excluded {
+			// files inside excluded dir could be included back only by exclusion pattern
+			if d.IsDir() && !pm.Exclusions() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		return addToTar(tw, file, name, d)
+	})
+	if err != nil {
+		return err
+	}
+
+	if externalInfo != nil {
+		err = addToTar(tw, external, dockerfile, fs.FileInfoToDirEntry(externalInfo))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return fmt.Errorf("failed to finish build context archive - %w", err)
+	}
+
+	if gzw != nil {
+		err = gzw.Close()
+		if err != nil {
+			return fmt.Errorf("failed to finish build context archive - %w", err)
+		}
+	}
+
+	return nil
+}
+
+func addToTar(tw *tar.Writer, file string, name string, d fs.DirEntry) error {
+	fi, err := d.Info()
+	if err != nil {
+		return fmt.Errorf("file %s error: %w", file, err)
+	}
+
+	var link string
+
+	switch {
+	case fi.Mode().IsRegular() || fi.IsDir():
+	case fi.Mode()&fs.ModeSymlink != 0:
+		link, err = os.Readlink(file)
+		if err != nil {
+			return fmt.Errorf("file %s error: %w", file, err)
+		}
+	default:
+		// sockets, pipes and devices can not be a part of build context
+		return nil
+	}
+
+	header, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return fmt.Errorf("file %s error: %w", file, err)
+	}
+
+	header.Name = name
+	if fi.IsDir() {
+		header.Name += "/"
+	}
+
+	// ownership of maestro container files means nothing to daemon
+	header.Uid, header.Gid = 0, 0
+	header.Uname, header.Gname = "", ""
+
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("file %s error: %w", file, err)
+	}
+
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("file %s error: %w", file, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("file %s error: %w", file, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func writeContextFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	return dir
+}
+
+// readContextArchive returns headers of archive by name
+func readContextArchive(t *testing.T, archive io.Reader, compressed bool) map[string]*tar.Header {
+	if compressed {
+		gzr, err := gzip.NewReader(archive)
+		require.NoError(t, err)
+
+		archive = gzr
+	}
+
+	tr := tar.NewReader(archive)
+	headers := map[string]*tar.Header{}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		headers[header.Name] = header
+	}
+
+	return headers
+}
+
+func TestArchiveBuildContext(t *testing.T) {
+	dir := writeContextFiles(t, map[string]string{
+		"Dockerfile":         "FROM alpine",
+		"entrypoint.sh":      "#!/bin/sh",
+		"conf/app.conf":      "conf",
+		"conf/nested/a.conf": "conf",
+	})
+
+	require.NoError(t, os.Chmod(filepath.Join(dir, "entrypoint.sh"), 0o755))
+	require.NoError(t, os.Symlink("conf/app.conf", filepath.Join(dir, "app.conf")))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "empty"), 0o700))
+
+	var archive bytes.Buffer
+	require.NoError(t, archiveBuildContext(dir, "", true, &archive))
+
+	headers := readContextArchive(t, &archive, true)
+
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	require.ElementsMatch(t, []string{"Dockerfile", "entrypoint.sh", "conf/", "conf/app.conf", "conf/nested/", "conf/nested/a.conf", "app.conf", "empty/"}, names)
+
+	require.Equal(t, int64(0o755), headers["entrypoint.sh"].Mode&0o777)
+	require.Equal(t, byte(tar.TypeSymlink), headers["app.conf"].Typeflag)
+	require.Equal(t, "conf/app.conf", headers["app.conf"].Linkname)
+	require.Equal(t, byte(tar.TypeDir), headers["empty/"].Typeflag)
+	require.Equal(t, int64(0o700), headers["empty/"].Mode&0o777)
+}
+
+func TestArchiveBuildContextDockerignore(t *testing.T) {
+	dir := writeContextFiles(t, map[string]string{
+		".dockerignore":        "# comment\n.git\n*.log\ndata\nbuild/**\n!build/keep.txt\nbackup.Dockerfile\n",
+		"backup.Dockerfile":    "FROM alpine",
+		"main.go":              "package main",
+		"app.log":              "log",
+		"sub/app.log":          "log",
+		".git/HEAD":            "ref",
+		"data/db/file":         "data",
+		"build/out.bin":        "bin",
+		"build/keep.txt":       "keep",
+		"datafile":             "not excluded",
+		"nested/data/file.txt": "not excluded",
+	})
+
+	var archive bytes.Buffer
+	require.NoError(t, archiveBuildContext(dir, "backup.Dockerfile", false, &archive))
+
+	headers := readContextArchive(t, &archive, false)
+
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	// dockerfile and .dockerignore are sent even if ignored, patterns without ** match in context root only
+	require.ElementsMatch(t, []string{".dockerignore", "backup.Dockerfile", "main.go", "sub/", "sub/app.log", "build/", "build/keep.txt", "datafile", "nested/", "nested/data/", "nested/data/file.txt"}, names)
+}
+
+func TestContextDockerfile(t *testing.T) {
+	for _, tc := range []struct {
+		dockerfile string
+		name       string
+		external   string
+	}{
+		{"", "Dockerfile", ""},
+		{"build/backup.Dockerfile", "build/backup.Dockerfile", ""},
+		{"/ctx/backup.Dockerfile", "backup.Dockerfile", ""},
+		{"../Dockerfile", externalDockerfileName, "/Dockerfile"},
+		{"/other/Dockerfile", externalDockerfileName, "/other/Dockerfile"},
+		{"..Dockerfile", "..Dockerfile", ""},
+	} {
+		name, external := contextDockerfile("/ctx", tc.dockerfile)
+		require.Equal(t, tc.name, name, tc.dockerfile)
+		require.Equal(t, tc.external, external, tc.dockerfile)
+	}
+}
+
+func TestArchiveBuildContextExternalDockerfile(t *testing.T) {
+	root := writeContextFiles(t, map[string]string{
+		"Dockerfile":        "FROM alpine",
+		"ctx/.dockerignore": "*",
+		"ctx/main.go":       "package main",
+	})
+
+	var archive bytes.Buffer
+	require.NoError(t, archiveBuildContext(filepath.Join(root, "ctx"), "../Dockerfile", false, &archive))
+
+	tr := tar.NewReader(&archive)
+	files := map[string]string{}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+
+		files[header.Name] = string(content)
+	}
+
+	// dockerfile from outside of context is sent under generated name even if everything is ignored
+	require.Equal(t, map[string]string{".dockerignore": "*", externalDockerfileName: "FROM alpine"}, files)
+
+	require.ErrorContains(t, archiveBuildContext(filepath.Join(root, "ctx"), "../missing.Dockerfile", false, &archive), "outside of build context")
+}
+
+func TestArchiveBuildContextErrors(t *testing.T) {
+	var archive bytes.Buffer
+
+	require.Error(t, archiveBuildContext(filepath.Join(t.TempDir(), "missing"), "", false, &archive))
+
+	dir := writeContextFiles(t, map[string]string{".dockerignore": "[", "Dockerfile": "FROM alpine"})
+	require.Error(t, archiveBuildContext(dir, "", false, &archive))
+
+	if os.Getuid() == 0 {
+		t.Skip("root reads unreadable files")
+	}
+
+	dir = writeContextFiles(t, map[string]string{"Dockerfile": "FROM alpine"})
+	require.NoError(t, os.Chmod(filepath.Join(dir, "Dockerfile"), fs.FileMode(0)))
+	require.Error(t, archiveBuildContext(dir, "", false, &archive))
+}
+
+func TestStreamBuildContext(t *testing.T) {
+	dir := writeContextFiles(t, map[string]string{"Dockerfile": "FROM alpine", "big": strings.Repeat("x", 1<<20)})
+
+	stream := streamBuildContext(dir, "", true)
+	headers := readContextArchive(t, stream, true)
+	require.NoError(t, stream.Close())
+	require.Equal(t, int64(1<<20), headers["big"].Size)
+
+	// context not read completely is not an error
+	stream = streamBuildContext(dir, "", false)
+	_, err := stream.Read(make([]byte, 10))
+	require.NoError(t, err)
+	require.NoError(t, stream.Close())
+
+	// archive error is returned to reader and by Close
+	stream = streamBuildContext(filepath.Join(dir, "missing"), "", false)
+	_, err = io.ReadAll(stream)
+	require.Error(t, err)
+	require.ErrorContains(t, stream.Close(), "missing")
+}
+
+func TestBuildStreamsContext(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	dir := writeContextFiles(t, map[string]string{"Dockerfile": "FROM alpine"})
+
+	tm.expectImageList([]string{})
+
+	tm.docker.EXPECT().ImageBuild(mock.Anything, mock.Anything, mock.Anything).RunAndReturn(func(ctx context.Context, buildCtx io.Reader, opts types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+		headers := readContextArchive(t, buildCtx, false)
+		require.Contains(t, headers, "Dockerfile")
+
+		return types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(""))}, nil
+	}).Once()
+
+	require.NoError(t, tm.mngr.buildImage(context.Background(), &BuildInfo{Context: dir}, "maestro-backup", PullMissing))
+
+	// dockerfile outside of context is built from archive under generated name
+	external := filepath.Join(t.TempDir(), "backup.Dockerfile")
+	require.NoError(t, os.WriteFile(external, []byte("FROM alpine"), 0o644))
+
+	tm.docker.EXPECT().ImageBuild(mock.Anything, mock.Anything, mock.MatchedBy(func(opts types.ImageBuildOptions) bool {
+		return opts.Dockerfile == externalDockerfileName
+	})).RunAndReturn(func(ctx context.Context, buildCtx io.Reader, opts types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+		headers := readContextArchive(t, buildCtx, false)
+		require.Contains(t, headers, externalDockerfileName)
+
+		return types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(""))}, nil
+	}).Once()
+
+	require.NoError(t, tm.mngr.buildImage(context.Background(), &BuildInfo{Context: dir, Dockerfile: external}, "maestro-backup", PullMissing))
+
+	// archive error fails build even if daemon did not report it
+	tm.expectImageList([]string{})
+	tm.expectBuild("maestro-backup:latest")
+
+	err := tm.mngr.buildImage(context.Background(), &BuildInfo{Context: filepath.Join(dir, "missing")}, "maestro-backup", PullMissing)
+	require.ErrorContains(t, err, "missing")
+}
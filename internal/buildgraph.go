@@ -0,0 +1,267 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// buildTarget is image built from template
+type buildTarget struct {
+	tag  string
+	info *BuildInfo
+}
+
+type buildNode struct {
+	tag  string
+	info *BuildInfo
+	// node is image of template, not only dependent build of other template
+	fromTemplate bool
+	deps         []string
+}
+
+// buildGraph models images of templates and their dependent builds as DAG, so every image is built once
+// and after images it depends on
+type buildGraph struct {
+	nodes map[string]*buildNode
+	roots []string
+}
+
+func newBuildGraph(targets []buildTarget) (*buildGraph, error) {
+	g := &buildGraph{nodes: map[string]*buildNode{}}
+
+	for _, target := range targets {
+		tag := withDefaultTag(target.tag)
+
+		err := g.add(tag, target.info, true)
+		if err != nil {
+			return nil, err
+		}
+
+		g.roots = append(g.roots, tag)
+	}
+
+	return g, nil
+}
+
+func (g *buildGraph) add(tag string, info *BuildInfo, fromTemplate bool) error {
+	node := &buildNode{tag: tag, info: info, fromTemplate: fromTemplate}
+
+	for _, dep := range info.DependentBuilds {
+		if len(dep.Tag) == 0 {
+			return fmt.Errorf("dependent build of %s has no tag", tag)
+		}
+
+		node.deps = append(node.deps, withDefaultTag(dep.Tag))
+	}
+
+	existing, ok := g.nodes[tag]
+
+	switch {
+	case !ok:
+		g.nodes[tag] = node
+	case existing.fromTemplate && fromTemplate:
+		if !reflect.DeepEqual(*existing.info, *info) {
+			return fmt.Errorf("image %s is built differently by two templates", tag)
+		}
+	case existing.fromTemplate || fromTemplate:
+		// image of template is dependent build of other template, template build has more options
+		if !sameBuildSource(existing.info, info) {
+			return fmt.Errorf("image %s is built differently by template and dependent build", tag)
+		}
+
+		if fromTemplate {
+			g.nodes[tag] = node
+		}
+	default:
+		if !sameBuildSource(existing.info, info) {
+			return fmt.Errorf("image %s is built differently by two dependent builds", tag)
+		}
+	}
+
+	if !fromTemplate {
+		return nil
+	}
+
+	for _, dep := range info.DependentBuilds {
+		err := g.add(withDefaultTag(dep.Tag), &BuildInfo{
+			Context:    dep.Context,
+			Dockerfile: dep.Dockerfile,
+			Args:       dep.Args,
+		}, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sameBuildSource(a, b *BuildInfo) bool {
+	return a.Context == b.Context && a.Dockerfile == b.Dockerfile && maps.Equal(a.Args, b.Args)
+}
+
+// order returns nodes reachable from roots, every node after nodes it depends on. Cycles are reported as error
+func (g *buildGraph) order(roots []string) ([]*buildNode, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := map[string]int{}
+	path := []string{}
+	order := []*buildNode{}
+
+	var visit func(tag string) error
+
+	visit = func(tag string) error {
+		switch state[tag] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependent builds cycle: %s -> %s", strings.Join(path, " -> "), tag)
+		}
+
+		state[tag] = visiting
+		path = append(path, tag)
+
+		node := g.nodes[tag]
+
+		for _, dep := range node.deps {
+			err := visit(dep)
+			if err != nil {
+				return err
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[tag] = visited
+		order = append(order, node)
+
+		return nil
+	}
+
+	for _, root := range roots {
+		err := visit(root)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// buildImages builds images of templates and their dependent builds according to pull policy.
+// Every image is built once, up to BUILD_PARALLELISM independent images are built at the same time
+func (mngr *ContainerManager) buildImages(ctx context.Context, targets []buildTarget, policy string) error {
+	g, err := newBuildGraph(targets)
+	if err != nil {
+		return err
+	}
+
+	// cycles are reported even if nothing is going to be built
+	_, err = g.order(g.roots)
+	if err != nil {
+		return err
+	}
+
+	// dependent builds are needed only for images which are going to be built
+	roots := []string{}
+
+	for _, root := range g.roots {
+		if len(g.nodes[root].deps) > 0 && policy != PullBuild && policy != PullAlways {
+			localImg, err := mngr.localImage(ctx, root)
+			if err != nil {
+				return err
+			}
+
+			if localImg != nil {
+				continue
+			}
+		}
+
+		roots = append(roots, root)
+	}
+
+	order, err := g.order(roots)
+	if err != nil {
+		return err
+	}
+
+	return mngr.runBuilds(ctx, order, policy)
+}
+
+// runBuilds builds nodes, each one after its dependencies. First failure cancels builds not started yet
+func (mngr *ContainerManager) runBuilds(ctx context.Context, order []*buildNode, policy string) error {
+	buildCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	parallelism := max(mngr.conf.BuildParallelism, 1)
+	slots := make(chan struct{}, parallelism)
+
+	done := map[string]chan struct{}{}
+	for _, node := range order {
+		done[node.tag] = make(chan struct{})
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+
+	for _, node := range order {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer close(done[node.tag])
+
+			for _, dep := range node.deps {
+				select {
+				case <-done[dep]:
+				case <-buildCtx.Done():
+					return
+				}
+			}
+
+			select {
+			case slots <- struct{}{}:
+			case <-buildCtx.Done():
+				return
+			}
+			defer func() { <-slots }()
+
+			// dependency failed while slot was awaited
+			if buildCtx.Err() != nil {
+				return
+			}
+
+			err := mngr.buildImage(buildCtx, node.info, node.tag, policy)
+			if err != nil {
+				if !node.fromTemplate {
+					err = fmt.Errorf("dependency (%s) build failed: %w", node.tag, err)
+				}
+
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+
+				cancel()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return ctx.Err()
+}
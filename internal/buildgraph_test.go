@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildGraphOrder(t *testing.T) {
+	g, err := newBuildGraph([]buildTarget{
+		{tag: "backup", info: &BuildInfo{Context: "/backup", DependentBuilds: []DependentBuild{{Tag: "base", Context: "/base"}, {Tag: "tools:1", Context: "/tools"}}}},
+		{tag: "restore", info: &BuildInfo{Context: "/restore", DependentBuilds: []DependentBuild{{Tag: "base", Context: "/base"}}}},
+		{tag: "tools:1", info: &BuildInfo{Context: "/tools", DependentBuilds: []DependentBuild{{Tag: "base", Context: "/base"}}}},
+	})
+	require.NoError(t, err)
+
+	order, err := g.order(g.roots)
+	require.NoError(t, err)
+
+	tags := []string{}
+	for _, node := range order {
+		tags = append(tags, node.tag)
+	}
+
+	require.Equal(t, []string{"base:latest", "tools:1", "backup:latest", "restore:latest"}, tags)
+
+	// template build of dependent image is used, as it has its own dependencies
+	require.True(t, g.nodes["tools:1"].fromTemplate)
+	require.Equal(t, []string{"base:latest"}, g.nodes["tools:1"].deps)
+}
+
+func TestBuildGraphErrors(t *testing.T) {
+	for name, targets := range map[string][]buildTarget{
+		"cycle": {
+			{tag: "a", info: &BuildInfo{Context: "/a", DependentBuilds: []DependentBuild{{Tag: "b", Context: "/b"}}}},
+			{tag: "b", info: &BuildInfo{Context: "/b", DependentBuilds: []DependentBuild{{Tag: "a", Context: "/a"}}}},
+		},
+		"self": {
+			{tag: "a", info: &BuildInfo{Context: "/a", DependentBuilds: []DependentBuild{{Tag: "a:latest", Context: "/a"}}}},
+		},
+		"conflicting dependent builds": {
+			{tag: "a", info: &BuildInfo{Context: "/a", DependentBuilds: []DependentBuild{{Tag: "base", Context: "/base"}}}},
+			{tag: "b", info: &BuildInfo{Context: "/b", DependentBuilds: []DependentBuild{{Tag: "base", Context: "/other"}}}},
+		},
+		"conflicting templates": {
+			{tag: "a", info: &BuildInfo{Context: "/a"}},
+			{tag: "a", info: &BuildInfo{Context: "/a", Target: "other"}},
+		},
+		"no tag": {
+			{tag: "a", info: &BuildInfo{Context: "/a", DependentBuilds: []DependentBuild{{Context: "/base"}}}},
+		},
+	} {
+		tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+		// nothing is built if graph is invalid
+		err := tm.mngr.buildImages(context.Background(), targets, PullBuild)
+		require.Error(t, err, name)
+	}
+
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	err := tm.mngr.buildImages(context.Background(), []buildTarget{
+		{tag: "a", info: &BuildInfo{Context: "/a", DependentBuilds: []DependentBuild{{Tag: "b", Context: "/b"}}}},
+		{tag: "b", info: &BuildInfo{Context: "/b", DependentBuilds: []DependentBuild{{Tag: "a", Context: "/a"}}}},
+	}, PullBuild)
+	require.ErrorContains(t, err, "a:latest -> b:latest -> a:latest")
+}
+
+func TestBuildAllSharedDependency(t *testing.T) {
+	base := DependentBuild{Tag: "base", Context: "."}
+
+	tm := newTestMngr(t, nil, nil, UserTemplates{
+		Backuper: &Template{Build: BuildInfo{Context: ".", DependentBuilds: []DependentBuild{base}}},
+		Restore:  &Template{Build: BuildInfo{Context: ".", Dockerfile: "Dockerfile.restore", DependentBuilds: []DependentBuild{base}}},
+	})
+
+	// expectations are single, so repeated build of base fails the test
+	tm.expectBuild("base:latest")
+	tm.expectBuild(tm.mngr.conf.BackupTag + ":latest")
+	tm.expectBuild(tm.mngr.conf.ForceTag + ":latest")
+	tm.docker.EXPECT().ImageBuild(mock.Anything, mock.Anything, types.ImageBuildOptions{Version: types.BuilderBuildKit, Tags: []string{tm.mngr.conf.RestoreTag + ":latest"}, Dockerfile: "Dockerfile.restore"}).Return(types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(""))}, nil).Once()
+
+	require.NoError(t, tm.mngr.BuildAll(context.Background()))
+}
+
+func TestBuildSkipsDependenciesOfPresentImage(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	tm.expectImageList([]string{"backup:latest"})
+
+	info := &BuildInfo{Context: ".", DependentBuilds: []DependentBuild{{Tag: "base", Context: "."}}}
+
+	require.NoError(t, tm.mngr.buildImages(context.Background(), []buildTarget{{tag: "backup", info: info}}, PullMissing))
+
+	// dependencies of missing image are built if they are missing too
+	tm = newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	tm.expectImageList(nil)
+	tm.expectBuild("base:latest")
+	tm.expectBuild("backup:latest")
+
+	require.NoError(t, tm.mngr.buildImages(context.Background(), []buildTarget{{tag: "backup", info: info}}, PullMissing))
+}
+
+func TestBuildParallel(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	tm.mngr.conf.BuildParallelism = 2
+
+	var started sync.WaitGroup
+	started.Add(2)
+
+	allStarted := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(allStarted)
+	}()
+
+	built := map[string]bool{}
+	var builtMu sync.Mutex
+
+	tm.docker.EXPECT().ImageBuild(mock.Anything, mock.Anything, mock.Anything).RunAndReturn(func(ctx context.Context, buildCtx io.Reader, opts types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+		builtMu.Lock()
+		built[opts.Tags[0]] = true
+		builtMu.Unlock()
+
+		// independent images are built at the same time, root waits for them
+		if opts.Tags[0] != "backup:latest" {
+			started.Done()
+
+			select {
+			case <-allStarted:
+			case <-time.After(5 * time.Second):
+				return types.ImageBuildResponse{}, errors.New("builds are not parallel")
+			}
+		}
+
+		return types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(""))}, nil
+	}).Times(3)
+
+	err := tm.mngr.buildImages(context.Background(), []buildTarget{{tag: "backup", info: &BuildInfo{Context: ".", DependentBuilds: []DependentBuild{
+		{Tag: "base1", Context: "."},
+		{Tag: "base2", Context: "."},
+	}}}}, PullBuild)
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"base1:latest": true, "base2:latest": true, "backup:latest": true}, built)
+}
+
+func TestBuildDependencyFailure(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	tm.docker.EXPECT().ImageBuild(mock.Anything, mock.Anything, mock.Anything).Return(types.ImageBuildResponse{}, errors.New("no space left")).Once()
+
+	// image is not built after its dependency failed
+	err := tm.mngr.buildImages(context.Background(), []buildTarget{{tag: "backup", info: &BuildInfo{Context: ".", DependentBuilds: []DependentBuild{
+		{Tag: "base", Context: "."},
+	}}}}, PullBuild)
+	require.ErrorContains(t, err, "dependency (base:latest) build failed")
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/docker/docker/api/types"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
+	"github.com/moby/buildkit/session/sshforward/sshprovider"
+)
+
+// applyBuildOptions sets compose-like build options of template which do not need BuildKit session
+func applyBuildOptions(opts *types.ImageBuildOptions, buildInfo *BuildInfo) error {
+	err := buildInfo.Validate()
+	if err != nil {
+		return err
+	}
+
+	opts.Target = buildInfo.Target
+	opts.NetworkMode = buildInfo.Network
+	opts.NoCache = buildInfo.NoCache
+	opts.PullParent = buildInfo.Pull
+
+	if len(buildInfo.Labels) > 0 {
+		opts.Labels = buildInfo.Labels
+	}
+
+	if len(buildInfo.CacheFrom) > 0 {
+		opts.CacheFrom = buildInfo.CacheFrom
+	}
+
+	if len(buildInfo.ExtraHosts) > 0 {
+		opts.ExtraHosts = buildInfo.ExtraHosts
+	}
+
+	shmSize, err := buildInfo.ShmSizeBytes()
+	if err != nil {
+		return err
+	}
+
+	opts.ShmSize = shmSize
+
+	if len(buildInfo.Platforms) > 0 {
+		opts.Platform = buildInfo.Platforms[0]
+	}
+
+	return nil
+}
+
+// startBuildSession starts BuildKit session, which serves build secrets and ssh agents to daemon.
+// Returns nil if build uses neither of them
+func (mngr *ContainerManager) startBuildSession(ctx context.Context, buildInfo *BuildInfo, tag string) (*session.Session, error) {
+	if len(buildInfo.Secrets) == 0 && len(buildInfo.SSH) == 0 {
+		return nil, nil
+	}
+
+	if mngr.conf.BuilderV1 {
+		return nil, errors.New("build secrets and ssh require BuildKit, unset BUILDER_V1")
+	}
+
+	compat, err := mngr.engine(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !compat.buildKit() {
+		return nil, fmt.Errorf("build secrets and ssh require BuildKit, which is not supported by %s", compat.name)
+	}
+
+	var attachables []session.Attachable
+
+	if len(buildInfo.Secrets) > 0 {
+		var sources []secretsprovider.Source
+
+		for id, path := range buildInfo.SecretFiles() {
+			sources = append(sources, secretsprovider.Source{ID: id, FilePath: path})
+		}
+
+		store, err := secretsprovider.NewStore(sources)
+		if err != nil {
+			return nil, fmt.Errorf("invalid build secrets - %w", err)
+		}
+
+		attachables = append(attachables, secretsprovider.NewSecretProvider(store))
+	}
+
+	if len(buildInfo.SSH) > 0 {
+		agents, err := buildInfo.SSHAgents()
+		if err != nil {
+			return nil, err
+		}
+
+		var configs []sshprovider.AgentConfig
+
+		for id, paths := range agents {
+			configs = append(configs, sshprovider.AgentConfig{ID: id, Paths: paths})
+		}
+
+		provider, err := sshprovider.NewSSHAgentProvider(configs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid build ssh - %w", err)
+		}
+
+		attachables = append(attachables, provider)
+	}
+
+	sess, err := session.NewSession(ctx, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create build session - %w", err)
+	}
+
+	for _, a := range attachables {
+		sess.Allow(a)
+	}
+
+	go func() {
+		err := sess.Run(ctx, func(ctx context.Context, proto string, meta map[string][]string) (net.Conn, error) {
+			return mngr.docker.DialHijack(ctx, "/session", proto, meta)
+		})
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("build session failed", logKeyImage, tag, logKeyError, err)
+		}
+	}()
+
+	return sess, nil
+}
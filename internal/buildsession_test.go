@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildOptions(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	tm.expectImageList([]string{})
+
+	tm.docker.EXPECT().ImageBuild(mock.Anything, mock.Anything, types.ImageBuildOptions{
+		Version:     types.BuilderBuildKit,
+		Tags:        []string{"maestro-backup:latest"},
+		Target:      "backup",
+		Labels:      map[string]string{"lbl": "val"},
+		NetworkMode: "host",
+		NoCache:     true,
+		PullParent:  true,
+		CacheFrom:   []string{"backup:cache"},
+		ExtraHosts:  []string{"db:10.0.0.2"},
+		ShmSize:     64 * 1024 * 1024,
+		Platform:    "linux/arm64",
+	}).Return(types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(""))}, nil).Once()
+
+	require.NoError(t, tm.mngr.buildImage(context.Background(), &BuildInfo{
+		Context:    ".",
+		Target:     "backup",
+		Labels:     StringMapOrArray{"lbl": "val"},
+		Network:    "host",
+		NoCache:    true,
+		Pull:       true,
+		CacheFrom:  []string{"backup:cache"},
+		ExtraHosts: []string{"db:10.0.0.2"},
+		ShmSize:    "64m",
+		Platforms:  []string{"linux/arm64"},
+	}, "maestro-backup", PullMissing))
+}
+
+func TestBuildSession(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	secret := filepath.Join(t.TempDir(), "npm")
+	require.NoError(t, os.WriteFile(secret, []byte("token"), 0o600))
+
+	buildInfo := &BuildInfo{Context: ".", Secrets: StringMapOrArray{"npm_token": secret}}
+
+	// session is served over hijacked connection, which is not available in tests
+	tm.docker.EXPECT().DialHijack(mock.Anything, "/session", mock.Anything, mock.Anything).Return(nil, errors.New("no daemon")).Maybe()
+
+	tm.expectImageList([]string{})
+
+	tm.docker.EXPECT().ImageBuild(mock.Anything, mock.Anything, mock.Anything).RunAndReturn(func(ctx context.Context, buildCtx io.Reader, opts types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+		require.NotEmpty(t, opts.SessionID)
+
+		return types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(""))}, nil
+	}).Once()
+
+	require.NoError(t, tm.mngr.buildImage(context.Background(), buildInfo, "maestro-backup", PullMissing))
+
+	// missing secret file fails build before it is started
+	tm.expectImageList([]string{})
+
+	err := tm.mngr.buildImage(context.Background(), &BuildInfo{Context: ".", Secrets: StringMapOrArray{"npm_token": ""}}, "maestro-backup", PullMissing)
+	require.ErrorContains(t, err, "/run/secrets/npm_token")
+}
+
+func TestBuildSessionRequiresBuildKit(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	tm.mngr.conf.BuilderV1 = true
+
+	tm.expectImageList([]string{})
+
+	err := tm.mngr.buildImage(context.Background(), &BuildInfo{Context: ".", SSH: []string{"default"}}, "maestro-backup", PullMissing)
+	require.ErrorContains(t, err, "BuildKit")
+}
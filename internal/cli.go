@@ -2,39 +2,240 @@ package internal
 
 import (
 	"context"
-	"log"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/docker/docker/client"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 )
 
-func NewRootCmd(mngr *ContainerManager) *cobra.Command {
+// maestroApi is implemented by ContainerManager to work with docker directly
+// and by ControlClient to pass commands to running maestro daemon
+type maestroApi interface {
+	Restore(ctx context.Context, name string, opts OneOffOptions) error
+	RestoreAll(ctx context.Context, opts OneOffOptions) error
+	ForceBackup(ctx context.Context, name string, opts OneOffOptions) error
+	ForceBackupAll(ctx context.Context, includeStopped bool, opts OneOffOptions) error
+	Stop(ctx context.Context, name string) error
+	StopAll(ctx context.Context) error
+	StartBackuper(ctx context.Context, name string) error
+	StartAll(ctx context.Context) error
+	CreateBackuper(ctx context.Context, name string) error
+	CreateAll(ctx context.Context) error
+	RemoveBackuper(ctx context.Context, name string) error
+	RemoveAll(ctx context.Context) error
+	List(ctx context.Context, opts ListOptions) ([]ListEntry, error)
+	LastBackups(ctx context.Context) ([]BackupState, error)
+	Schedule(ctx context.Context) ([]ScheduleEntry, error)
+	Health(ctx context.Context) (HealthReport, error)
+	Reconcile(ctx context.Context) error
+	UpdateImages(ctx context.Context) error
+}
+
+// how long cli waits for daemon to respond before falling back to direct mode
+const daemonPingTimeout = 2 * time.Second
+
+// delay before failed docker host is run again, when maestro manages several hosts
+const hostRetryDelay = 30 * time.Second
+
+// NewRootCmd returns maestro cli managing docker hosts. Daemon, control and metrics servers are set by conf
+func NewRootCmd(conf Config, hosts []*ContainerManager) *cobra.Command {
+	control := NewControlClient(conf.ControlSocket)
+
+	var (
+		useDaemon bool
+		direct    bool
+		progress  string
+		hostName  string
+	)
+
+	// apiOf returns daemon api of host if daemon is running, otherwise host manager works with docker directly
+	apiOf := func(mngr *ContainerManager) maestroApi {
+		if useDaemon {
+			return control.ForHost(mngr.host)
+		}
+
+		return mngr
+	}
+
+	// eachHost runs fn for every host selected by --host. Hosts are independent, so failed host does not stop others
+	eachHost := func(fn func(mngr *ContainerManager, api maestroApi) error) error {
+		mngrs, err := selectHosts(hosts, hostName)
+		if err != nil {
+			return err
+		}
+
+		errs := []error{}
+
+		for _, mngr := range mngrs {
+			errs = append(errs, hostError(mngr, fn(mngr, apiOf(mngr))))
+		}
+
+		return errors.Join(errs...)
+	}
+
+	// oneHost returns host selected by --host for commands with backup name, as names are unique per host only
+	oneHost := func() (*ContainerManager, error) {
+		mngrs, err := selectHosts(hosts, hostName)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(mngrs) > 1 {
+			return nil, fmt.Errorf("--host is required, maestro manages hosts %s", strings.Join(hostNames(hosts), ", "))
+		}
+
+		return mngrs[0], nil
+	}
+
 	rootCmd := &cobra.Command{
 		Use:           filepath.Base(os.Args[0]),
 		Short:         "Utility to auto start/stop backup containers",
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			log.Println("Starting maestro")
-			return mngr.Run(cmd.Context())
+			slog.Info("starting maestro")
+
+			// scheduled force-backups are jobs of control server, so they are listed and canceled as manual ones
+			srv := NewControlServer(hosts...)
+
+			if len(conf.ControlSocket) > 0 || len(conf.ControlListen) > 0 {
+				go func() {
+					err := srv.Serve(cmd.Context(), conf.ControlSocket, conf.ControlListen)
+					if err != nil {
+						slog.Error("control server failed", logKeyError, err)
+					}
+				}()
+			}
+
+			if len(conf.MetricsListen) > 0 {
+				go func() {
+					err := ServeMetrics(cmd.Context(), conf.MetricsListen, hosts)
+					if err != nil {
+						slog.Error("metrics server failed", logKeyError, err)
+					}
+				}()
+			}
+
+			for _, mngr := range hosts {
+				go mngr.RunScheduler(cmd.Context(), srv.jobs)
+			}
+
+			err := runHosts(cmd.Context(), hosts, hostRetryDelay)
+
+			// jobs are canceled with daemon context, but they still have to stop one-off containers,
+			// start backupers back and record results before process exits
+			srv.jobs.Wait(jobsShutdownTimeout)
+
+			return err
 		},
 	}
 
 	rootCmd.CompletionOptions.HiddenDefaultCmd = true
 
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		// root command is daemon itself, it writes progress to logs
+		if cmd == rootCmd {
+			return nil
+		}
+
+		_, err := selectHosts(hosts, hostName)
+		if err != nil {
+			return err
+		}
+
+		for _, mngr := range hosts {
+			err := mngr.SetProgress(progress, os.Stderr)
+			if err != nil {
+				return err
+			}
+		}
+
+		if direct || len(conf.ControlSocket) == 0 {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), daemonPingTimeout)
+		defer cancel()
+
+		useDaemon = control.ForHost(hosts[0].host).Available(ctx)
+
+		// daemon pulls and builds with its own progress output
+		if useDaemon && cmd.Flags().Changed("progress") {
+			slog.Warn("--progress has no effect when command is run by maestro daemon, progress is written to daemon log, use --direct to print it here")
+		}
+
+		return nil
+	}
+
+	rootCmd.PersistentFlags().BoolVar(&direct, "direct", false, "work with docker directly even if maestro daemon is running")
+	rootCmd.PersistentFlags().StringVar(&progress, "progress", ProgressAuto, "build and pull progress output: auto, plain, tty or quiet")
+	rootCmd.PersistentFlags().StringVar(&hostName, "host", "", "docker host from HOSTS_PATH file, all hosts if empty")
+
+	var (
+		oneOffOpts OneOffOptions
+		detach     bool
+	)
+
+	// name is checked before connecting to daemon, so invalid name fails fast with the reason
+	backupNameArg := func(cmd *cobra.Command, args []string) error {
+		err := cobra.ExactArgs(1)(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		mngr, err := oneHost()
+		if err != nil {
+			return err
+		}
+
+		_, err = mngr.resolveBackupName(args[0])
+
+		return err
+	}
+
+	startDetached := func(ctx context.Context, mngr *ContainerManager, typ string, name string) error {
+		info, err := control.ForHost(mngr.host).StartJob(ctx, JobRequest{Type: typ, Name: name, Timeout: oneOffOpts.Timeout})
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(info.ID)
+
+		return nil
+	}
+
 	restoreCmd := &cobra.Command{
 		Use:   "restore name",
 		Short: "Restore container",
-		Args:  cobra.ExactArgs(1),
+		Args:  backupNameArg,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			log.Println("Restoring")
+			mngr, err := oneHost()
+			if err != nil {
+				return err
+			}
+
+			if detach {
+				return startDetached(cmd.Context(), mngr, JobTypeRestore, args[0])
+			}
+
+			slog.Info("restoring", logKeyBackupName, args[0])
 
-			return mngr.Restore(cmd.Context(), args[0])
+			return apiOf(mngr).Restore(cmd.Context(), args[0], oneOffOpts)
 		},
 	}
 
@@ -42,18 +243,29 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 		Use:   "restore-all",
 		Short: "Restore all available containers (including stopped)",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.RestoreAll(cmd.Context())
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return api.RestoreAll(cmd.Context(), oneOffOpts)
+			})
 		},
 	}
 
 	forceBackupCmd := &cobra.Command{
 		Use:   "force-backup name",
 		Short: "Force backup container",
-		Args:  cobra.ExactArgs(1),
+		Args:  backupNameArg,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			log.Println("Running force backup")
+			mngr, err := oneHost()
+			if err != nil {
+				return err
+			}
+
+			if detach {
+				return startDetached(cmd.Context(), mngr, JobTypeForceBackup, args[0])
+			}
+
+			slog.Info("running force backup", logKeyBackupName, args[0])
 
-			return mngr.ForceBackup(cmd.Context(), args[0])
+			return apiOf(mngr).ForceBackup(cmd.Context(), args[0], oneOffOpts)
 		},
 	}
 
@@ -63,17 +275,97 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 		Use:   "force-backup-all",
 		Short: "Force backup all available containers (optionally include stopped)",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.ForceBackupAll(cmd.Context(), includeStopped)
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return api.ForceBackupAll(cmd.Context(), includeStopped, oneOffOpts)
+			})
 		},
 	}
 
 	forceBackupAllCmd.Flags().BoolVar(&includeStopped, "include-stopped", false, "include stopped containers")
 
+	for _, cmd := range []*cobra.Command{restoreCmd, restoreAllCmd, forceBackupCmd, forceBackupAllCmd} {
+		cmd.Flags().DurationVar(&oneOffOpts.Timeout, "timeout", 0, "stop one-off container if it runs longer (overrides template timeout)")
+	}
+
+	for _, cmd := range []*cobra.Command{restoreCmd, forceBackupCmd} {
+		cmd.Flags().BoolVarP(&detach, "detach", "d", false, "hand job over to running maestro daemon and print job id")
+	}
+
+	reconcileCmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Create, recreate and remove backup containers to match containers labeled for backup",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return api.Reconcile(cmd.Context())
+			})
+		},
+	}
+
+	updateImagesCmd := &cobra.Command{
+		Use:   "update-images",
+		Short: "Pull or build images of all templates and recreate backup containers with outdated image",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return api.UpdateImages(cmd.Context())
+			})
+		},
+	}
+
+	jobsCmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "List detached jobs of maestro daemon",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobs, err := control.Jobs(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			printJobs(os.Stdout, jobs)
+
+			return nil
+		},
+	}
+
+	var followLogs bool
+
+	jobLogsCmd := &cobra.Command{
+		Use:   "job-logs id",
+		Short: "Print logs of detached job",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return control.JobLogs(cmd.Context(), args[0], followLogs, os.Stdout)
+		},
+	}
+
+	jobLogsCmd.Flags().BoolVarP(&followLogs, "follow", "f", false, "follow logs until job is finished")
+
+	jobWaitCmd := &cobra.Command{
+		Use:   "job-wait id",
+		Short: "Wait for detached job to finish, exit with error if job failed",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info, err := control.WaitJob(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+
+			if info.Status == JobFailed {
+				return fmt.Errorf("%s job %s for '%s' failed: %s", info.Type, info.ID, info.Name, info.Error)
+			}
+
+			slog.Info("job finished", "job_id", info.ID, "job_type", info.Type, logKeyBackupName, info.Name, "status", info.Status)
+
+			return nil
+		},
+	}
+
 	buildAllCmd := &cobra.Command{
 		Use:   "build-all",
 		Short: "Build backup restore and force-backup containers",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.BuildAll(cmd.Context())
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return mngr.BuildAll(cmd.Context())
+			})
 		},
 	}
 
@@ -81,7 +373,9 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 		Use:   "build-backup",
 		Short: "Build backup container",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.BuildBackuper(cmd.Context())
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return mngr.BuildBackuper(cmd.Context())
+			})
 		},
 	}
 
@@ -89,7 +383,9 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 		Use:   "build-restore",
 		Short: "Build restore container",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.BuildRestore(cmd.Context())
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return mngr.BuildRestore(cmd.Context())
+			})
 		},
 	}
 
@@ -97,16 +393,23 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 		Use:   "build-force",
 		Short: "Build force-backup container",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.BuildForce(cmd.Context())
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return mngr.BuildForce(cmd.Context())
+			})
 		},
 	}
 
 	stopCmd := &cobra.Command{
 		Use:   "stop name",
 		Short: "Stop backup/restore container",
-		Args:  cobra.ExactArgs(1),
+		Args:  backupNameArg,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.Stop(cmd.Context(), args[0])
+			mngr, err := oneHost()
+			if err != nil {
+				return err
+			}
+
+			return apiOf(mngr).Stop(cmd.Context(), args[0])
 		},
 	}
 
@@ -114,16 +417,23 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 		Use:   "stop-all",
 		Short: "Stop all backup/restore containers",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.StopAll(cmd.Context())
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return api.StopAll(cmd.Context())
+			})
 		},
 	}
 
 	startCmd := &cobra.Command{
 		Use:   "start name",
 		Short: "Start previously stopped backup container",
-		Args:  cobra.ExactArgs(1),
+		Args:  backupNameArg,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.StartBackuper(cmd.Context(), args[0])
+			mngr, err := oneHost()
+			if err != nil {
+				return err
+			}
+
+			return apiOf(mngr).StartBackuper(cmd.Context(), args[0])
 		},
 	}
 
@@ -131,16 +441,23 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 		Use:   "start-all",
 		Short: "Start all previously stopped backup containers",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.StartAll(cmd.Context())
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return api.StartAll(cmd.Context())
+			})
 		},
 	}
 
 	createCmd := &cobra.Command{
 		Use:   "create name",
 		Short: "Create backup container",
-		Args:  cobra.ExactArgs(1),
+		Args:  backupNameArg,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.CreateBackuper(cmd.Context(), args[0])
+			mngr, err := oneHost()
+			if err != nil {
+				return err
+			}
+
+			return apiOf(mngr).CreateBackuper(cmd.Context(), args[0])
 		},
 	}
 
@@ -148,16 +465,23 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 		Use:   "create-all",
 		Short: "Create all backup containers",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.CreateAll(cmd.Context())
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return api.CreateAll(cmd.Context())
+			})
 		},
 	}
 
 	removeCmd := &cobra.Command{
 		Use:   "remove name",
 		Short: "Remove backup and restore container",
-		Args:  cobra.ExactArgs(1),
+		Args:  backupNameArg,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.RemoveBackuper(cmd.Context(), args[0])
+			mngr, err := oneHost()
+			if err != nil {
+				return err
+			}
+
+			return apiOf(mngr).RemoveBackuper(cmd.Context(), args[0])
 		},
 	}
 
@@ -165,7 +489,9 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 		Use:   "remove-all",
 		Short: "Remove all backup and restore containers",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.RemoveAll(cmd.Context())
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return api.RemoveAll(cmd.Context())
+			})
 		},
 	}
 
@@ -173,7 +499,9 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 		Use:   "pull-backup",
 		Short: "Pull image for backup container",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.PullBackuper(cmd.Context())
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return mngr.PullBackuper(cmd.Context())
+			})
 		},
 	}
 
@@ -181,7 +509,9 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 		Use:   "pull-restore",
 		Short: "Pull image for restore container",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.PullRestore(cmd.Context())
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return mngr.PullRestore(cmd.Context())
+			})
 		},
 	}
 
@@ -189,7 +519,9 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 		Use:   "pull-force-backup",
 		Short: "Pull image for force-backup container",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.PullForce(cmd.Context())
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return mngr.PullForce(cmd.Context())
+			})
 		},
 	}
 
@@ -197,17 +529,68 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 		Use:   "pull-all",
 		Short: "Pull images for backup, restore and force-backup containers",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.PullAll(cmd.Context())
+			return eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				return mngr.PullAll(cmd.Context())
+			})
 		},
 	}
 
-	var listOpts ListOptions
+	var (
+		listOpts       ListOptions
+		listLastBackup bool
+		listOutput     string
+	)
 
 	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List containers labeled for backup",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mngr.List(cmd.Context(), listOpts)
+			err := checkOutputFormat(listOutput)
+			if err != nil {
+				return err
+			}
+
+			// entries of reachable hosts are printed even if some host failed
+			if listLastBackup {
+				// backup times are the point of this list, so it is a table unless asked otherwise
+				if !cmd.Flags().Changed("output") {
+					listOutput = OutputTable
+				}
+
+				states := []BackupState{}
+
+				hostsErr := eachHost(func(mngr *ContainerManager, api maestroApi) error {
+					hostStates, err := api.LastBackups(cmd.Context())
+					states = append(states, hostStates...)
+					return err
+				})
+
+				names := []string{}
+				for _, state := range states {
+					names = append(names, state.Name)
+				}
+
+				return errors.Join(printOutput(os.Stdout, listOutput, states, names, func(w io.Writer) {
+					printBackups(w, states)
+				}), hostsErr)
+			}
+
+			entries := []ListEntry{}
+
+			hostsErr := eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				hostEntries, err := api.List(cmd.Context(), listOpts)
+				entries = append(entries, hostEntries...)
+				return err
+			})
+
+			names := []string{}
+			for _, entry := range entries {
+				names = append(names, entry.Name)
+			}
+
+			return errors.Join(printOutput(os.Stdout, listOutput, entries, names, func(w io.Writer) {
+				printList(w, entries)
+			}), hostsErr)
 		},
 	}
 
@@ -215,7 +598,108 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 	listCmd.Flags().BoolVar(&listOpts.Backupers, "backup", false, "list backup containers instead")
 	listCmd.Flags().BoolVar(&listOpts.Restores, "restore", false, "list restore containers instead")
 	listCmd.Flags().BoolVar(&listOpts.ForceBackups, "force-backup", false, "list force-backup containers instead")
-	listCmd.MarkFlagsMutuallyExclusive("backup", "restore", "force-backup")
+	listCmd.Flags().BoolVarP(&listLastBackup, "last-backup", "l", false, "list containers labeled for backup (including stopped) with last successful backup and restore")
+	listCmd.Flags().StringVarP(&listOutput, "output", "o", OutputName, "output format: name, table, json or yaml")
+	listCmd.MarkFlagsMutuallyExclusive("backup", "restore", "force-backup", "last-backup")
+
+	var statusOutput string
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Check backup, restore and force-backup containers and templates, exit with error if there are problems",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := checkOutputFormat(statusOutput)
+			if err != nil {
+				return err
+			}
+
+			reports := []HealthReport{}
+
+			hostsErr := eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				report, err := api.Health(cmd.Context())
+				if err != nil {
+					return err
+				}
+
+				reports = append(reports, report)
+				return nil
+			})
+
+			report := mergeHealth(reports)
+
+			names := []string{}
+			for _, issue := range report.Issues {
+				names = append(names, issue.Name)
+			}
+
+			err = printOutput(os.Stdout, statusOutput, report, slices.Compact(names), func(w io.Writer) {
+				printHealth(w, report)
+			})
+			if err != nil {
+				return err
+			}
+
+			if hostsErr != nil {
+				return hostsErr
+			}
+
+			if !report.Healthy() {
+				return fmt.Errorf("%d problems found", len(report.Issues))
+			}
+
+			return nil
+		},
+	}
+
+	statusCmd.Flags().StringVarP(&statusOutput, "output", "o", OutputTable, "output format: table, name (names with problems), json or yaml")
+
+	var staleAge time.Duration
+
+	staleCmd := &cobra.Command{
+		Use:   "stale",
+		Short: "List containers without successful backup for too long, exit with error if there are any",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			states := []BackupState{}
+
+			err := eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				hostStates, err := api.LastBackups(cmd.Context())
+				states = append(states, hostStates...)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			stale := StaleBackups(states, staleAge, time.Now())
+			if len(stale) == 0 {
+				return nil
+			}
+
+			printBackups(os.Stdout, stale)
+
+			return fmt.Errorf("%d of %d containers have no successful backup for %s", len(stale), len(states), staleAge)
+		},
+	}
+
+	staleCmd.Flags().DurationVar(&staleAge, "older-than", 26*time.Hour, "max age of last successful backup")
+
+	scheduleCmd := &cobra.Command{
+		Use:   "schedule",
+		Short: "List scheduled force-backups with their next run times",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries := []ScheduleEntry{}
+
+			err := eachHost(func(mngr *ContainerManager, api maestroApi) error {
+				hostEntries, err := api.Schedule(cmd.Context())
+				entries = append(entries, hostEntries...)
+				return err
+			})
+
+			printSchedule(os.Stdout, entries)
+
+			return err
+		},
+	}
 
 	rootCmd.AddCommand(
 		restoreCmd,
@@ -235,35 +719,365 @@ func NewRootCmd(mngr *ContainerManager) *cobra.Command {
 		pullForceCmd,
 		pullAllCmd,
 		listCmd,
+		staleCmd,
+		scheduleCmd,
+		statusCmd,
 		createCmd,
 		createAllCmd,
 		removeCmd,
 		removeAllCmd,
+		reconcileCmd,
+		updateImagesCmd,
+		jobsCmd,
+		jobLogsCmd,
+		jobWaitCmd,
 	)
 
 	return rootCmd
 }
 
+func printJobs(w io.Writer, jobs []JobInfo) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	withHost := slices.ContainsFunc(jobs, func(info JobInfo) bool {
+		return len(info.Host) > 0
+	})
+
+	header := []string{"ID", "TYPE"}
+	if withHost {
+		header = append(header, "HOST")
+	}
+
+	fmt.Fprintln(tw, strings.Join(append(header, "NAME", "STATUS", "STARTED", "FINISHED", "ERROR"), "\t"))
+
+	for _, info := range jobs {
+		finished := ""
+		if info.FinishedAt != nil {
+			finished = info.FinishedAt.Format(time.DateTime)
+		}
+
+		row := []string{info.ID, info.Type}
+		if withHost {
+			row = append(row, info.Host)
+		}
+
+		row = append(row, info.Name, string(info.Status), info.StartedAt.Format(time.DateTime), finished, info.Error)
+
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	tw.Flush()
+}
+
+const (
+	OutputTable = "table"
+	OutputName  = "name"
+	OutputJson  = "json"
+	OutputYaml  = "yaml"
+)
+
+func checkOutputFormat(format string) error {
+	switch format {
+	case OutputTable, OutputName, OutputJson, OutputYaml:
+		return nil
+	}
+
+	return fmt.Errorf("unknown output format '%s', must be one of %s, %s, %s, %s", format, OutputTable, OutputName, OutputJson, OutputYaml)
+}
+
+// printOutput prints val as json or yaml, only names or table printed by table func
+func printOutput(w io.Writer, format string, val any, names []string, table func(w io.Writer)) error {
+	switch format {
+	case OutputTable:
+		table(w)
+
+	case OutputName:
+		for _, name := range names {
+			fmt.Fprintln(w, name)
+		}
+
+	case OutputJson:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(val)
+
+	case OutputYaml:
+		data, err := yaml.Marshal(val)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(data)
+		return err
+
+	default:
+		return checkOutputFormat(format)
+	}
+
+	return nil
+}
+
+func printList(w io.Writer, entries []ListEntry) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	// restore and force-backup containers are listed with their own name and state
+	withContainer := slices.ContainsFunc(entries, func(entry ListEntry) bool {
+		return len(entry.Container) > 0
+	})
+
+	// entries of several docker hosts are marked with host
+	withHost := slices.ContainsFunc(entries, func(entry ListEntry) bool {
+		return len(entry.Host) > 0
+	})
+
+	header := []string{}
+	if withHost {
+		header = append(header, "HOST")
+	}
+
+	header = append(header, "NAME")
+	if withContainer {
+		header = append(header, "CONTAINER", "STATE")
+	}
+
+	header = append(header, "TARGET", "TARGET STATE", "BACKUPER", "BACKUPER ID", "BACKUPER STATE", "SYNC", "TEMPLATE", "IMAGE", "NETWORKS", "PATHS", "LAST JOB")
+
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, entry := range entries {
+		row := []string{}
+		if withHost {
+			row = append(row, entry.Host)
+		}
+
+		row = append(row, entry.Name)
+		if withContainer {
+			row = append(row, entry.Container, entry.State)
+		}
+
+		lastJob := ""
+		if entry.LastJob != nil {
+			lastJob = entry.LastJob.String()
+		}
+
+		row = append(row, entry.Target, entry.TargetState, entry.Backuper, shortId(entry.BackuperId), entry.BackuperState, entry.Sync,
+			entry.Template, entry.Image, strings.Join(entry.Networks, ","), strings.Join(entry.Paths, ","), lastJob)
+
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	tw.Flush()
+}
+
+// shortId is container id as shown by docker cli
+func shortId(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+
+	return id
+}
+
+func printHealth(w io.Writer, report HealthReport) {
+	fmt.Fprintf(w, "containers to backup: %d, backup containers: %d, restore containers: %d, force-backup containers: %d\n",
+		report.Targets, report.Backupers, report.Restores, report.ForceBackups)
+
+	if len(report.Issues) == 0 {
+		fmt.Fprintln(w, "no problems found")
+		return
+	}
+
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	withHost := slices.ContainsFunc(report.Issues, func(issue HealthIssue) bool {
+		return len(issue.Host) > 0
+	})
+
+	header := []string{"SEVERITY", "KIND"}
+	if withHost {
+		header = append(header, "HOST")
+	}
+
+	fmt.Fprintln(tw, strings.Join(append(header, "NAME", "MESSAGE"), "\t"))
+
+	for _, issue := range report.Issues {
+		row := []string{issue.Severity, issue.Kind}
+		if withHost {
+			row = append(row, issue.Host)
+		}
+
+		fmt.Fprintln(tw, strings.Join(append(row, issue.Name, issue.Message), "\t"))
+	}
+
+	tw.Flush()
+}
+
+func printBackups(w io.Writer, states []BackupState) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	withHost := slices.ContainsFunc(states, func(state BackupState) bool {
+		return len(state.Host) > 0
+	})
+
+	header := []string{}
+	if withHost {
+		header = append(header, "HOST")
+	}
+
+	fmt.Fprintln(tw, strings.Join(append(header, "NAME", "LAST BACKUP", "SOURCE", "LAST RESTORE"), "\t"))
+
+	for _, state := range states {
+		lastBackup := "never"
+		if state.LastBackup != nil {
+			lastBackup = state.LastBackup.Local().Format(time.DateTime)
+		}
+
+		lastRestore := "never"
+		if state.LastRestore != nil {
+			lastRestore = state.LastRestore.Local().Format(time.DateTime)
+		}
+
+		row := []string{}
+		if withHost {
+			row = append(row, state.Host)
+		}
+
+		fmt.Fprintln(tw, strings.Join(append(row, state.Name, lastBackup, state.LastBackupSource, lastRestore), "\t"))
+	}
+
+	tw.Flush()
+}
+
+func printSchedule(w io.Writer, entries []ScheduleEntry) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	withHost := slices.ContainsFunc(entries, func(entry ScheduleEntry) bool {
+		return len(entry.Host) > 0
+	})
+
+	header := []string{}
+	if withHost {
+		header = append(header, "HOST")
+	}
+
+	fmt.Fprintln(tw, strings.Join(append(header, "NAME", "SCHEDULE", "NEXT RUN", "LAST BACKUP", "RUNNING JOB"), "\t"))
+
+	for _, entry := range entries {
+		nextRun := entry.Error
+		if entry.NextRun != nil {
+			nextRun = entry.NextRun.Local().Format(time.DateTime)
+		}
+
+		lastBackup := "never"
+		if entry.LastBackup != nil {
+			lastBackup = entry.LastBackup.Local().Format(time.DateTime)
+		}
+
+		row := []string{}
+		if withHost {
+			row = append(row, entry.Host)
+		}
+
+		fmt.Fprintln(tw, strings.Join(append(row, entry.Name, entry.Schedule, nextRun, lastBackup, entry.RunningJob), "\t"))
+	}
+
+	tw.Flush()
+}
+
 func RunApp() {
 	var cfg Config
 	err := env.Parse(&cfg)
 	if err != nil {
-		log.Fatalln("failed to set config:", err)
+		fatal("failed to set config", err)
 	}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	err = SetupLogging(os.Stderr, cfg.LogLevel, cfg.LogFormat)
 	if err != nil {
-		log.Fatalln("failed to create docker client:", err)
+		fatal("failed to set logging", err)
+	}
+
+	// without hosts file maestro manages single host set by DOCKER_HOST
+	hostConfigs := []HostConfig{{}}
+
+	if len(cfg.HostsPath) > 0 {
+		hostConfigs, err = ReadHostsFromFile(cfg.HostsPath)
+		if err != nil {
+			fatal("failed to read hosts", err)
+		}
+	}
+
+	hosts := []*ContainerManager{}
+
+	// limit of one-off containers is global, e.g. hosts back up to the same storage
+	queue := newJobQueue(cfg.MaxConcurrentJobs)
+
+	for _, host := range hostConfigs {
+		mngr, err := newHostManager(cfg, host, os.Environ())
+		if err != nil {
+			fatal("failed to set docker host", err)
+		}
+
+		mngr.jobQueue = queue
+
+		hosts = append(hosts, mngr)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	cmd := NewRootCmd(cfg, hosts)
+	err = cmd.ExecuteContext(ctx)
+
+	for _, mngr := range hosts {
+		mngr.notifier.Wait(notifyFlushTimeout)
+	}
+
+	if err != nil {
+		fatal("error while running", err)
+	}
+}
+
+// newHostManager creates manager of docker host with its own config, templates and docker client
+func newHostManager(cfg Config, host HostConfig, environ []string) (*ContainerManager, error) {
+	var err error
+
+	if len(host.Name) > 0 {
+		cfg, err = host.config(environ)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mngr, err := newManager(cfg, host, environ)
+	if err != nil && len(host.Name) > 0 {
+		return nil, fmt.Errorf("host %s: %w", host.Name, err)
+	}
+
+	return mngr, err
+}
+
+func newManager(cfg Config, host HostConfig, environ []string) (*ContainerManager, error) {
+	opts, err := host.dockerClientOpts()
+	if err != nil {
+		return nil, err
+	}
+
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker client - %w", err)
 	}
 
 	backuperTmpl, err := ReadTemplateFromFile(cfg.BackuperTemplatePath, true)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, fmt.Errorf("failed to read template - %w", err)
 	}
 
 	restoreTmpl, err := ReadTemplateFromFile(cfg.RestoreTemplatePath, false)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, fmt.Errorf("failed to read template - %w", err)
 	}
 
 	if !cfg.NoRestoreOverlay {
@@ -275,7 +1089,7 @@ func RunApp() {
 
 	forceTmpl, err := ReadTemplateFromFile(cfg.ForceBackupTemplatePath, false)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, fmt.Errorf("failed to read template - %w", err)
 	}
 
 	if !cfg.NoForceBackupOverlay {
@@ -292,13 +1106,66 @@ func RunApp() {
 	}
 
 	mngr := NewContainerManager(cli, tmpls, cfg)
+	mngr.host = host.Name
 
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+	mngr.notifier, err = NewNotifier(cfg.NotifyUrls, cfg.NotifyRetries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set notifications - %w", err)
+	}
 
-	cmd := NewRootCmd(mngr)
-	err = cmd.ExecuteContext(ctx)
+	mngr.notifier.host = host.Name
+
+	mngr.registry, err = loadRegistryAuth(cfg.DockerConfigPath, environ)
 	if err != nil {
-		log.Fatalln("error while running:", err)
+		return nil, fmt.Errorf("failed to read registry credentials - %w", err)
+	}
+
+	return mngr, nil
+}
+
+// runHosts runs daemon of every docker host until ctx is done. Failure of any host stops all of them,
+// same as failure of single host stops maestro
+// runHosts manages hosts until ctx is done. Single host failure stops the daemon. With several hosts
+// failed host is logged, notified and run again after retryDelay, so other hosts are managed meanwhile
+func runHosts(ctx context.Context, hosts []*ContainerManager, retryDelay time.Duration) error {
+	if len(hosts) == 1 {
+		return hostError(hosts[0], hosts[0].Run(ctx))
 	}
+
+	var wg sync.WaitGroup
+
+	for _, mngr := range hosts {
+		slog.Info("managing docker host", logKeyHost, mngr.host)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				err := mngr.Run(ctx)
+				if err == nil || ctx.Err() != nil {
+					return
+				}
+
+				slog.Error("docker host failed, retrying", logKeyHost, mngr.host, logKeyError, err, "retry_in", retryDelay)
+				mngr.notifier.Notify(NotifyEvent{Event: NotifyHostFailed, Error: err.Error()})
+
+				select {
+				case <-time.After(retryDelay):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, logKeyError, err)
+	os.Exit(1)
 }
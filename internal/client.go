@@ -0,0 +1,287 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// ControlClient talks to maestro daemon over its unix socket
+type ControlClient struct {
+	http *http.Client
+	// docker host requests are sent for, empty if maestro manages single host
+	host string
+}
+
+func NewControlClient(socketPath string) *ControlClient {
+	return &ControlClient{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// ForHost returns client sending requests for docker host from HOSTS_PATH file
+func (cl *ControlClient) ForHost(host string) *ControlClient {
+	return &ControlClient{http: cl.http, host: host}
+}
+
+// Available checks if maestro daemon is listening on socket
+func (cl *ControlClient) Available(ctx context.Context) bool {
+	_, err := cl.Status(ctx)
+	return err == nil
+}
+
+func (cl *ControlClient) Status(ctx context.Context) (DaemonStatus, error) {
+	var status DaemonStatus
+	err := cl.do(ctx, http.MethodGet, "/status", nil, &status)
+	return status, err
+}
+
+func (cl *ControlClient) List(ctx context.Context, opts ListOptions) ([]ListEntry, error) {
+	query := url.Values{}
+
+	for param, set := range map[string]bool{
+		"all":          opts.All,
+		"backup":       opts.Backupers,
+		"restore":      opts.Restores,
+		"force-backup": opts.ForceBackups,
+	} {
+		if set {
+			query.Set(param, "")
+		}
+	}
+
+	var entries []ListEntry
+	err := cl.do(ctx, http.MethodGet, "/list?"+query.Encode(), nil, &entries)
+	return entries, err
+}
+
+func (cl *ControlClient) LastBackups(ctx context.Context) ([]BackupState, error) {
+	var states []BackupState
+	err := cl.do(ctx, http.MethodGet, "/backups", nil, &states)
+	return states, err
+}
+
+func (cl *ControlClient) Schedule(ctx context.Context) ([]ScheduleEntry, error) {
+	var entries []ScheduleEntry
+	err := cl.do(ctx, http.MethodGet, "/schedule", nil, &entries)
+	return entries, err
+}
+
+func (cl *ControlClient) Health(ctx context.Context) (HealthReport, error) {
+	var report HealthReport
+	err := cl.do(ctx, http.MethodGet, "/health", nil, &report)
+	return report, err
+}
+
+func (cl *ControlClient) Reconcile(ctx context.Context) error {
+	return cl.do(ctx, http.MethodPost, "/reconcile", nil, &struct{}{})
+}
+
+func (cl *ControlClient) UpdateImages(ctx context.Context) error {
+	return cl.do(ctx, http.MethodPost, "/images/update", nil, &struct{}{})
+}
+
+func (cl *ControlClient) CreateBackuper(ctx context.Context, name string) error {
+	return cl.do(ctx, http.MethodPost, "/backupers/"+url.PathEscape(name)+"/create", nil, &struct{}{})
+}
+
+func (cl *ControlClient) RemoveBackuper(ctx context.Context, name string) error {
+	return cl.do(ctx, http.MethodPost, "/backupers/"+url.PathEscape(name)+"/remove", nil, &struct{}{})
+}
+
+func (cl *ControlClient) StartBackuper(ctx context.Context, name string) error {
+	return cl.do(ctx, http.MethodPost, "/backupers/"+url.PathEscape(name)+"/start", nil, &struct{}{})
+}
+
+func (cl *ControlClient) Stop(ctx context.Context, name string) error {
+	return cl.do(ctx, http.MethodPost, "/backupers/"+url.PathEscape(name)+"/stop", nil, &struct{}{})
+}
+
+func (cl *ControlClient) CreateAll(ctx context.Context) error {
+	return cl.do(ctx, http.MethodPost, "/backupers/create-all", nil, &struct{}{})
+}
+
+func (cl *ControlClient) RemoveAll(ctx context.Context) error {
+	return cl.do(ctx, http.MethodPost, "/backupers/remove-all", nil, &struct{}{})
+}
+
+func (cl *ControlClient) StartAll(ctx context.Context) error {
+	return cl.do(ctx, http.MethodPost, "/backupers/start-all", nil, &struct{}{})
+}
+
+func (cl *ControlClient) StopAll(ctx context.Context) error {
+	return cl.do(ctx, http.MethodPost, "/backupers/stop-all", nil, &struct{}{})
+}
+
+func (cl *ControlClient) Restore(ctx context.Context, name string, opts OneOffOptions) error {
+	return cl.runJob(ctx, JobRequest{Type: JobTypeRestore, Name: name, Timeout: opts.Timeout}, opts.Output)
+}
+
+func (cl *ControlClient) RestoreAll(ctx context.Context, opts OneOffOptions) error {
+	return cl.runJob(ctx, JobRequest{Type: JobTypeRestoreAll, Timeout: opts.Timeout}, opts.Output)
+}
+
+func (cl *ControlClient) ForceBackup(ctx context.Context, name string, opts OneOffOptions) error {
+	return cl.runJob(ctx, JobRequest{Type: JobTypeForceBackup, Name: name, Timeout: opts.Timeout}, opts.Output)
+}
+
+func (cl *ControlClient) ForceBackupAll(ctx context.Context, includeStopped bool, opts OneOffOptions) error {
+	return cl.runJob(ctx, JobRequest{Type: JobTypeForceBackupAll, Timeout: opts.Timeout, IncludeStopped: includeStopped}, opts.Output)
+}
+
+// runJob starts job in daemon and stays attached to it. If ctx is canceled job is canceled too,
+// and runJob waits for daemon to finish job cleanup
+func (cl *ControlClient) runJob(ctx context.Context, req JobRequest, output io.Writer) error {
+	if output == nil {
+		output = os.Stdout
+	}
+
+	info, err := cl.StartJob(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	err = cl.JobLogs(ctx, info.ID, true, output)
+
+	if ctx.Err() != nil {
+		// job is still running in daemon, so cancel it and wait it to clean up
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), oneOffCleanupTimeout)
+		defer cancel()
+
+		err = cl.do(cleanupCtx, http.MethodPost, "/jobs/"+info.ID+"/cancel", nil, &info)
+		if err != nil {
+			return err
+		}
+
+		ctx = cleanupCtx
+	} else if err != nil {
+		return err
+	}
+
+	info, err = cl.WaitJob(ctx, info.ID)
+	if err != nil {
+		return err
+	}
+
+	if info.Status == JobFailed {
+		return errors.New(info.Error)
+	}
+
+	return nil
+}
+
+func (cl *ControlClient) StartJob(ctx context.Context, req JobRequest) (JobInfo, error) {
+	req.Host = cl.host
+
+	var info JobInfo
+	err := cl.do(ctx, http.MethodPost, "/jobs", req, &info)
+	return info, err
+}
+
+func (cl *ControlClient) Jobs(ctx context.Context) ([]JobInfo, error) {
+	var infos []JobInfo
+	err := cl.do(ctx, http.MethodGet, "/jobs", nil, &infos)
+	return infos, err
+}
+
+func (cl *ControlClient) WaitJob(ctx context.Context, id string) (JobInfo, error) {
+	var info JobInfo
+	err := cl.do(ctx, http.MethodGet, "/jobs/"+id+"/wait", nil, &info)
+	return info, err
+}
+
+func (cl *ControlClient) JobLogs(ctx context.Context, id string, follow bool, w io.Writer) error {
+	path := "/jobs/" + id + "/logs"
+	if follow {
+		path += "?follow"
+	}
+
+	resp, err := cl.request(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (cl *ControlClient) do(ctx context.Context, method, path string, body any, result any) error {
+	resp, err := cl.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("failed to decode maestro daemon response: %w", err)
+	}
+
+	return nil
+}
+
+func (cl *ControlClient) request(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reqBody io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+
+		reqBody = bytes.NewReader(data)
+	}
+
+	// host is ignored, requests are always sent to unix socket
+	req, err := http.NewRequestWithContext(ctx, method, "http://maestro"+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cl.host) > 0 {
+		query := req.URL.Query()
+		query.Set("host", cl.host)
+		req.URL.RawQuery = query.Encode()
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := cl.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to maestro daemon: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+
+		var errResp errorResponse
+
+		err = json.NewDecoder(resp.Body).Decode(&errResp)
+		if err != nil || len(errResp.Error) == 0 {
+			return nil, fmt.Errorf("maestro daemon responded with %s", resp.Status)
+		}
+
+		return nil, fmt.Errorf("maestro daemon: %s", errResp.Error)
+	}
+
+	return resp, nil
+}
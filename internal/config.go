@@ -1,5 +1,7 @@
 package internal
 
+import "time"
+
 type Config struct {
 	Backuper struct {
 		BindToPath string `env:"BIND_PATH" envDefault:"/data"`
@@ -7,6 +9,8 @@ type Config struct {
 
 	LabelPrefix string `env:"LABEL_PREFIX" envDefault:"docker-backup-maestro"`
 
+	HostsPath string `env:"HOSTS_PATH"`
+
 	BackupNameFormat  string `env:"BACKUP_NAME_FORMAT,expand" envDefault:"${LABEL_PREFIX}.backup_{name}"`
 	RestoreNameFormat string `env:"RESTORE_NAME_FORMAT,expand" envDefault:"${LABEL_PREFIX}.restore_{name}"`
 	ForceNameFormat   string `env:"FORCEBACKUP_NAME_FORMAT,expand" envDefault:"${LABEL_PREFIX}.forcebackup_{name}"`
@@ -24,5 +28,40 @@ type Config struct {
 
 	AlwaysRw bool `env:"ALWAYS_RW"`
 
+	NameSanitize bool `env:"NAME_SANITIZE"`
+
+	DockerConfigPath string `env:"DOCKER_CONFIG_PATH" envDefault:"/root/.docker/config.json"`
+
+	FingerprintImage    bool          `env:"FINGERPRINT_IMAGE"`
+	ImageUpdateInterval time.Duration `env:"IMAGE_UPDATE_INTERVAL"`
+
+	Engine string `env:"ENGINE" envDefault:"auto"`
+
+	Swarm bool `env:"SWARM"`
+
+	ScheduleDefault string        `env:"SCHEDULE_DEFAULT"`
+	ScheduleJitter  time.Duration `env:"SCHEDULE_JITTER"`
+	ScheduleCatchUp bool          `env:"SCHEDULE_CATCHUP" envDefault:"true"`
+
+	MaxConcurrentJobs int `env:"MAX_CONCURRENT_JOBS"`
+
 	BuilderV1 bool `env:"BUILDER_V1"`
+
+	BuildContextGzip bool `env:"BUILD_CONTEXT_GZIP"`
+	BuildParallelism int  `env:"BUILD_PARALLELISM" envDefault:"1"`
+
+	LogLevel  string `env:"LOG_LEVEL" envDefault:"info"`
+	LogFormat string `env:"LOG_FORMAT" envDefault:"text"`
+
+	ControlSocket string `env:"CONTROL_SOCKET" envDefault:"/run/docker-backup-maestro.sock"`
+	ControlListen string `env:"CONTROL_LISTEN"`
+
+	MetricsListen string `env:"METRICS_LISTEN"`
+
+	StatePath             string `env:"STATE_PATH"`
+	BackupSuccessLogRegex string `env:"BACKUP_SUCCESS_LOG_REGEX"`
+	BackupMarkerDir       string `env:"BACKUP_MARKER_DIR"`
+
+	NotifyUrls    []string `env:"NOTIFY_URLS" envSeparator:","`
+	NotifyRetries int      `env:"NOTIFY_RETRIES" envDefault:"3"`
 }
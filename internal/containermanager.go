@@ -2,31 +2,45 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"maps"
+	"net"
 	"os"
 	"path"
-	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
-	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
+// time given to stop and remove one-off container and start backuper back after one-off job is over
+const oneOffCleanupTimeout = time.Minute
+
 type labels struct {
 	backupName      string
 	backupPath      string
 	backupNetworks  string
 	backupVolume    string
 	backupEnvPrefix string
+	backupSchedule  string
+	backupPriority  string
+	backupGroup     string
 
 	backuperName            string
+	backuperOriginalName    string
 	backuperConsistencyHash string
 	forceBackup             string
 	restore                 string
@@ -40,8 +54,12 @@ func prepareLabels(prefix string) labels {
 		backupNetworks:  backup + ".networks",
 		backupVolume:    backup + ".volume",
 		backupEnvPrefix: backup + ".env.",
+		backupSchedule:  backup + ".schedule",
+		backupPriority:  backup + ".priority",
+		backupGroup:     backup + ".group",
 
 		backuperName:            prefix + ".backuper" + ".name",
+		backuperOriginalName:    prefix + ".backuper" + ".originalname",
 		backuperConsistencyHash: prefix + ".backuper" + ".consistencyhash",
 
 		forceBackup: prefix + ".forcebackup",
@@ -58,8 +76,18 @@ type dockerApi interface {
 	ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error
 	ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error)
 	ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error)
+	ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error)
+	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	ServerVersion(ctx context.Context) (types.Version, error)
 	ImagePull(ctx context.Context, refStr string, options image.PullOptions) (io.ReadCloser, error)
 	ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error)
+	DialHijack(ctx context.Context, url, proto string, meta map[string][]string) (net.Conn, error)
+	ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error)
+	ServiceCreate(ctx context.Context, service swarm.ServiceSpec, options types.ServiceCreateOptions) (swarm.ServiceCreateResponse, error)
+	ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, service swarm.ServiceSpec, options types.ServiceUpdateOptions) (swarm.ServiceUpdateResponse, error)
+	ServiceRemove(ctx context.Context, serviceID string) error
+	ServiceLogs(ctx context.Context, serviceID string, options container.LogsOptions) (io.ReadCloser, error)
+	TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error)
 }
 
 type UserTemplates struct {
@@ -69,25 +97,141 @@ type UserTemplates struct {
 }
 
 type ContainerManager struct {
+	// name of docker host in HOSTS_PATH file, empty if maestro manages single host
+	host string
+
 	docker dockerApi
 	tmpls  UserTemplates
 	conf   Config
 	labels labels
+
+	// serializes backupers create/remove/start/stop made by daemon and by control api
+	lifecycle sync.Mutex
+
+	statusMu sync.Mutex
+	status   DaemonStatus
+
+	metrics  *metrics
+	backups  *backupTracker
+	notifier *Notifier
+
+	registry *registryAuth
+	progress progressOutput
+
+	// docker engine compatibility, detected on first use
+	engineMu sync.Mutex
+	compat   *engineCompat
+
+	pullsMu   sync.Mutex
+	lastPulls map[string]time.Time
+
+	// time of last scan of backuper logs by container id
+	logScansMu sync.Mutex
+	logScans   map[string]time.Time
+
+	// backup names set on more than one container, guarded by lifecycle lock.
+	// Kept to notify only when duplicate appears
+	duplicates map[string]bool
+
+	// backup names with running restore or force-backup, guarded by lifecycle lock.
+	// Their backupers are stopped by one-off job and are not created, recreated or started by reconcile
+	oneOffs map[string]bool
+
+	// limits one-off containers run at once, shared by all hosts
+	jobQueue *jobQueue
+
+	// set when daemon runs built-in scheduler
+	schedulerMu sync.Mutex
+	scheduler   *scheduler
+}
+
+type DaemonStatus struct {
+	StartedAt          *time.Time `json:"started_at,omitempty"`
+	LastReconcile      *time.Time `json:"last_reconcile,omitempty"`
+	LastReconcileError string     `json:"last_reconcile_error,omitempty"`
 }
 
 func NewContainerManager(api dockerApi, userCfg UserTemplates, conf Config) *ContainerManager {
-	return &ContainerManager{
+	mngr := &ContainerManager{
 		docker: api,
 		conf:   conf,
 		tmpls:  userCfg,
 		labels: prepareLabels(conf.LabelPrefix),
 	}
+
+	mngr.metrics = newMetrics(mngr)
+	mngr.backups = newBackupTracker(conf.StatePath)
+	mngr.notifier = &Notifier{}
+	mngr.duplicates = map[string]bool{}
+	mngr.oneOffs = map[string]bool{}
+	mngr.lastPulls = map[string]time.Time{}
+	mngr.logScans = map[string]time.Time{}
+	mngr.registry = &registryAuth{}
+	mngr.jobQueue = newJobQueue(conf.MaxConcurrentJobs)
+
+	return mngr
 }
 
 func (mngr *ContainerManager) Run(ctx context.Context) error {
+	now := time.Now()
+
+	mngr.statusMu.Lock()
+	mngr.status.StartedAt = &now
+	mngr.statusMu.Unlock()
+
+	// failed host is run again, so image updates of this run must stop with it
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if mngr.conf.ImageUpdateInterval > 0 {
+		go mngr.runImageUpdates(ctx, mngr.conf.ImageUpdateInterval)
+	}
+
 	return mngr.syncBackupers(ctx)
 }
 
+// Reconcile creates, recreates and drops backupers to match containers to backup
+func (mngr *ContainerManager) Reconcile(ctx context.Context) error {
+	start := time.Now()
+
+	err := mngr.withLifecycleLock(func() error {
+		return mngr.initBackupers(ctx)
+	})
+
+	mngr.metrics.reconcileRuns.WithLabelValues(resultLabel(err)).Inc()
+	mngr.metrics.reconcileDuration.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		mngr.notifier.Notify(NotifyEvent{Event: NotifyReconcileFailed, Error: err.Error()})
+	}
+
+	now := time.Now()
+
+	mngr.statusMu.Lock()
+	mngr.status.LastReconcile = &now
+	mngr.status.LastReconcileError = ""
+	if err != nil {
+		mngr.status.LastReconcileError = err.Error()
+	}
+	mngr.statusMu.Unlock()
+
+	return err
+}
+
+func (mngr *ContainerManager) Status() DaemonStatus {
+	mngr.statusMu.Lock()
+	defer mngr.statusMu.Unlock()
+
+	return mngr.status
+}
+
+func (mngr *ContainerManager) withLifecycleLock(fn func() error) error {
+	mngr.lifecycle.Lock()
+	defer mngr.lifecycle.Unlock()
+
+	return fn()
+}
+
 func (mngr *ContainerManager) initBackupers(ctx context.Context) error {
 	backupers, err := mngr.listContainersWithLabel(ctx, mngr.labels.backuperName, true)
 	if err != nil {
@@ -104,7 +248,7 @@ func (mngr *ContainerManager) initBackupers(ctx context.Context) error {
 		found := false
 
 		for _, toBackup := range toBackups {
-			if toBackup.Labels[mngr.labels.backupName] == backupName {
+			if mngr.nameFromLabel(&toBackup, mngr.labels.backupName) == backupName {
 				found = true
 				break
 			}
@@ -118,10 +262,28 @@ func (mngr *ContainerManager) initBackupers(ctx context.Context) error {
 		}
 	}
 
+	duplicates := mngr.groupDuplicates(toBackups, mngr.labels.backupName)
+
+	for name := range mngr.duplicates {
+		if _, ok := duplicates[name]; !ok {
+			slog.Info("backup name is not duplicated anymore", logKeyBackupName, name)
+			delete(mngr.duplicates, name)
+		}
+	}
+
+	for name, cntrs := range duplicates {
+		mngr.reportDuplicateName(name, cntrs)
+	}
+
 	for _, toBackup := range toBackups {
-		backupName := toBackup.Labels[mngr.labels.backupName]
+		backupName := mngr.nameFromLabel(&toBackup, mngr.labels.backupName)
 		found := false
 
+		// other containers are not affected, backuper of duplicated name is left as is until duplicate is resolved
+		if _, ok := duplicates[backupName]; ok {
+			continue
+		}
+
 		for _, backuper := range backupers {
 			if backuper.Labels[mngr.labels.backuperName] == backupName {
 				found = true
@@ -132,48 +294,122 @@ func (mngr *ContainerManager) initBackupers(ctx context.Context) error {
 
 		if !found {
 			err := mngr.createBackuper(ctx, backupName)
+			if errors.Is(err, ErrInvalidBackupName) {
+				slog.Error("skipping backup container", logKeyBackupName, backupName, logKeyContainerId, toBackup.ID, logKeyError, err)
+				continue
+			}
+
 			if err != nil {
 				return err
 			}
 		}
 	}
 
+	if mngr.conf.Swarm {
+		return mngr.reconcileServices(ctx)
+	}
+
 	return nil
 }
 
+// groupDuplicates returns containers grouped by backup name, for names set on more than one container
+func (mngr *ContainerManager) groupDuplicates(cntrs []types.Container, label string) map[string][]types.Container {
+	groups := map[string][]types.Container{}
+
+	for _, cntr := range cntrs {
+		value := mngr.nameFromLabel(&cntr, label)
+		groups[value] = append(groups[value], cntr)
+	}
+
+	for value, group := range groups {
+		if len(group) < 2 {
+			delete(groups, value)
+		}
+	}
+
+	return groups
+}
+
+// reportDuplicateName warns that no backuper is created for name set on several containers,
+// and notifies once per duplicate
+func (mngr *ContainerManager) reportDuplicateName(name string, cntrs []types.Container) {
+	names := []string{}
+	for _, cntr := range cntrs {
+		names = append(names, containerName(&cntr))
+	}
+
+	slog.Warn("backup name is set on more than one container, skipping backup container", logKeyBackupName, name, "containers", names)
+
+	if mngr.duplicates[name] {
+		return
+	}
+
+	mngr.duplicates[name] = true
+
+	mngr.notifier.Notify(NotifyEvent{
+		Event: NotifyDuplicateName,
+		Name:  name,
+		Error: fmt.Sprintf("backup name is set on containers: %s", strings.Join(names, ", ")),
+	})
+}
+
 func (mngr *ContainerManager) dropBackuper(ctx context.Context, name string) error {
-	log.Println("drop backuper", name)
+	slog.Info("dropping backup container", logKeyAction, "drop", logKeyBackupName, name)
 
-	cntr, err := mngr.getContainerByLabelValue(ctx, mngr.labels.backuperName, name, false)
+	backupName, err := mngr.resolveBackupName(name)
+	if err != nil {
+		// backuper is never created for invalid name
+		slog.Info("backup container not found, skipping", logKeyBackupName, name, logKeyError, err)
+		return nil
+	}
+
+	dropped, err := mngr.removeBackuperCntr(ctx, backupName)
 	if err != nil {
 		return err
 	}
 
+	if dropped {
+		mngr.notifier.Notify(NotifyEvent{Event: NotifyBackuperDropped, Name: backupName})
+	}
+
+	return nil
+}
+
+// removeBackuperCntr stops and removes backuper, returns false if there was no backuper
+func (mngr *ContainerManager) removeBackuperCntr(ctx context.Context, name string) (bool, error) {
+	cntr, err := mngr.getContainerByLabelValue(ctx, mngr.labels.backuperName, name, false)
+	if err != nil {
+		return false, err
+	}
+
 	if cntr == nil {
-		log.Printf("Backuper container for %s not found. Skipping\n", name)
-		return nil
+		slog.Info("backup container not found, skipping", logKeyBackupName, name)
+		return false, nil
 	}
 
 	err = mngr.docker.ContainerStop(ctx, cntr.ID, container.StopOptions{})
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	err = mngr.docker.ContainerRemove(ctx, cntr.ID, container.RemoveOptions{})
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	return true, nil
 }
 
 func (mngr *ContainerManager) createBackuper(ctx context.Context, name string) error {
-	log.Println("create backuper", name)
+	slog.Info("creating backup container", logKeyAction, "create", logKeyBackupName, name)
+
+	name, err := mngr.resolveBackupName(name)
+	if err != nil {
+		return err
+	}
 
-	alphanumeric := regexp.MustCompile("^[a-zA-Z0-9-._]*$")
-	if !alphanumeric.MatchString(name) {
-		log.Printf("ERROR: invalid backup name: %s\n", name)
-		log.Println("ERROR: backup name must contain only letters, digits and '-' '_' '.'")
+	if mngr.oneOffs[name] {
+		slog.Info("one-off container is running, backup container is left as is", logKeyBackupName, name)
 		return nil
 	}
 
@@ -183,7 +419,7 @@ func (mngr *ContainerManager) createBackuper(ctx context.Context, name string) e
 	}
 
 	if existingBackuper != nil {
-		existingBackup, err := mngr.getContainerByLabelValue(ctx, mngr.labels.backupName, name, true)
+		existingBackup, err := mngr.getTargetByName(ctx, name, true)
 		if err != nil {
 			return err
 		}
@@ -191,6 +427,17 @@ func (mngr *ContainerManager) createBackuper(ctx context.Context, name string) e
 		return mngr.updateBackuper(ctx, *existingBackup, *existingBackuper)
 	}
 
+	err = mngr.startNewBackuper(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	mngr.notifier.Notify(NotifyEvent{Event: NotifyBackuperCreated, Name: name})
+
+	return nil
+}
+
+func (mngr *ContainerManager) startNewBackuper(ctx context.Context, name string) error {
 	backuperCfg, err := mngr.prepareBackuperConfigFor(ctx, name, false)
 	if err != nil {
 		return err
@@ -198,7 +445,28 @@ func (mngr *ContainerManager) createBackuper(ctx context.Context, name string) e
 
 	backuperCfg = mngr.tmpls.Backuper.Overlay(backuperCfg)
 
-	hash := backuperCfg.Hash()
+	if mngr.conf.FingerprintImage {
+		// image must be present to get its id for fingerprint
+		bInfo, cntrCfg, _, _, err := backuperCfg.CreateConfig(mngr.conf.BackupTag)
+		if err != nil {
+			return err
+		}
+
+		policy, err := backuperCfg.ImagePullPolicy()
+		if err != nil {
+			return err
+		}
+
+		err = mngr.ensureImage(ctx, bInfo, cntrCfg.Image, policy)
+		if err != nil {
+			return err
+		}
+	}
+
+	hash, _, err := mngr.backuperFingerprint(ctx, backuperCfg)
+	if err != nil {
+		return fmt.Errorf("backup container %s: %w", name, err)
+	}
 
 	backuperCfg.Labels[mngr.labels.backuperConsistencyHash] = hash
 
@@ -208,9 +476,14 @@ func (mngr *ContainerManager) createBackuper(ctx context.Context, name string) e
 }
 
 func (mngr *ContainerManager) updateBackuper(ctx context.Context, toBackup, backuper types.Container) error {
-	backupName := toBackup.Labels[mngr.labels.backupName]
+	backupName := mngr.nameFromLabel(&toBackup, mngr.labels.backupName)
 
-	log.Println("sync backuper", backupName)
+	slog.Info("syncing backup container", logKeyAction, "sync", logKeyBackupName, backupName, logKeyContainerId, backuper.ID)
+
+	if mngr.oneOffs[backupName] {
+		slog.Info("one-off container is running, backup container is left as is", logKeyBackupName, backupName, logKeyContainerId, backuper.ID)
+		return nil
+	}
 
 	backuperCfg, err := mngr.prepareBackuperConfigFor(ctx, backupName, false)
 	if err != nil {
@@ -219,25 +492,48 @@ func (mngr *ContainerManager) updateBackuper(ctx context.Context, toBackup, back
 
 	backuperCfg = mngr.tmpls.Backuper.Overlay(backuperCfg)
 
-	hash := backuperCfg.Hash()
+	hash, imageId, err := mngr.backuperFingerprint(ctx, backuperCfg)
+	if err != nil {
+		return fmt.Errorf("backup container %s: %w", backupName, err)
+	}
 
 	backuperHash := backuper.Labels[mngr.labels.backuperConsistencyHash]
 
 	if hash == backuperHash {
-		log.Println("no need to recreate", backupName)
+		slog.Info("backup container is up to date", logKeyBackupName, backupName, logKeyContainerId, backuper.ID)
 		return nil
 	}
 
-	err = mngr.dropBackuper(ctx, backupName)
+	reason := RecreateReasonConfigChanged
+	if len(imageId) > 0 && imageId != backuper.ImageID {
+		reason = RecreateReasonImageChanged
+	}
+
+	return mngr.recreateBackuper(ctx, backupName, backuper.ID, reason)
+}
+
+func (mngr *ContainerManager) recreateBackuper(ctx context.Context, name, cntrId, reason string) error {
+	mngr.metrics.recreations.WithLabelValues(reason).Inc()
+
+	slog.Info("recreating backup container", logKeyAction, "recreate", logKeyBackupName, name, logKeyContainerId, cntrId, "reason", reason)
+
+	_, err := mngr.removeBackuperCntr(ctx, name)
 	if err != nil {
-		return fmt.Errorf("failed to drop backuper %s: %w", backupName, err)
+		return fmt.Errorf("failed to drop backuper %s: %w", name, err)
 	}
 
-	return mngr.createBackuper(ctx, backupName)
+	err = mngr.startNewBackuper(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	mngr.notifier.Notify(NotifyEvent{Event: NotifyBackuperRecreated, Name: name, Reason: reason})
+
+	return nil
 }
 
 func (mngr *ContainerManager) prepareBackuperConfigFor(ctx context.Context, name string, rw bool) (*Template, error) {
-	cntr, err := mngr.getContainerByLabelValue(ctx, mngr.labels.backupName, name, true)
+	cntr, err := mngr.getTargetByName(ctx, name, true)
 	if err != nil {
 		return nil, err
 	}
@@ -246,12 +542,23 @@ func (mngr *ContainerManager) prepareBackuperConfigFor(ctx context.Context, name
 		return nil, fmt.Errorf("backup container '%s' not found", name)
 	}
 
+	return mngr.backuperConfigFrom(cntr, rw), nil
+}
+
+// backuperConfigFrom generates backuper config from labels of container to backup
+func (mngr *ContainerManager) backuperConfigFrom(cntr *types.Container, rw bool) *Template {
+	name := mngr.nameFromLabel(cntr, mngr.labels.backupName)
+
 	backuperBaseCfg := &Template{
 		Labels: map[string]string{
 			mngr.labels.backuperName: name,
 		},
 	}
 
+	if original := getContainerLabel(cntr, mngr.labels.backupName); original != name {
+		backuperBaseCfg.Labels[mngr.labels.backuperOriginalName] = original
+	}
+
 	volumes := []string{}
 
 	// check for multipath first
@@ -308,25 +615,107 @@ func (mngr *ContainerManager) prepareBackuperConfigFor(ctx context.Context, name
 		backuperBaseCfg.Networks = nets
 	}
 
-	return backuperBaseCfg, nil
+	return backuperBaseCfg
 }
 
-func (mngr *ContainerManager) oneOffContainerFromTmpl(ctx context.Context, name string, tmpl *Template, tag string, cntrNameFormat string) error {
-	backuperCntr, err := mngr.getContainerByLabelValue(ctx, mngr.labels.backuperName, name, false)
+type OneOffOptions struct {
+	// Timeout overrides template timeout if set
+	Timeout time.Duration
+	// Output receives one-off container logs, stdout if not set
+	Output io.Writer
+}
+
+func (mngr *ContainerManager) oneOffContainerFromTmpl(ctx context.Context, name string, typ string, tmpl *Template, tag string, cntrNameFormat string, opts OneOffOptions) (err error) {
+	// exit code of one-off container or reason it was not finished
+	result := "error"
+	logTail := newTailWriter(notifyLogTailLines)
+
+	defer func() {
+		mngr.metrics.jobs.WithLabelValues(typ, result).Inc()
+
+		recordErr := mngr.backups.recordJob(name, JobResult{Type: typ, Result: result, At: time.Now()})
+		if recordErr != nil {
+			slog.Error("failed to record one-off container result", logKeyTemplate, typ, logKeyBackupName, name, logKeyError, recordErr)
+		}
+
+		ev := NotifyEvent{Event: NotifyJobSucceeded, Name: name, JobType: typ, LogTail: logTail.String()}
+		if code, convErr := strconv.Atoi(result); convErr == nil {
+			ev.ExitCode = &code
+		}
+
+		if err != nil {
+			ev.Event = NotifyJobFailed
+			ev.Error = err.Error()
+		} else if ev.ExitCode != nil && *ev.ExitCode != 0 {
+			ev.Event = NotifyJobFailed
+			ev.Error = fmt.Sprintf("one-off container exited with code %d", *ev.ExitCode)
+		}
+
+		mngr.notifier.Notify(ev)
+	}()
+
+	timeout, err := tmpl.JobTimeout()
 	if err != nil {
 		return err
 	}
 
-	wasRunning := containerIsAlive(backuperCntr)
+	if opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+
+	output := opts.Output
+	if output == nil {
+		output = os.Stdout
+	}
+
+	output = io.MultiWriter(output, logTail)
 
-	if backuperCntr != nil {
-		log.Printf("stopping backup container %s\n", name)
-		err = mngr.docker.ContainerStop(ctx, backuperCntr.ID, container.StopOptions{})
+	group, priority, err := mngr.jobOrder(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	release, err := mngr.jobQueue.acquire(ctx, name, group, priority)
+	if err != nil {
+		result = "canceled"
+		return fmt.Errorf("canceled while waiting for turn of %s - %w", name, err)
+	}
+	defer release()
+
+	if mngr.conf.Swarm {
+		target, err := mngr.getTargetService(ctx, name)
 		if err != nil {
-			return fmt.Errorf("failed to stop backuper container %s %s - %w", name, backuperCntr.ID, err)
+			return err
 		}
+
+		if target != nil {
+			result, err = mngr.oneOffJob(ctx, name, tmpl, tag, cntrNameFormat, target, timeout, output)
+			if err != nil {
+				return err
+			}
+
+			if result == "0" {
+				mngr.recordOneOffSuccess(name, typ)
+			}
+
+			return nil
+		}
+	}
+
+	wasRunning, err := mngr.stopForOneOff(ctx, name)
+	if err != nil {
+		return err
 	}
 
+	// backuper must be started back whatever happens with one-off container,
+	// so use fresh context here, as original one may be already canceled
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), oneOffCleanupTimeout)
+		defer cancel()
+
+		err = errors.Join(err, mngr.startAfterOneOff(cleanupCtx, name, wasRunning))
+	}()
+
 	oneOffCfg, err := mngr.prepareBackuperConfigFor(ctx, name, true)
 	if err != nil {
 		return fmt.Errorf("failed to generate config for %s - %w", name, err)
@@ -337,7 +726,12 @@ func (mngr *ContainerManager) oneOffContainerFromTmpl(ctx context.Context, name
 
 	oneOffCfg = tmpl.Overlay(oneOffCfg)
 
-	oneOffCfg.autoRemove = true
+	compat, err := mngr.engine(ctx)
+	if err != nil {
+		return err
+	}
+
+	oneOffCfg.autoRemove = compat.autoRemove()
 
 	cntrName := strings.ReplaceAll(cntrNameFormat, "{name}", name)
 
@@ -346,21 +740,46 @@ func (mngr *ContainerManager) oneOffContainerFromTmpl(ctx context.Context, name
 		return fmt.Errorf("failed to create container: %w", err)
 	}
 
-	errChan := make(chan error)
+	// inspected before start, as autoremoved container may be gone right after it exits
+	tty, err := mngr.containerTty(ctx, cntrId)
+	if err != nil {
+		return errors.Join(err, mngr.removeOneOff(ctx, cntrId))
+	}
+
+	jobCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		jobCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	exitCode := -1
+
+	errChan := make(chan error, 1)
 	go func() {
-		defer close(errChan)
-		errChan <- mngr.waitForStop(ctx, cntrId)
+		var err error
+		exitCode, err = mngr.waitForStop(jobCtx, cntrId)
+		errChan <- err
 	}()
 
-	log.Printf("starting restore container %s\n", name)
-	err = mngr.docker.ContainerStart(ctx, cntrId, container.StartOptions{})
+	slog.Info("starting one-off container", logKeyAction, "start", logKeyTemplate, typ, logKeyBackupName, name, logKeyContainerId, cntrId)
+	err = mngr.docker.ContainerStart(jobCtx, cntrId, container.StartOptions{})
 	if err != nil {
-		return err
+		// autoremove does not apply to never started container
+		removeErr := mngr.removeOneOff(ctx, cntrId)
+		return errors.Join(fmt.Errorf("failed to start container %s - %w", cntrName, err), removeErr)
 	}
 
-	errReaderChan := make(chan error)
+	if !oneOffCfg.autoRemove {
+		// removed before backuper is started back, same as autoremoved one
+		defer func() {
+			err = errors.Join(err, mngr.removeOneOff(ctx, cntrId))
+		}()
+	}
+
+	errReaderChan := make(chan error, 1)
 	go func() {
-		reader, err := mngr.docker.ContainerLogs(ctx, cntrId, container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
+		reader, err := mngr.docker.ContainerLogs(jobCtx, cntrId, container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
 		if err != nil {
 			errReaderChan <- err
 			return
@@ -368,7 +787,7 @@ func (mngr *ContainerManager) oneOffContainerFromTmpl(ctx context.Context, name
 
 		defer reader.Close()
 
-		_, err = stdcopy.StdCopy(os.Stdout, os.Stdout, reader)
+		err = copyLogs(output, reader, tty)
 		if err != nil {
 			errReaderChan <- err
 			return
@@ -377,37 +796,188 @@ func (mngr *ContainerManager) oneOffContainerFromTmpl(ctx context.Context, name
 		errReaderChan <- nil
 	}()
 
-	log.Printf("wainting restore container %s to finish\n", name)
-	err = <-errChan
-	if err != nil {
-		return err
+	slog.Info("waiting one-off container to finish", logKeyTemplate, typ, logKeyBackupName, name, logKeyContainerId, cntrId)
+	for _, ch := range []chan error{errChan, errReaderChan} {
+		select {
+		case err = <-ch:
+		case <-jobCtx.Done():
+		}
+
+		if jobCtx.Err() != nil {
+			result = "canceled"
+			if errors.Is(jobCtx.Err(), context.DeadlineExceeded) {
+				result = "timeout"
+			}
+
+			return mngr.abortOneOff(ctx, cntrName, cntrId, jobCtx.Err(), oneOffCfg.autoRemove)
+		}
+
+		if err != nil {
+			return err
+		}
 	}
 
-	err = <-errReaderChan
-	if err != nil {
-		return err
+	if exitCode < 0 {
+		result = "unknown"
+		return nil
 	}
 
-	if wasRunning {
-		log.Printf("starting backup container %s\n", name)
+	result = strconv.Itoa(exitCode)
+
+	// exit code is reported by metrics and notifications, but container has done its run anyway
+	if exitCode != 0 {
+		slog.Warn("one-off container exited with non-zero code", logKeyTemplate, typ, logKeyBackupName, name, logKeyContainerId, cntrId, "exit_code", exitCode)
+		return nil
+	}
+
+	mngr.recordOneOffSuccess(name, typ)
+
+	return nil
+}
+
+// stopForOneOff stops backuper before one-off container is run and keeps reconcile away from it
+// until startAfterOneOff. Returns true if backuper was running
+func (mngr *ContainerManager) stopForOneOff(ctx context.Context, name string) (bool, error) {
+	wasRunning := false
+
+	err := mngr.withLifecycleLock(func() error {
+		backuperCntr, err := mngr.getContainerByLabelValue(ctx, mngr.labels.backuperName, name, false)
+		if err != nil {
+			return err
+		}
+
+		wasRunning = containerIsAlive(backuperCntr)
+
+		if backuperCntr != nil {
+			slog.Info("stopping backup container", logKeyAction, "stop", logKeyBackupName, name, logKeyContainerId, backuperCntr.ID)
+			err = mngr.docker.ContainerStop(ctx, backuperCntr.ID, container.StopOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to stop backuper container %s %s - %w", name, backuperCntr.ID, err)
+			}
+		}
+
+		mngr.oneOffs[name] = true
+
+		return nil
+	})
+
+	return wasRunning, err
+}
+
+// startAfterOneOff starts backuper back if it was running before one-off container. Backuper is looked up
+// again, as it could be removed or created by api while one-off container was running
+func (mngr *ContainerManager) startAfterOneOff(ctx context.Context, name string, wasRunning bool) error {
+	return mngr.withLifecycleLock(func() error {
+		delete(mngr.oneOffs, name)
+
+		if !wasRunning {
+			return nil
+		}
+
+		backuperCntr, err := mngr.getContainerByLabelValue(ctx, mngr.labels.backuperName, name, true)
+		if err != nil {
+			return fmt.Errorf("failed to start backuper %s - %w", name, err)
+		}
+
+		if backuperCntr == nil {
+			slog.Warn("backup container is gone, nothing to start", logKeyBackupName, name)
+			return nil
+		}
+
+		slog.Info("starting backup container", logKeyAction, "start", logKeyBackupName, name, logKeyContainerId, backuperCntr.ID)
 		err = mngr.docker.ContainerStart(ctx, backuperCntr.ID, container.StartOptions{})
 		if err != nil {
 			return fmt.Errorf("failed to start backuper %s - %w", name, err)
 		}
+
+		return nil
+	})
+}
+
+// recordOneOffSuccess records time of successful force-backup or restore
+func (mngr *ContainerManager) recordOneOffSuccess(name string, typ string) {
+	var err error
+
+	switch typ {
+	case JobTypeForceBackup:
+		mngr.metrics.lastForceBackupAt.WithLabelValues(name).SetToCurrentTime()
+		err = mngr.backups.recordBackup(name, BackupSourceForceBackup, time.Now())
+	case JobTypeRestore:
+		err = mngr.backups.recordRestore(name, time.Now())
+	}
+
+	if err != nil {
+		// job itself succeeded, so do not fail it
+		slog.Error("failed to record successful one-off container", logKeyTemplate, typ, logKeyBackupName, name, logKeyError, err)
+	}
+}
+
+// abortOneOff stops one-off container after timeout or cancel and waits until it is autoremoved.
+// Container which is not autoremoved is only stopped
+func (mngr *ContainerManager) abortOneOff(ctx context.Context, cntrName, cntrId string, reason error, autoRemove bool) error {
+	if errors.Is(reason, context.DeadlineExceeded) {
+		reason = fmt.Errorf("one-off container %s timed out", cntrName)
+	} else {
+		reason = fmt.Errorf("one-off container %s canceled - %w", cntrName, reason)
+	}
+
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), oneOffCleanupTimeout)
+	defer cancel()
+
+	slog.Info("stopping one-off container", logKeyAction, "stop", logKeyContainerId, cntrId, "reason", reason)
+
+	removedChan := make(chan error, 1)
+	if autoRemove {
+		go func() {
+			removedChan <- mngr.waitForRemove(cleanupCtx, cntrId)
+		}()
+	} else {
+		removedChan <- nil
+	}
+
+	err := mngr.docker.ContainerStop(cleanupCtx, cntrId, container.StopOptions{})
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return reason
+		}
+
+		return errors.Join(reason, fmt.Errorf("failed to stop container %s - %w", cntrName, err))
+	}
+
+	err = <-removedChan
+	if err != nil {
+		return errors.Join(reason, fmt.Errorf("failed to wait container %s removal - %w", cntrName, err))
+	}
+
+	return reason
+}
+
+func (mngr *ContainerManager) removeOneOff(ctx context.Context, cntrId string) error {
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), oneOffCleanupTimeout)
+	defer cancel()
+
+	err := mngr.docker.ContainerRemove(cleanupCtx, cntrId, container.RemoveOptions{Force: true})
+	if err != nil && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to remove container %s - %w", cntrId, err)
 	}
 
 	return nil
 }
 
-func (mngr *ContainerManager) Restore(ctx context.Context, name string) error {
+func (mngr *ContainerManager) Restore(ctx context.Context, name string, opts OneOffOptions) error {
 	if mngr.tmpls.Restore == nil {
 		return fmt.Errorf("restore template not set")
 	}
 
-	return mngr.oneOffContainerFromTmpl(ctx, name, mngr.tmpls.Restore, mngr.conf.RestoreTag, mngr.conf.RestoreNameFormat)
+	name, err := mngr.resolveBackupName(name)
+	if err != nil {
+		return err
+	}
+
+	return mngr.oneOffContainerFromTmpl(ctx, name, JobTypeRestore, mngr.tmpls.Restore, mngr.conf.RestoreTag, mngr.conf.RestoreNameFormat, opts)
 }
 
-func (mngr *ContainerManager) RestoreAll(ctx context.Context) error {
+func (mngr *ContainerManager) RestoreAll(ctx context.Context, opts OneOffOptions) error {
 	if mngr.tmpls.Restore == nil {
 		return fmt.Errorf("restore template not set")
 	}
@@ -418,10 +988,33 @@ func (mngr *ContainerManager) RestoreAll(ctx context.Context) error {
 	}
 
 	for _, backupCntr := range toBackups {
-		backupName := backupCntr.Labels[mngr.labels.backupName]
-		log.Printf("Restoring %s\n", backupName)
+		backupName, err := mngr.resolveBackupName(getContainerLabel(&backupCntr, mngr.labels.backupName))
+		if err != nil {
+			slog.Error("skipping container", logKeyContainerId, backupCntr.ID, logKeyError, err)
+			continue
+		}
+
+		slog.Info("restoring", logKeyBackupName, backupName)
+
+		err = mngr.oneOffContainerFromTmpl(ctx, backupName, JobTypeRestore, mngr.tmpls.Restore, mngr.conf.RestoreTag, mngr.conf.RestoreNameFormat, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !mngr.conf.Swarm {
+		return nil
+	}
 
-		err := mngr.oneOffContainerFromTmpl(ctx, backupName, mngr.tmpls.Restore, mngr.conf.RestoreTag, mngr.conf.RestoreNameFormat)
+	names, err := mngr.serviceTargetNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, backupName := range names {
+		slog.Info("restoring", logKeyBackupName, backupName)
+
+		err = mngr.oneOffContainerFromTmpl(ctx, backupName, JobTypeRestore, mngr.tmpls.Restore, mngr.conf.RestoreTag, mngr.conf.RestoreNameFormat, opts)
 		if err != nil {
 			return err
 		}
@@ -430,15 +1023,20 @@ func (mngr *ContainerManager) RestoreAll(ctx context.Context) error {
 	return nil
 }
 
-func (mngr *ContainerManager) ForceBackup(ctx context.Context, name string) error {
+func (mngr *ContainerManager) ForceBackup(ctx context.Context, name string, opts OneOffOptions) error {
 	if mngr.tmpls.ForceBackup == nil {
 		return fmt.Errorf("force backup template not set")
 	}
 
-	return mngr.oneOffContainerFromTmpl(ctx, name, mngr.tmpls.ForceBackup, mngr.conf.ForceTag, mngr.conf.ForceNameFormat)
+	name, err := mngr.resolveBackupName(name)
+	if err != nil {
+		return err
+	}
+
+	return mngr.oneOffContainerFromTmpl(ctx, name, JobTypeForceBackup, mngr.tmpls.ForceBackup, mngr.conf.ForceTag, mngr.conf.ForceNameFormat, opts)
 }
 
-func (mngr *ContainerManager) ForceBackupAll(ctx context.Context, includeStopped bool) error {
+func (mngr *ContainerManager) ForceBackupAll(ctx context.Context, includeStopped bool, opts OneOffOptions) error {
 	if mngr.tmpls.ForceBackup == nil {
 		return fmt.Errorf("force backup template not set")
 	}
@@ -448,98 +1046,86 @@ func (mngr *ContainerManager) ForceBackupAll(ctx context.Context, includeStopped
 		return err
 	}
 
+	names := []string{}
+
 	for _, backupCntr := range toBackups {
-		backupName := backupCntr.Labels[mngr.labels.backupName]
-		log.Printf("Running force backup %s\n", backupName)
+		backupName, err := mngr.resolveBackupName(getContainerLabel(&backupCntr, mngr.labels.backupName))
+		if err != nil {
+			slog.Error("skipping container", logKeyContainerId, backupCntr.ID, logKeyError, err)
+			continue
+		}
+
+		names = append(names, backupName)
+	}
 
-		err := mngr.oneOffContainerFromTmpl(ctx, backupName, mngr.tmpls.ForceBackup, mngr.conf.ForceTag, mngr.conf.ForceNameFormat)
+	if mngr.conf.Swarm {
+		svcNames, err := mngr.serviceTargetNames(ctx)
 		if err != nil {
 			return err
 		}
+
+		names = append(names, svcNames...)
 	}
 
-	return nil
+	return mngr.runQueued(ctx, names, opts, func(ctx context.Context, backupName string, opts OneOffOptions) error {
+		slog.Info("running force backup", logKeyBackupName, backupName)
+
+		return mngr.oneOffContainerFromTmpl(ctx, backupName, JobTypeForceBackup, mngr.tmpls.ForceBackup, mngr.conf.ForceTag, mngr.conf.ForceNameFormat, opts)
+	})
 }
 
+// BuildAll builds images of all templates, images shared by templates are built once
 func (mngr *ContainerManager) BuildAll(ctx context.Context) error {
-	for tag, tmpl := range map[string]*Template{
+	return mngr.buildTemplates(ctx, map[string]*Template{
 		mngr.conf.BackupTag:  mngr.tmpls.Backuper,
 		mngr.conf.ForceTag:   mngr.tmpls.ForceBackup,
 		mngr.conf.RestoreTag: mngr.tmpls.Restore,
-	} {
-		bInfo, cntrCfg, _, _, err := tmpl.CreateConfig(tag)
-		if err != nil {
-			return err
-		}
+	})
+}
 
-		if bInfo != nil {
-			log.Printf("Building %s\n", cntrCfg.Image)
+func (mngr *ContainerManager) BuildBackuper(ctx context.Context) error {
+	return mngr.buildTemplates(ctx, map[string]*Template{mngr.conf.BackupTag: mngr.tmpls.Backuper})
+}
 
-			err = mngr.buildImage(ctx, bInfo, cntrCfg.Image, true)
-			if err != nil {
-				return err
-			}
-		}
-	}
+func (mngr *ContainerManager) BuildRestore(ctx context.Context) error {
+	return mngr.buildTemplates(ctx, map[string]*Template{mngr.conf.RestoreTag: mngr.tmpls.Restore})
+}
 
-	return nil
+func (mngr *ContainerManager) BuildForce(ctx context.Context) error {
+	return mngr.buildTemplates(ctx, map[string]*Template{mngr.conf.ForceTag: mngr.tmpls.ForceBackup})
 }
 
-func (mngr *ContainerManager) BuildBackuper(ctx context.Context) error {
-	bInfo, cntrCfg, _, _, err := mngr.tmpls.Backuper.CreateConfig(mngr.conf.BackupTag)
-	if err != nil {
-		return err
-	}
+// buildTemplates builds images of templates with build by their default tags
+func (mngr *ContainerManager) buildTemplates(ctx context.Context, tmpls map[string]*Template) error {
+	var targets []buildTarget
 
-	if bInfo != nil {
-		log.Printf("Building %s\n", cntrCfg.Image)
+	for _, tag := range slices.Sorted(maps.Keys(tmpls)) {
+		tmpl := tmpls[tag]
+		if tmpl == nil {
+			continue
+		}
 
-		err = mngr.buildImage(ctx, bInfo, cntrCfg.Image, true)
+		bInfo, cntrCfg, _, _, err := tmpl.CreateConfig(tag)
 		if err != nil {
 			return err
 		}
-	}
-
-	return nil
-}
 
-func (mngr *ContainerManager) BuildRestore(ctx context.Context) error {
-	bInfo, cntrCfg, _, _, err := mngr.tmpls.Restore.CreateConfig(mngr.conf.RestoreTag)
-	if err != nil {
-		return err
-	}
-
-	if bInfo != nil {
-		log.Printf("Building %s\n", cntrCfg.Image)
+		if bInfo != nil {
+			slog.Info("building image", logKeyAction, "build", logKeyImage, cntrCfg.Image)
 
-		err = mngr.buildImage(ctx, bInfo, cntrCfg.Image, true)
-		if err != nil {
-			return err
+			targets = append(targets, buildTarget{tag: cntrCfg.Image, info: bInfo})
 		}
 	}
 
-	return nil
+	return mngr.buildImages(ctx, targets, PullBuild)
 }
 
-func (mngr *ContainerManager) BuildForce(ctx context.Context) error {
-	bInfo, cntrCfg, _, _, err := mngr.tmpls.ForceBackup.CreateConfig(mngr.conf.ForceTag)
+func (mngr *ContainerManager) Stop(ctx context.Context, name string) error {
+	name, err := mngr.resolveBackupName(name)
 	if err != nil {
 		return err
 	}
 
-	if bInfo != nil {
-		log.Printf("Building %s\n", cntrCfg.Image)
-
-		err = mngr.buildImage(ctx, bInfo, cntrCfg.Image, true)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func (mngr *ContainerManager) Stop(ctx context.Context, name string) error {
 	for _, i := range []struct {
 		tag string
 		typ string
@@ -550,7 +1136,7 @@ func (mngr *ContainerManager) Stop(ctx context.Context, name string) error {
 		}
 
 		if cntr != nil {
-			log.Printf("Stopping '%s' %s container\n", name, i.typ)
+			slog.Info("stopping container", logKeyAction, "stop", logKeyTemplate, i.typ, logKeyBackupName, name, logKeyContainerId, cntr.ID)
 
 			err := mngr.docker.ContainerStop(ctx, cntr.ID, container.StopOptions{})
 			if err != nil {
@@ -573,7 +1159,7 @@ func (mngr *ContainerManager) StopAll(ctx context.Context) error {
 		}
 
 		for _, cntr := range cntrs {
-			log.Printf("Stopping '%s' %s container\n", cntr.Labels[i.tag], i.typ)
+			slog.Info("stopping container", logKeyAction, "stop", logKeyTemplate, i.typ, logKeyBackupName, cntr.Labels[i.tag], logKeyContainerId, cntr.ID)
 
 			err := mngr.docker.ContainerStop(ctx, cntr.ID, container.StopOptions{})
 			if err != nil {
@@ -586,6 +1172,11 @@ func (mngr *ContainerManager) StopAll(ctx context.Context) error {
 }
 
 func (mngr *ContainerManager) RemoveBackuper(ctx context.Context, name string) error {
+	name, err := mngr.resolveBackupName(name)
+	if err != nil {
+		return err
+	}
+
 	for _, i := range []struct {
 		tag string
 		typ string
@@ -601,7 +1192,7 @@ func (mngr *ContainerManager) RemoveBackuper(ctx context.Context, name string) e
 				return err
 			}
 
-			log.Printf("Removing '%s' %s container\n", name, i.typ)
+			slog.Info("removing container", logKeyAction, "remove", logKeyTemplate, i.typ, logKeyBackupName, name, logKeyContainerId, cntr.ID)
 
 			err = mngr.docker.ContainerRemove(ctx, cntr.ID, container.RemoveOptions{})
 			if err != nil {
@@ -629,7 +1220,7 @@ func (mngr *ContainerManager) RemoveAll(ctx context.Context) error {
 				return err
 			}
 
-			log.Printf("Removing '%s' %s container\n", cntr.Labels[i.tag], i.typ)
+			slog.Info("removing container", logKeyAction, "remove", logKeyTemplate, i.typ, logKeyBackupName, cntr.Labels[i.tag], logKeyContainerId, cntr.ID)
 
 			err = mngr.docker.ContainerRemove(ctx, cntr.ID, container.RemoveOptions{})
 			if err != nil {
@@ -642,6 +1233,11 @@ func (mngr *ContainerManager) RemoveAll(ctx context.Context) error {
 }
 
 func (mngr *ContainerManager) StartBackuper(ctx context.Context, name string) error {
+	name, err := mngr.resolveBackupName(name)
+	if err != nil {
+		return err
+	}
+
 	cntr, err := mngr.getContainerByLabelValue(ctx, mngr.labels.backuperName, name, true)
 	if err != nil {
 		return err
@@ -651,7 +1247,7 @@ func (mngr *ContainerManager) StartBackuper(ctx context.Context, name string) er
 		return fmt.Errorf("backup container '%s' doesn't exist", name)
 	}
 
-	log.Printf("Starting '%s' backup container\n", name)
+	slog.Info("starting backup container", logKeyAction, "start", logKeyBackupName, name, logKeyContainerId, cntr.ID)
 
 	return mngr.docker.ContainerStart(ctx, cntr.ID, container.StartOptions{})
 }
@@ -663,7 +1259,7 @@ func (mngr *ContainerManager) StartAll(ctx context.Context) error {
 	}
 
 	for _, backuper := range backupers {
-		log.Printf("Starting '%s' backup container\n", backuper.Labels[mngr.labels.backuperName])
+		slog.Info("starting backup container", logKeyAction, "start", logKeyBackupName, backuper.Labels[mngr.labels.backuperName], logKeyContainerId, backuper.ID)
 
 		err := mngr.docker.ContainerStart(ctx, backuper.ID, container.StartOptions{})
 		if err != nil {
@@ -675,6 +1271,11 @@ func (mngr *ContainerManager) StartAll(ctx context.Context) error {
 }
 
 func (mngr *ContainerManager) CreateBackuper(ctx context.Context, name string) error {
+	name, err := mngr.resolveBackupName(name)
+	if err != nil {
+		return err
+	}
+
 	backuper, err := mngr.getContainerByLabelValue(ctx, mngr.labels.backuperName, name, true)
 	if err != nil {
 		return err
@@ -684,7 +1285,7 @@ func (mngr *ContainerManager) CreateBackuper(ctx context.Context, name string) e
 		return fmt.Errorf("backup container '%s' already exists, if you want to recreate it, remove first", name)
 	}
 
-	backupCntr, err := mngr.getContainerByLabelValue(ctx, mngr.labels.backupName, name, true)
+	backupCntr, err := mngr.getTargetByName(ctx, name, true)
 	if err != nil {
 		return err
 	}
@@ -703,7 +1304,11 @@ func (mngr *ContainerManager) CreateAll(ctx context.Context) error {
 	}
 
 	for _, backupCntr := range backupCntrs {
-		name := backupCntr.Labels[mngr.labels.backupName]
+		name, err := mngr.resolveBackupName(getContainerLabel(&backupCntr, mngr.labels.backupName))
+		if err != nil {
+			slog.Error("skipping container", logKeyContainerId, backupCntr.ID, logKeyError, err)
+			continue
+		}
 
 		backuper, err := mngr.getContainerByLabelValue(ctx, mngr.labels.backuperName, name, true)
 		if err != nil {
@@ -711,7 +1316,7 @@ func (mngr *ContainerManager) CreateAll(ctx context.Context) error {
 		}
 
 		if backuper != nil {
-			log.Printf("backup container '%s' already exists, skipping\n", name)
+			slog.Info("backup container already exists, skipping", logKeyBackupName, name, logKeyContainerId, backuper.ID)
 			continue
 		}
 
@@ -729,7 +1334,12 @@ func (mngr *ContainerManager) PullBackuper(ctx context.Context) error {
 		return fmt.Errorf("no image in template")
 	}
 
-	return mngr.pullImage(ctx, mngr.tmpls.Backuper.Image, true)
+	policy, err := forcedPullPolicy(mngr.tmpls.Backuper)
+	if err != nil {
+		return err
+	}
+
+	return mngr.pullImage(ctx, mngr.tmpls.Backuper.Image, policy)
 }
 
 func (mngr *ContainerManager) PullRestore(ctx context.Context) error {
@@ -737,7 +1347,12 @@ func (mngr *ContainerManager) PullRestore(ctx context.Context) error {
 		return fmt.Errorf("no image in template")
 	}
 
-	return mngr.pullImage(ctx, mngr.tmpls.Restore.Image, true)
+	policy, err := forcedPullPolicy(mngr.tmpls.Restore)
+	if err != nil {
+		return err
+	}
+
+	return mngr.pullImage(ctx, mngr.tmpls.Restore.Image, policy)
 }
 
 func (mngr *ContainerManager) PullForce(ctx context.Context) error {
@@ -745,66 +1360,29 @@ func (mngr *ContainerManager) PullForce(ctx context.Context) error {
 		return fmt.Errorf("no image in template")
 	}
 
-	return mngr.pullImage(ctx, mngr.tmpls.ForceBackup.Image, true)
+	policy, err := forcedPullPolicy(mngr.tmpls.ForceBackup)
+	if err != nil {
+		return err
+	}
+
+	return mngr.pullImage(ctx, mngr.tmpls.ForceBackup.Image, policy)
 }
 
 func (mngr *ContainerManager) PullAll(ctx context.Context) error {
 	for _, tmpl := range []*Template{mngr.tmpls.Backuper, mngr.tmpls.ForceBackup, mngr.tmpls.Restore} {
-		if len(tmpl.Image) == 0 {
+		if tmpl == nil || len(tmpl.Image) == 0 {
 			continue
 		}
 
-		err := mngr.pullImage(ctx, mngr.tmpls.Backuper.Image, true)
+		policy, err := forcedPullPolicy(tmpl)
 		if err != nil {
 			return err
 		}
-	}
-
-	return nil
-}
-
-type ListOptions struct {
-	All          bool
-	Backupers    bool
-	Restores     bool
-	ForceBackups bool
-}
-
-func (mngr *ContainerManager) List(ctx context.Context, opts ListOptions) error {
-	label := mngr.labels.backupName
-
-	if opts.Backupers {
-		label = mngr.labels.backuperName
-	}
 
-	if opts.Restores {
-		label = mngr.labels.restore
-	}
-
-	if opts.ForceBackups {
-		label = mngr.labels.forceBackup
-	}
-
-	cntrs, err := mngr.listContainersWithLabel(ctx, label, opts.All)
-	if err != nil {
-		return err
-	}
-
-	names := []string{}
-
-	for _, cntr := range cntrs {
-		name := cntr.Labels[label]
-
-		if len(name) == 0 {
-			return fmt.Errorf("failed to get container name, label %s report to maintainer", label)
+		err = mngr.pullImage(ctx, tmpl.Image, policy)
+		if err != nil {
+			return err
 		}
-
-		names = append(names, name)
-
-	}
-
-	for _, name := range names {
-		fmt.Println(name)
 	}
 
 	return nil
@@ -2,10 +2,17 @@ package internal
 
 import (
 	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -53,7 +60,7 @@ func TestStoppedBackuperOnStart(t *testing.T) {
 
 	cntr := tm.liveBackupers["example"]
 	delete(tm.liveBackupers, "example")
-	cntr.Status = "stopped"
+	cntr.State = "exited"
 	tm.stoppedBackupers["example"] = cntr
 
 	tm.resetExpectCallList()
@@ -240,7 +247,7 @@ func TestRestoreOnline(t *testing.T) {
 	tm.docker.EXPECT().Events(mock.Anything, mock.Anything).Return(eventsChan, errChan).Once()
 
 	go func() {
-		tm.mngr.Restore(ctx, "example")
+		tm.mngr.Restore(ctx, "example", OneOffOptions{})
 	}()
 
 	<-time.After(time.Second)
@@ -259,7 +266,7 @@ func TestRestoreStopped(t *testing.T) {
 
 	cntr := tm.liveBackupers["example"]
 	delete(tm.liveBackupers, "example")
-	cntr.Status = "stopped"
+	cntr.State = "exited"
 	tm.stoppedBackupers["example"] = cntr
 
 	tm.resetExpectCallList()
@@ -285,7 +292,7 @@ func TestRestoreStopped(t *testing.T) {
 	tm.docker.EXPECT().Events(mock.Anything, mock.Anything).Return(eventsChan, errChan).Once()
 
 	go func() {
-		tm.mngr.Restore(ctx, "example")
+		tm.mngr.Restore(ctx, "example", OneOffOptions{})
 	}()
 
 	<-time.After(time.Second)
@@ -361,3 +368,140 @@ func TestNewBackuperLabelsMultipath(t *testing.T) {
 }
 
 // test build/pull fail on err log
+
+func TestRestoreTimeout(t *testing.T) {
+	tm := newTestMngr(t, []string{"example"}, []string{"example"}, UserTemplates{
+		Backuper: &Template{Image: "alpine"},
+		Restore:  &Template{Image: "restore", Timeout: "1h"},
+	})
+
+	tm.expectBackuperStop("example")
+	tm.expectImageList([]string{"restore:latest"})
+	tm.expectRestoreCreateAndStart(t, "example")
+
+	tm.expectContainerEvents(events.ActionDie)
+	destroyChan, _ := tm.expectContainerEvents(events.ActionDestroy)
+
+	tm.docker.EXPECT().ContainerStop(mock.Anything, "restoreidexample", mock.Anything).Run(func(ctx context.Context, containerID string, options container.StopOptions) {
+		require.NoError(t, ctx.Err())
+
+		go func() {
+			destroyChan <- events.Message{}
+		}()
+	}).Return(nil).Once()
+
+	tm.expectBackuperStart("example")
+
+	err := tm.mngr.Restore(context.Background(), "example", OneOffOptions{Timeout: time.Second})
+	require.ErrorContains(t, err, "timed out")
+}
+
+func TestForceBackupCanceled(t *testing.T) {
+	tm := newTestMngr(t, []string{"example"}, []string{"example"}, UserTemplates{
+		Backuper:    &Template{Image: "alpine"},
+		ForceBackup: &Template{Image: "alpine"},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	tm.expectBackuperStop("example")
+	tm.expectImageList([]string{"alpine:latest"})
+
+	tm.docker.EXPECT().ContainerCreate(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "docker-backup-maestro.forcebackup_example").Return(container.CreateResponse{ID: "forceid"}, nil).Once()
+	tm.docker.EXPECT().ContainerStart(mock.Anything, "forceid", mock.Anything).Run(func(_ context.Context, _ string, _ container.StartOptions) {
+		cancel()
+	}).Return(nil).Once()
+	tm.docker.EXPECT().ContainerLogs(mock.Anything, "forceid", mock.Anything).Return(io.NopCloser(strings.NewReader("")), nil).Maybe()
+
+	tm.expectContainerEvents(events.ActionDie)
+	destroyChan, _ := tm.expectContainerEvents(events.ActionDestroy)
+
+	tm.docker.EXPECT().ContainerStop(mock.Anything, "forceid", mock.Anything).Run(func(ctx context.Context, containerID string, options container.StopOptions) {
+		require.NoError(t, ctx.Err())
+
+		go func() {
+			destroyChan <- events.Message{}
+		}()
+	}).Return(nil).Once()
+
+	tm.expectBackuperStart("example")
+
+	err := tm.mngr.ForceBackup(ctx, "example", OneOffOptions{})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestReconcileDuringForceBackup(t *testing.T) {
+	tm := newTestMngr(t, []string{"example"}, []string{"example"}, UserTemplates{
+		Backuper:    &Template{Image: "alpine"},
+		ForceBackup: &Template{Image: "alpine"},
+	})
+
+	tm.expectBackuperStop("example")
+	tm.expectImageList([]string{"alpine:latest"})
+
+	tm.docker.EXPECT().ContainerCreate(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "docker-backup-maestro.forcebackup_example").Return(container.CreateResponse{ID: "forceid"}, nil).Once()
+	tm.docker.EXPECT().ContainerLogs(mock.Anything, "forceid", mock.Anything).Return(io.NopCloser(strings.NewReader("")), nil).Maybe()
+
+	dieChan, _ := tm.expectContainerEvents(events.ActionDie)
+
+	tm.docker.EXPECT().ContainerStart(mock.Anything, "forceid", mock.Anything).Run(func(_ context.Context, _ string, _ container.StartOptions) {
+		// backuper is removed while force-backup runs, reconcile must not create it until job is over
+		delete(tm.stoppedBackupers, "example")
+		tm.resetExpectCallList()
+		tm.expectCntrList()
+
+		require.NoError(t, tm.mngr.Reconcile(context.Background()))
+
+		go func() {
+			dieChan <- events.Message{Actor: events.Actor{Attributes: map[string]string{"exitCode": "0"}}}
+		}()
+	}).Return(nil).Once()
+
+	require.NoError(t, tm.mngr.ForceBackup(context.Background(), "example", OneOffOptions{}))
+	require.Empty(t, tm.mngr.oneOffs)
+}
+
+func TestDuplicateBackupName(t *testing.T) {
+	tm := newTestMngr(t, []string{"example", "other"}, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	dup := genBackupCntr(tm.mngr, "example")
+	dup.ID = "backupidexample2"
+	tm.stoppedBackupCntrs["example2"] = dup
+
+	// must be set before default expectations to take precedence
+	tm.resetExpectCallList()
+	tm.docker.EXPECT().ContainerList(mock.Anything, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.KeyValuePair{Key: "label", Value: tm.mngr.labels.backupName + "=example"}),
+	}).Return([]types.Container{tm.liveBackupCntrs["example"], dup}, nil).Maybe()
+	tm.expectCntrList()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tm.expectListenEvents()
+	tm.expectImageList([]string{"alpine:latest"})
+
+	// only container with unique name gets backuper
+	tm.expectBackuperCreateAndStart(t, "other", nil, nil)
+
+	go func() {
+		require.NoError(t, tm.mngr.Run(ctx))
+	}()
+
+	<-time.After(time.Second)
+
+	tm.eventsChan <- events.Message{
+		Action: events.ActionCreate,
+		Actor: events.Actor{
+			Attributes: map[string]string{tm.mngr.labels.backupName: "example"},
+		},
+	}
+
+	<-time.After(time.Second)
+
+	rec := httptest.NewRecorder()
+	tm.mngr.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Contains(t, rec.Body.String(), "maestro_duplicate_backup_names 1\n")
+}
@@ -1,25 +1,23 @@
 package internal
 
 import (
-	"archive/tar"
-	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
-	"os"
-	"path/filepath"
+	"log/slog"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/pkg/stdcopy"
 
 	controlapi "github.com/moby/buildkit/api/services/control"
 	"google.golang.org/protobuf/proto"
@@ -38,11 +36,15 @@ type buildRespLine struct {
 }
 
 type pullRespLine struct {
-	Message  string
-	Status   string
-	Id       string
-	Progress string
-	Error    string
+	Message        string
+	Status         string
+	Id             string
+	Progress       string
+	ProgressDetail struct {
+		Current int64
+		Total   int64
+	}
+	Error string
 }
 
 func (mngr *ContainerManager) listContainersWithLabel(ctx context.Context, label string, searchAll bool) ([]types.Container, error) {
@@ -53,13 +55,48 @@ func (mngr *ContainerManager) listContainersWithLabel(ctx context.Context, label
 
 	opts.All = searchAll
 
-	return mngr.docker.ContainerList(ctx, opts)
+	cntrs, err := mngr.docker.ContainerList(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return mngr.standaloneContainers(cntrs), nil
 }
 
 func (mngr *ContainerManager) handleDockerEvent(ctx context.Context, event events.Message) error {
-	if event.Action == events.ActionCreate {
-		return mngr.createBackuper(ctx, event.Actor.Attributes[mngr.labels.backupName])
-	} else if event.Action == events.ActionDestroy {
+	compat, err := mngr.engine(ctx)
+	if err != nil {
+		return err
+	}
+
+	action := compat.eventAction(event)
+
+	mngr.metrics.events.WithLabelValues(string(action)).Inc()
+
+	slog.Debug("docker event", logKeyAction, action, logKeyBackupName, event.Actor.Attributes[mngr.labels.backupName], logKeyContainerId, event.Actor.ID)
+
+	// event attributes include container labels, tasks are handled with their services
+	if mngr.conf.Swarm && isSwarmTask(event.Actor.Attributes) {
+		return nil
+	}
+
+	if action == events.ActionCreate {
+		err := mngr.createBackuper(ctx, event.Actor.Attributes[mngr.labels.backupName])
+
+		// duplicate must not stop the daemon, it is reported and skipped until resolved
+		var dupErr *duplicateLabelError
+		if errors.As(err, &dupErr) && dupErr.label == mngr.labels.backupName {
+			mngr.reportDuplicateName(dupErr.value, dupErr.cntrs)
+			return nil
+		}
+
+		if errors.Is(err, ErrInvalidBackupName) {
+			slog.Error("skipping backup container", logKeyContainerId, event.Actor.ID, logKeyError, err)
+			return nil
+		}
+
+		return err
+	} else if action == events.ActionDestroy {
 		return mngr.dropBackuper(ctx, event.Actor.Attributes[mngr.labels.backupName])
 	}
 
@@ -71,10 +108,22 @@ func (mngr *ContainerManager) syncBackupers(ctx context.Context) error {
 	opts.Filters = filters.NewArgs()
 	opts.Filters.Add("label", mngr.labels.backupName)
 
+	// service events have no labels, any change of services or nodes reconciles services.
+	// Nil channels of non-swarm mode are never selected
+	var svcOpts events.ListOptions
+	svcOpts.Filters = filters.NewArgs(filters.Arg("type", string(events.ServiceEventType)), filters.Arg("type", string(events.NodeEventType)))
+
 	for {
 		eventChan, errChan := mngr.docker.Events(ctx, opts)
 
-		err := mngr.initBackupers(ctx)
+		var svcEventChan <-chan events.Message
+		var svcErrChan <-chan error
+
+		if mngr.conf.Swarm {
+			svcEventChan, svcErrChan = mngr.docker.Events(ctx, svcOpts)
+		}
+
+		err := mngr.Reconcile(ctx)
 		if err != nil {
 			return err
 		}
@@ -83,7 +132,9 @@ func (mngr *ContainerManager) syncBackupers(ctx context.Context) error {
 		for {
 			select {
 			case event := <-eventChan:
-				err := mngr.handleDockerEvent(ctx, event)
+				err := mngr.withLifecycleLock(func() error {
+					return mngr.handleDockerEvent(ctx, event)
+				})
 				if err != nil {
 					return err
 				}
@@ -99,6 +150,25 @@ func (mngr *ContainerManager) syncBackupers(ctx context.Context) error {
 
 				return fmt.Errorf("error during listen for docker events: %w", err)
 
+			case <-svcEventChan:
+				err := mngr.withLifecycleLock(func() error {
+					return mngr.reconcileServices(ctx)
+				})
+				if err != nil {
+					return err
+				}
+
+			case err := <-svcErrChan:
+				if ctx.Err() != nil {
+					return nil
+				}
+
+				if err == io.EOF {
+					break eventLoop
+				}
+
+				return fmt.Errorf("error during listen for swarm events: %w", err)
+
 			case <-ctx.Done():
 				return nil
 			}
@@ -108,6 +178,17 @@ func (mngr *ContainerManager) syncBackupers(ctx context.Context) error {
 	}
 }
 
+// duplicateLabelError is returned when label value expected to be unique is set on several containers
+type duplicateLabelError struct {
+	label string
+	value string
+	cntrs []types.Container
+}
+
+func (err *duplicateLabelError) Error() string {
+	return fmt.Sprintf("containers with label %s=%s more than 1: %d", err.label, err.value, len(err.cntrs))
+}
+
 func (mngr *ContainerManager) getContainerByLabelValue(ctx context.Context, label, value string, searchAll bool) (*types.Container, error) {
 	var listOpts container.ListOptions
 
@@ -121,8 +202,10 @@ func (mngr *ContainerManager) getContainerByLabelValue(ctx context.Context, labe
 		return nil, err
 	}
 
+	cntrs = mngr.standaloneContainers(cntrs)
+
 	if len(cntrs) > 1 {
-		return nil, fmt.Errorf("containers with label %s=%s more than 1: %d", label, value, len(cntrs))
+		return nil, &duplicateLabelError{label: label, value: value, cntrs: cntrs}
 	}
 
 	if len(cntrs) == 1 {
@@ -132,22 +215,41 @@ func (mngr *ContainerManager) getContainerByLabelValue(ctx context.Context, labe
 	return nil, nil
 }
 
+// containerTty reports if container runs with tty. Logs of such container are not multiplexed
+func (mngr *ContainerManager) containerTty(ctx context.Context, cntrId string) (bool, error) {
+	inspect, err := mngr.docker.ContainerInspect(ctx, cntrId)
+	if err != nil {
+		return false, fmt.Errorf("container inspect of %s failed - %w", cntrId, err)
+	}
+
+	return inspect.Config != nil && inspect.Config.Tty, nil
+}
+
+// copyLogs copies container logs to w. Logs of container with tty are raw, others are demultiplexed
+func copyLogs(w io.Writer, logs io.Reader, tty bool) error {
+	if tty {
+		_, err := io.Copy(w, logs)
+		return err
+	}
+
+	_, err := stdcopy.StdCopy(w, w, logs)
+	return err
+}
+
 func (mngr *ContainerManager) createContainer(ctx context.Context, cfg *Template, tag string, cntrName string) (string, error) {
 	buildInfo, cntrCfg, hstCfg, netCfg, err := cfg.CreateConfig(tag)
 	if err != nil {
 		return "", err
 	}
 
-	if buildInfo != nil {
-		err = mngr.buildImage(ctx, buildInfo, cntrCfg.Image, false)
-		if err != nil {
-			return "", err
-		}
-	} else {
-		err := mngr.pullImage(ctx, cntrCfg.Image, false)
-		if err != nil {
-			return "", err
-		}
+	policy, err := cfg.ImagePullPolicy()
+	if err != nil {
+		return "", err
+	}
+
+	err = mngr.ensureImage(ctx, buildInfo, cntrCfg.Image, policy)
+	if err != nil {
+		return "", err
 	}
 
 	resp, err := mngr.docker.ContainerCreate(ctx, cntrCfg, hstCfg, netCfg, nil, cntrName)
@@ -158,44 +260,65 @@ func (mngr *ContainerManager) createContainer(ctx context.Context, cfg *Template
 	cntrId := resp.ID
 
 	for _, warn := range resp.Warnings {
-		log.Println("WARN:", warn)
+		slog.Warn(warn, logKeyContainerId, cntrId)
 	}
 
 	return cntrId, nil
 }
 
-func (mngr *ContainerManager) pullImage(ctx context.Context, tag string, force bool) error {
-	needPull := true
-
-	if !strings.Contains(tag, ":") {
-		tag = tag + ":latest"
-	}
-
-	if !force {
+// pullImage pulls image according to pull policy: always, only if missing locally (missing, build),
+// if missing or last pulled more than a day ago (daily), or never
+func (mngr *ContainerManager) pullImage(ctx context.Context, tag string, policy string) (err error) {
+	tag = withDefaultTag(tag)
 
-		localImages, err := mngr.docker.ImageList(ctx, image.ListOptions{})
+	if policy != PullAlways {
+		localImg, err := mngr.localImage(ctx, tag)
 		if err != nil {
-			return fmt.Errorf("image list failed: %w", err)
+			return err
 		}
 
-	imgLoop:
-		for _, localImg := range localImages {
-			for _, localTag := range localImg.RepoTags {
-				if localTag == tag {
-					needPull = false
-					break imgLoop
-				}
-			}
+		if localImg == nil && policy == PullNever {
+			return fmt.Errorf("image %s not found locally and pull_policy is %s", tag, PullNever)
 		}
 
-		if !needPull {
+		if localImg != nil && policy != PullDaily {
 			return nil
 		}
+
+		if localImg != nil {
+			pulled, err := mngr.pulledSince(ctx, tag, localImg.ID, time.Now().Add(-dailyPullInterval))
+			if err != nil {
+				return err
+			}
+
+			if pulled {
+				return nil
+			}
+		}
 	}
 
-	log.Printf("pulling %s\n", tag)
+	slog.Info("pulling image", logKeyAction, "pull", logKeyImage, tag)
+
+	progress := mngr.newProgress("pull", tag)
+
+	start := time.Now()
+	defer func() {
+		progress.finish(err)
+
+		mngr.metrics.imagePulls.WithLabelValues(resultLabel(err)).Inc()
+		mngr.metrics.imagePullDuration.Observe(time.Since(start).Seconds())
+
+		if err != nil {
+			mngr.notifier.Notify(NotifyEvent{Event: NotifyPullFailed, Name: tag, Error: err.Error()})
+		}
+	}()
+
+	auth, err := mngr.registry.encodedForImage(ctx, tag)
+	if err != nil {
+		return err
+	}
 
-	resp, err := mngr.docker.ImagePull(ctx, tag, image.PullOptions{})
+	resp, err := mngr.docker.ImagePull(ctx, tag, image.PullOptions{RegistryAuth: auth})
 	if resp != nil {
 		defer resp.Close()
 	}
@@ -215,63 +338,50 @@ func (mngr *ContainerManager) pullImage(ctx context.Context, tag string, force b
 		}
 
 		if len(line.Error) > 0 {
-			fmt.Printf("build error: %s\n", line.Error)
 			return errors.New(line.Error)
 		}
 
-		if len(line.Message) > 0 {
-			fmt.Printf("pull: %s\n", line.Message)
-		} else {
-			fmt.Printf("pull: %s: %s %s", line.Id, line.Status, line.Progress)
-		}
-
+		progress.pullStatus(line)
 	}
 
-	log.Println("successfully pulled", tag)
+	mngr.recordPull(tag, time.Now())
+
+	slog.Info("successfully pulled image", logKeyAction, "pull", logKeyImage, tag)
 
 	return nil
 }
 
-func (mngr *ContainerManager) buildImage(ctx context.Context, buildInfo *BuildInfo, tag string, force bool) error {
-	needBuild := true
-
-	if !strings.Contains(tag, ":") {
-		tag = tag + ":latest"
-	}
+// buildImage builds image if it is missing locally, or always if pull policy is build or always.
+// Dependent builds are not built, see buildImages
+func (mngr *ContainerManager) buildImage(ctx context.Context, buildInfo *BuildInfo, tag string, policy string) (err error) {
+	tag = withDefaultTag(tag)
 
-	localImages, err := mngr.docker.ImageList(ctx, image.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("image list failed: %w", err)
-	}
+	if policy != PullBuild && policy != PullAlways {
+		localImg, err := mngr.localImage(ctx, tag)
+		if err != nil {
+			return err
+		}
 
-imgLoop:
-	for _, localImg := range localImages {
-		for _, localTag := range localImg.RepoTags {
-			if localTag == tag {
-				needBuild = false
-				break imgLoop
-			}
+		if localImg != nil {
+			return nil
 		}
 	}
 
-	if !needBuild && !force {
-		return nil
-	}
+	slog.Info("start building image", logKeyAction, "build", logKeyImage, tag)
 
-	for _, dependencyImage := range buildInfo.DependentBuilds {
-		depBuildInfo := &BuildInfo{
-			Context:    dependencyImage.Context,
-			Dockerfile: dependencyImage.Dockerfile,
-			Args:       dependencyImage.Args,
-		}
+	progress := mngr.newProgress("build", tag)
+
+	start := time.Now()
+	defer func() {
+		progress.finish(err)
+
+		mngr.metrics.imageBuilds.WithLabelValues(resultLabel(err)).Inc()
+		mngr.metrics.imageBuildDuration.Observe(time.Since(start).Seconds())
 
-		err := mngr.buildImage(ctx, depBuildInfo, dependencyImage.Tag, force)
 		if err != nil {
-			return fmt.Errorf("dependency (%s) build failed: %w", dependencyImage.Tag, err)
+			mngr.notifier.Notify(NotifyEvent{Event: NotifyBuildFailed, Name: tag, Error: err.Error()})
 		}
-	}
-
-	log.Println("start building", tag)
+	}()
 
 	opts := types.ImageBuildOptions{
 		Version: types.BuilderBuildKit,
@@ -288,30 +398,63 @@ imgLoop:
 		opts.BuildArgs = buildArgsPtr
 	}
 
-	if mngr.conf.BuilderV1 {
-		opts.Version = types.BuilderV1
+	compat, err := mngr.engine(ctx)
+	if err != nil {
+		return fmt.Errorf("build error: %w", err)
 	}
 
-	if len(buildInfo.Dockerfile) > 0 {
-		opts.Dockerfile = buildInfo.Dockerfile
+	if mngr.conf.BuilderV1 || !compat.buildKit() {
+		opts.Version = types.BuilderV1
 	}
 
 	opts.Tags = []string{tag}
 
-	buildCtx := "."
+	err = applyBuildOptions(&opts, buildInfo)
+	if err != nil {
+		return fmt.Errorf("build error: %w", err)
+	}
 
-	if len(buildInfo.Context) > 0 {
-		buildCtx = buildInfo.Context
+	sess, err := mngr.startBuildSession(ctx, buildInfo, tag)
+	if err != nil {
+		return fmt.Errorf("build error: %w", err)
 	}
 
-	var archive bytes.Buffer
+	if sess != nil {
+		defer sess.Close()
+
+		opts.SessionID = sess.ID()
+	}
 
-	err = tarGz(buildCtx, &archive)
+	// base images may come from any registry, so all known credentials are passed
+	auths, err := mngr.registry.all(ctx)
 	if err != nil {
 		return fmt.Errorf("build error: %w", err)
 	}
 
-	resp, err := mngr.docker.ImageBuild(ctx, &archive, opts)
+	if len(auths) > 0 {
+		opts.AuthConfigs = auths
+	}
+
+	buildCtx := "."
+
+	if len(buildInfo.Context) > 0 {
+		buildCtx = buildInfo.Context
+	}
+
+	// dockerfile outside of context is sent inside context archive
+	if len(buildInfo.Dockerfile) > 0 {
+		opts.Dockerfile, _ = contextDockerfile(buildCtx, buildInfo.Dockerfile)
+	}
+
+	// context is archived while it is uploaded, archive error aborts upload and is returned instead of upload error
+	archive := streamBuildContext(buildCtx, buildInfo.Dockerfile, mngr.conf.BuildContextGzip)
+	defer func() {
+		if archiveErr := archive.Close(); archiveErr != nil {
+			err = fmt.Errorf("build error: %w", archiveErr)
+		}
+	}()
+
+	resp, err := mngr.docker.ImageBuild(ctx, archive, opts)
 	if resp.Body != nil {
 		defer resp.Body.Close()
 	}
@@ -331,13 +474,11 @@ imgLoop:
 		}
 
 		if len(line.Error) > 0 {
-			fmt.Printf("build error: %s\n", line.Error)
-
 			return errors.New(line.Error)
-
 		}
 
-		if line.Aux != nil {
+		// classic builder and podman send image id as aux object, BuildKit sends status as base64 protobuf
+		if line.Aux != nil && opts.Version == types.BuilderBuildKit {
 			if s, ok := line.Aux.(string); ok {
 				msgData, err := base64.StdEncoding.DecodeString(s)
 				if err != nil {
@@ -350,31 +491,20 @@ imgLoop:
 					return fmt.Errorf("failed to decode protobuf aux  (%v): %w", line, err)
 				}
 
-				for _, v := range msg.Vertexes {
-					fmt.Printf("buildkit: %v\n", v.Name)
-				}
-				for _, v := range msg.Logs {
-					fmt.Printf("buildkit: %v", string(v.Msg))
-				}
-				for _, v := range msg.Statuses {
-					fmt.Printf("buildkit: %v\n", v.ID)
-				}
-				for _, v := range msg.Warnings {
-					fmt.Printf("buildkit warn: %v\n", string(v.Short))
-				}
+				progress.buildStatus(&msg)
 			}
 		}
 
 		if len(line.Message) > 0 {
-			fmt.Printf("build msg: %s\n", line.Message)
+			progress.buildStream(line.Message)
 		}
 
 		if len(line.Stream) > 0 {
-			fmt.Printf("build: %s\n", line.Stream)
+			progress.buildStream(strings.TrimSuffix(line.Stream, "\n"))
 		}
 	}
 
-	log.Println("successfully built", tag)
+	slog.Info("successfully built image", logKeyAction, "build", logKeyImage, tag)
 
 	return nil
 }
@@ -393,96 +523,78 @@ func (mngr *ContainerManager) startBackuper(ctx context.Context, cfg *Template,
 	return nil
 }
 
-func (mngr *ContainerManager) waitForStop(ctx context.Context, cntrId string) error {
-	var opts events.ListOptions
-	opts.Filters = filters.NewArgs()
-	opts.Filters.Add("id", cntrId)
-	opts.Filters.Add("type", "container")
-	opts.Filters.Add("event", "die")
-
-	eventChan, errChan := mngr.docker.Events(ctx, opts)
-
-	select {
-	case _, ok := <-eventChan:
-		if ok {
-			return nil
-		} else {
-			return fmt.Errorf("error during listen for docker events: %w", ctx.Err())
-		}
+// waitForStop returns exit code of stopped container, -1 if die event has no exit code
+func (mngr *ContainerManager) waitForStop(ctx context.Context, cntrId string) (int, error) {
+	compat, err := mngr.engine(ctx)
+	if err != nil {
+		return -1, err
+	}
 
-	case err := <-errChan:
-		return fmt.Errorf("error during listen for docker events: %w", err)
+	event, err := mngr.waitForEvent(ctx, cntrId, events.ActionDie)
+	if err != nil {
+		return -1, err
 	}
-}
 
-func getContainerLabel(cntr *types.Container, label string) string {
-	if val, ok := cntr.Labels[label]; ok {
-		return val
+	exitCode, err := strconv.Atoi(compat.exitCode(event))
+	if err != nil {
+		// container is stopped anyway, exit code is only reported
+		slog.Warn("failed to get exit code of stopped container", logKeyContainerId, cntrId, logKeyError, err)
+		return -1, nil
 	}
 
-	return ""
+	return exitCode, nil
 }
 
-func containerIsAlive(cntr *types.Container) bool {
-	return cntr != nil && (cntr.State == ContainerStatusRunning || cntr.State == ContainerStatusRestarting)
+func (mngr *ContainerManager) waitForRemove(ctx context.Context, cntrId string) error {
+	_, err := mngr.waitForEvent(ctx, cntrId, events.ActionDestroy)
+	return err
 }
 
-func tarGz(src string, writer io.Writer) error {
-
-	// ensure the src actually exists before trying to tar it
-	if _, err := os.Stat(src); err != nil {
-		return fmt.Errorf("unable to tar file %s - %v", src, err.Error())
+func (mngr *ContainerManager) waitForEvent(ctx context.Context, cntrId string, action events.Action) (events.Message, error) {
+	compat, err := mngr.engine(ctx)
+	if err != nil {
+		return events.Message{}, err
 	}
 
-	gzw := gzip.NewWriter(writer)
-	defer gzw.Close()
-
-	tw := tar.NewWriter(gzw)
-	defer tw.Close()
-
-	// walk path
-	return filepath.Walk(src, func(file string, fi os.FileInfo, err error) error {
+	var opts events.ListOptions
+	opts.Filters = filters.NewArgs()
+	opts.Filters.Add("id", cntrId)
+	opts.Filters.Add("type", "container")
 
-		// return on any error
-		if err != nil {
-			return fmt.Errorf("file %s error: %w", file, err)
-		}
+	if compat.filterEvents() {
+		opts.Filters.Add("event", string(action))
+	}
 
-		// return on non-regular files (thanks to [kumo](https://medium.com/@komuw/just-like-you-did-fbdd7df829d3) for this suggested update)
-		if !fi.Mode().IsRegular() {
-			return nil
-		}
+	eventChan, errChan := mngr.docker.Events(ctx, opts)
 
-		// create a new dir/file header
-		header, err := tar.FileInfoHeader(fi, fi.Name())
-		if err != nil {
-			return fmt.Errorf("file %s error: %w", file, err)
-		}
+	for {
+		select {
+		case event, ok := <-eventChan:
+			if !ok {
+				return events.Message{}, fmt.Errorf("error during listen for docker events: %w", ctx.Err())
+			}
 
-		// update the name to correctly reflect the desired destination when untaring
-		header.Name = strings.TrimPrefix(strings.Replace(file, src, "", -1), string(filepath.Separator))
+			if compat.matchEvent(event, action) {
+				return event, nil
+			}
 
-		// write the header
-		if err := tw.WriteHeader(header); err != nil {
-			return fmt.Errorf("file %s error: %w", file, err)
-		}
+		case err := <-errChan:
+			return events.Message{}, fmt.Errorf("error during listen for docker events: %w", err)
 
-		// open files for taring
-		f, err := os.Open(file)
-		if err != nil {
-			return fmt.Errorf("file %s error: %w", file, err)
+		case <-ctx.Done():
+			return events.Message{}, fmt.Errorf("error during listen for docker events: %w", ctx.Err())
 		}
+	}
+}
 
-		// copy file data into tar writer
-		if _, err := io.Copy(tw, f); err != nil {
-			f.Close()
-			return fmt.Errorf("file %s error: %w", file, err)
-		}
+func getContainerLabel(cntr *types.Container, label string) string {
+	if val, ok := cntr.Labels[label]; ok {
+		return val
+	}
 
-		// manually close here after each file operation; defering would cause each file close
-		// to wait until all operations have completed.
-		f.Close()
+	return ""
+}
 
-		return nil
-	})
+func containerIsAlive(cntr *types.Container) bool {
+	return cntr != nil && (cntr.State == ContainerStatusRunning || cntr.State == ContainerStatusRestarting)
 }
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+)
+
+const (
+	EngineAuto   = "auto"
+	EngineDocker = "docker"
+	EnginePodman = "podman"
+)
+
+// Podman names of container events, docker-compatible api of older podman versions sends them as is
+const (
+	podmanActionDied   events.Action = "died"
+	podmanActionRemove events.Action = "remove"
+)
+
+// engineCompat adapts paths where docker-compatible engines behave differently from docker
+type engineCompat struct {
+	name string
+}
+
+// detectEngine returns engine name by /version response
+func detectEngine(version types.Version) string {
+	if strings.Contains(strings.ToLower(version.Platform.Name), EnginePodman) {
+		return EnginePodman
+	}
+
+	for _, component := range version.Components {
+		if strings.Contains(strings.ToLower(component.Name), EnginePodman) {
+			return EnginePodman
+		}
+	}
+
+	return EngineDocker
+}
+
+// engine returns compatibility of docker engine, set by ENGINE or detected once with ServerVersion
+func (mngr *ContainerManager) engine(ctx context.Context) (engineCompat, error) {
+	mngr.engineMu.Lock()
+	defer mngr.engineMu.Unlock()
+
+	if mngr.compat != nil {
+		return *mngr.compat, nil
+	}
+
+	name := mngr.conf.Engine
+
+	switch name {
+	case EngineDocker, EnginePodman:
+	case EngineAuto:
+		version, err := mngr.docker.ServerVersion(ctx)
+		if err != nil {
+			// not cached, so detection is retried when daemon is back
+			return engineCompat{}, fmt.Errorf("failed to detect docker engine - %w", err)
+		}
+
+		name = detectEngine(version)
+
+		slog.Info("detected docker engine", "engine", name, "version", version.Version, "api_version", version.APIVersion)
+	default:
+		return engineCompat{}, fmt.Errorf("unknown ENGINE '%s', must be one of %s, %s, %s", name, EngineAuto, EngineDocker, EnginePodman)
+	}
+
+	mngr.compat = &engineCompat{name: name}
+
+	return *mngr.compat, nil
+}
+
+func (compat engineCompat) podman() bool {
+	return compat.name == EnginePodman
+}
+
+// eventAction returns docker name of container event action
+func (compat engineCompat) eventAction(event events.Message) events.Action {
+	if !compat.podman() {
+		return event.Action
+	}
+
+	switch event.Action {
+	case podmanActionDied:
+		return events.ActionDie
+	case podmanActionRemove:
+		return events.ActionDestroy
+	}
+
+	return event.Action
+}
+
+// filterEvents reports if events could be filtered by action on daemon side. Podman filters events
+// by its own action names, so they are matched by maestro
+func (compat engineCompat) filterEvents() bool {
+	return !compat.podman()
+}
+
+// matchEvent reports if event of stream filtered by action has this action, whatever engine calls it
+func (compat engineCompat) matchEvent(event events.Message, actions ...events.Action) bool {
+	if compat.filterEvents() {
+		return true
+	}
+
+	return slices.Contains(actions, compat.eventAction(event))
+}
+
+// exitCode returns exit code attribute of die event
+func (compat engineCompat) exitCode(event events.Message) string {
+	exitCode, ok := event.Actor.Attributes["exitCode"]
+	if !ok && compat.podman() {
+		return event.Actor.Attributes["containerExitCode"]
+	}
+
+	return exitCode
+}
+
+// autoRemove reports if one-off containers could be autoremoved. Podman removes container as soon as
+// it exits, racing with logs follow and remove event, so maestro removes one-off containers itself
+func (compat engineCompat) autoRemove() bool {
+	return !compat.podman()
+}
+
+// buildKit reports if engine builds with BuildKit, which sends progress as aux messages and serves sessions
+func (compat engineCompat) buildKit() bool {
+	return !compat.podman()
+}
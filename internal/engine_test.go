@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// readPodmanResponse decodes recorded response of podman docker-compatible api
+func readPodmanResponse(t *testing.T, name string, val any) {
+	data, err := os.ReadFile(filepath.Join("testdata", "podman", name))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, val))
+}
+
+// readPodmanEvents decodes recorded podman events stream
+func readPodmanEvents(t *testing.T, name string) []events.Message {
+	data, err := os.ReadFile(filepath.Join("testdata", "podman", name))
+	require.NoError(t, err)
+
+	msgs := []events.Message{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	for {
+		var msg events.Message
+		if err := dec.Decode(&msg); err == io.EOF {
+			break
+		} else {
+			require.NoError(t, err)
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return msgs
+}
+
+// newPodmanTestMngr returns manager detecting podman with recorded /version response
+func newPodmanTestMngr(t *testing.T, backupCntrs []string, backupers []string, tmpls UserTemplates) testMngr {
+	tm := newTestMngr(t, backupCntrs, backupers, tmpls)
+	tm.mngr.conf.Engine = EngineAuto
+
+	var version types.Version
+	readPodmanResponse(t, "version.json", &version)
+
+	tm.docker.EXPECT().ServerVersion(mock.Anything).Return(version, nil).Once()
+
+	return tm
+}
+
+func TestDetectEngine(t *testing.T) {
+	var version types.Version
+	readPodmanResponse(t, "version.json", &version)
+
+	require.Equal(t, EnginePodman, detectEngine(version))
+	require.Equal(t, EngineDocker, detectEngine(types.Version{
+		Platform:   struct{ Name string }{Name: "Docker Engine - Community"},
+		Components: []types.ComponentVersion{{Name: "Engine", Version: "27.5.0"}, {Name: "containerd"}},
+	}))
+
+	tm := newPodmanTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	// detected once
+	for range 2 {
+		compat, err := tm.mngr.engine(context.Background())
+		require.NoError(t, err)
+		require.True(t, compat.podman())
+	}
+
+	tm = newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	tm.mngr.conf.Engine = EngineAuto
+
+	tm.docker.EXPECT().ServerVersion(mock.Anything).Return(types.Version{}, errors.New("connection refused")).Once()
+
+	_, err := tm.mngr.engine(context.Background())
+	require.ErrorContains(t, err, "connection refused")
+
+	// failed detection is retried
+	tm.docker.EXPECT().ServerVersion(mock.Anything).Return(types.Version{Version: "27.5.0"}, nil).Once()
+
+	compat, err := tm.mngr.engine(context.Background())
+	require.NoError(t, err)
+	require.False(t, compat.podman())
+
+	tm = newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	tm.mngr.conf.Engine = "containerd"
+
+	_, err = tm.mngr.engine(context.Background())
+	require.ErrorContains(t, err, "unknown ENGINE")
+}
+
+func TestPodmanForceBackup(t *testing.T) {
+	tm := newPodmanTestMngr(t, []string{"example"}, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	tm.expectImageList([]string{"alpine:latest"})
+
+	// podman filters events by own names, so stream is filtered by maestro
+	eventsChan := make(chan events.Message)
+	tm.docker.EXPECT().Events(mock.Anything, mock.MatchedBy(func(opts events.ListOptions) bool {
+		return opts.Filters.ExactMatch("id", "forceidexample") && !opts.Filters.Contains("event")
+	})).Return(eventsChan, make(chan error)).Once()
+
+	tm.docker.EXPECT().ContainerCreate(mock.Anything, mock.Anything, mock.MatchedBy(func(hostCfg *container.HostConfig) bool {
+		return !hostCfg.AutoRemove
+	}), mock.Anything, mock.Anything, "docker-backup-maestro.forcebackup_example").Return(container.CreateResponse{ID: "forceidexample"}, nil).Once()
+
+	tm.docker.EXPECT().ContainerStart(mock.Anything, "forceidexample", mock.Anything).Run(func(_ context.Context, _ string, _ container.StartOptions) {
+		go func() {
+			for _, msg := range readPodmanEvents(t, "forcebackup_events.json") {
+				eventsChan <- msg
+			}
+		}()
+	}).Return(nil).Once()
+
+	tm.docker.EXPECT().ContainerLogs(mock.Anything, "forceidexample", mock.Anything).Return(io.NopCloser(strings.NewReader("")), nil).Once()
+
+	// not autoremoved, so removed by maestro
+	tm.docker.EXPECT().ContainerRemove(mock.Anything, "forceidexample", container.RemoveOptions{Force: true}).Return(nil).Once()
+
+	require.NoError(t, tm.mngr.ForceBackup(context.Background(), "example", OneOffOptions{}))
+
+	state, err := tm.mngr.backups.get("example")
+	require.NoError(t, err)
+	require.Equal(t, "3", state.LastJob.Result)
+}
+
+func TestPodmanRemoveEvent(t *testing.T) {
+	tm := newPodmanTestMngr(t, []string{"example"}, []string{"example"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	delete(tm.liveBackupCntrs, "example")
+
+	tm.resetExpectCallList()
+	tm.expectCntrList()
+
+	tm.expectBackuperRemove("example")
+
+	msgs := readPodmanEvents(t, "remove_event.json")
+	require.Len(t, msgs, 1)
+
+	require.NoError(t, tm.mngr.handleDockerEvent(context.Background(), msgs[0]))
+	require.NotContains(t, tm.liveBackupers, "example")
+}
+
+func TestPodmanBuild(t *testing.T) {
+	tm := newPodmanTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	var out bytes.Buffer
+	require.NoError(t, tm.mngr.SetProgress(ProgressPlain, &out))
+
+	resp, err := os.Open(filepath.Join("testdata", "podman", "build.json"))
+	require.NoError(t, err)
+
+	tm.expectImageList([]string{})
+
+	// podman does not implement BuildKit, image id is sent as aux object
+	tm.docker.EXPECT().ImageBuild(mock.Anything, mock.Anything, types.ImageBuildOptions{Version: types.BuilderV1, Tags: []string{"maestro-backup:latest"}}).Return(types.ImageBuildResponse{Body: resp}, nil).Once()
+
+	require.NoError(t, tm.mngr.buildImage(context.Background(), &BuildInfo{Context: "."}, "maestro-backup", PullMissing))
+	require.Contains(t, out.String(), "STEP 2/2: RUN apk add --no-cache restic\n")
+	require.Contains(t, out.String(), "Successfully tagged localhost/maestro-backup:latest\n")
+
+	err = tm.mngr.buildImage(context.Background(), &BuildInfo{Context: ".", Secrets: StringMapOrArray{"npm_token": "/run/secrets/npm"}}, "maestro-backup", PullMissing)
+	require.ErrorContains(t, err, "not supported by podman")
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// fingerprintVersion prefixes every fingerprint. It must be bumped only when representation
+// of existing fields changes, as it recreates all backupers
+const fingerprintVersion = "v1"
+
+// fingerprint collects normalized "key=value" entries of config. Zero values of fields are skipped,
+// so adding new field to Template does not change fingerprints of templates which do not use it.
+// Map entries and list items are kept even if empty, as setting them changes container
+type fingerprint struct {
+	entries []string
+}
+
+func (fp *fingerprint) add(key, value string) {
+	if len(value) == 0 {
+		return
+	}
+
+	fp.addEntry(key, value)
+}
+
+func (fp *fingerprint) addEntry(key, value string) {
+	fp.entries = append(fp.entries, key+"="+strconv.Quote(value))
+}
+
+func (fp *fingerprint) addList(key string, values []string) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s - %w", key, err)
+	}
+
+	fp.entries = append(fp.entries, key+"="+string(encoded))
+
+	return nil
+}
+
+func (fp *fingerprint) addMap(key string, values map[string]string) {
+	for _, k := range slices.Sorted(maps.Keys(values)) {
+		fp.addEntry(key+"."+k, values[k])
+	}
+}
+
+func (fp *fingerprint) sum() string {
+	slices.Sort(fp.entries)
+
+	hash := sha256.Sum256([]byte(strings.Join(fp.entries, "\n")))
+
+	return fingerprintVersion + ":" + hex.EncodeToString(hash[:])
+}
+
+// Fingerprint identifies container config made from template. Order of volumes, networks, devices,
+// env files and map keys does not matter. If imageId is set, it is included, so fingerprint changes
+// when image tag is updated
+func (tmpl *Template) Fingerprint(imageId string) (string, error) {
+	fp := &fingerprint{}
+
+	fp.add("build.context", tmpl.Build.Context)
+	fp.add("build.dockerfile", tmpl.Build.Dockerfile)
+	fp.addMap("build.args", tmpl.Build.Args)
+	fp.add("build.target", tmpl.Build.Target)
+	fp.addMap("build.labels", tmpl.Build.Labels)
+	fp.add("build.network", tmpl.Build.Network)
+	fp.add("build.shm_size", tmpl.Build.ShmSize)
+	fp.addMap("build.secrets", tmpl.Build.Secrets)
+
+	if tmpl.Build.NoCache {
+		fp.add("build.no_cache", "true")
+	}
+
+	if tmpl.Build.Pull {
+		fp.add("build.pull", "true")
+	}
+
+	for i, dep := range tmpl.Build.DependentBuilds {
+		prefix := fmt.Sprintf("build.dependent.%d", i)
+
+		fp.add(prefix+".tag", dep.Tag)
+		fp.add(prefix+".context", dep.Context)
+		fp.add(prefix+".dockerfile", dep.Dockerfile)
+		fp.addMap(prefix+".args", dep.Args)
+	}
+
+	fp.add("image", tmpl.Image)
+	fp.add("image_id", imageId)
+	fp.add("restart", tmpl.Restart)
+	fp.addMap("environment", tmpl.Environment)
+	fp.addMap("labels", tmpl.Labels)
+
+	if tmpl.Privileged {
+		fp.add("privileged", "true")
+	}
+
+	if tmpl.autoRemove {
+		fp.add("auto_remove", "true")
+	}
+
+	// only order of entrypoint and command arguments and of cache sources matters
+	for _, list := range []struct {
+		key    string
+		values []string
+		sorted bool
+	}{
+		{"entrypoint", tmpl.Entrypoint, false},
+		{"command", tmpl.Command, false},
+		{"cap_add", tmpl.Capabilities, true},
+		{"security_opt", tmpl.SecOpt, true},
+		{"env_file", tmpl.EnvFile, true},
+		{"volumes", tmpl.Volumes, true},
+		{"networks", tmpl.Networks, true},
+		{"devices", tmpl.Devices, true},
+		{"build.cache_from", tmpl.Build.CacheFrom, false},
+		{"build.extra_hosts", tmpl.Build.ExtraHosts, true},
+		{"build.platforms", tmpl.Build.Platforms, true},
+		{"build.ssh", tmpl.Build.SSH, true},
+	} {
+		values := list.values
+		if list.sorted {
+			values = slices.Sorted(slices.Values(values))
+		}
+
+		err := fp.addList(list.key, values)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return fp.sum(), nil
+}
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprintStable(t *testing.T) {
+	tmpl := &Template{
+		Image:       "alpine",
+		Command:     ShellCommand{"crond", "-f"},
+		Environment: StringMapOrArray{"B": "2", "A": "1"},
+		Volumes:     []string{"/b:/b", "/a:/a"},
+		Labels:      StringMapOrArray{"name": "example"},
+	}
+
+	hash, err := tmpl.Fingerprint("")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hash, fingerprintVersion+":"))
+
+	// changing this value recreates all backupers on upgrade, bump fingerprintVersion if it is intended
+	require.Equal(t, "v1:b0c78320058cff033399abdd065445e1c04277cb712b3a09bb228e56567d3425", hash)
+
+	reordered := &Template{
+		Labels:      StringMapOrArray{"name": "example"},
+		Volumes:     []string{"/a:/a", "/b:/b"},
+		Environment: StringMapOrArray{"A": "1", "B": "2"},
+		Command:     ShellCommand{"crond", "-f"},
+		Image:       "alpine",
+		// zero values are not a part of fingerprint
+		EnvFile:  StringOneOrArray{},
+		Networks: []string{},
+	}
+
+	reorderedHash, err := reordered.Fingerprint("")
+	require.NoError(t, err)
+	require.Equal(t, hash, reorderedHash)
+
+	withImage, err := tmpl.Fingerprint("sha256:1234")
+	require.NoError(t, err)
+	require.NotEqual(t, hash, withImage)
+
+	// present entry with empty value differs from missing one
+	tmpl.Environment["FOO"] = ""
+
+	withEmpty, err := tmpl.Fingerprint("")
+	require.NoError(t, err)
+	require.NotEqual(t, hash, withEmpty)
+
+	delete(tmpl.Environment, "FOO")
+
+	tmpl.Command = ShellCommand{"-f", "crond"}
+
+	changed, err := tmpl.Fingerprint("")
+	require.NoError(t, err)
+	require.NotEqual(t, hash, changed)
+}
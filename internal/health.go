@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	IssueMissingBackuper  = "missing_backuper"
+	IssueOrphanedBackuper = "orphaned_backuper"
+	IssueDriftedBackuper  = "drifted_backuper"
+	IssueStoppedBackuper  = "stopped_backuper"
+	IssueDuplicateName    = "duplicate_name"
+	IssueInvalidName      = "invalid_name"
+	IssueMissingTemplate  = "missing_template"
+	IssueOrphanedOneOff   = "orphaned_one_off"
+	IssueLeftoverOneOff   = "leftover_one_off"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+type HealthIssue struct {
+	Host     string `json:"host,omitempty" yaml:"host,omitempty"`
+	Kind     string `json:"kind" yaml:"kind"`
+	Severity string `json:"severity" yaml:"severity"`
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`
+	Message  string `json:"message" yaml:"message"`
+}
+
+type HealthReport struct {
+	Targets      int           `json:"targets" yaml:"targets"`
+	Backupers    int           `json:"backupers" yaml:"backupers"`
+	Restores     int           `json:"restores" yaml:"restores"`
+	ForceBackups int           `json:"force_backups" yaml:"force_backups"`
+	Issues       []HealthIssue `json:"issues" yaml:"issues"`
+}
+
+// Healthy reports if there are no issues with error severity
+func (report HealthReport) Healthy() bool {
+	return !slices.ContainsFunc(report.Issues, func(issue HealthIssue) bool {
+		return issue.Severity == SeverityError
+	})
+}
+
+func (report *HealthReport) add(kind, severity, name, format string, args ...any) {
+	report.Issues = append(report.Issues, HealthIssue{
+		Kind:     kind,
+		Severity: severity,
+		Name:     name,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Health cross-references containers labeled for backup with backup, restore and force-backup containers
+// and checks templates
+func (mngr *ContainerManager) Health(ctx context.Context) (HealthReport, error) {
+	report := HealthReport{Issues: []HealthIssue{}}
+
+	for _, i := range []struct {
+		name string
+		tmpl *Template
+	}{{TemplateBackup, mngr.tmpls.Backuper}, {TemplateRestore, mngr.tmpls.Restore}, {TemplateForceBackup, mngr.tmpls.ForceBackup}} {
+		severity := SeverityWarning
+		if i.name == TemplateBackup {
+			severity = SeverityError
+		}
+
+		if i.tmpl == nil {
+			report.add(IssueMissingTemplate, severity, "", "%s template is not set", i.name)
+		} else if len(i.tmpl.Image) == 0 && len(i.tmpl.Build.Context) == 0 {
+			report.add(IssueMissingTemplate, severity, "", "%s template has neither image nor build", i.name)
+		}
+	}
+
+	targets, err := mngr.containersGroupedByLabel(ctx, mngr.labels.backupName, &report)
+	if err != nil {
+		return HealthReport{}, err
+	}
+
+	backupers, err := mngr.containersGroupedByLabel(ctx, mngr.labels.backuperName, &report)
+	if err != nil {
+		return HealthReport{}, err
+	}
+
+	report.Targets = len(targets)
+	report.Backupers = len(backupers)
+
+	for _, name := range slices.Sorted(maps.Keys(targets)) {
+		target := targets[name]
+
+		if err := ValidateBackupName(name); err != nil {
+			report.add(IssueInvalidName, SeverityError, name, "%s: %s", containerName(target), err)
+			continue
+		}
+
+		backuper, ok := backupers[name]
+		if !ok {
+			report.add(IssueMissingBackuper, SeverityError, name, "%s has no backup container", containerName(target))
+			continue
+		}
+
+		if mngr.tmpls.Backuper != nil {
+			sync, err := mngr.backuperSync(ctx, target, backuper)
+			if err != nil {
+				return HealthReport{}, err
+			}
+
+			if sync == SyncDrifted {
+				report.add(IssueDriftedBackuper, SeverityError, name, "%s config differs from labels of %s and template", containerName(backuper), containerName(target))
+			}
+		}
+
+		if containerIsAlive(target) && !containerIsAlive(backuper) {
+			report.add(IssueStoppedBackuper, SeverityError, name, "%s is %s while %s is running", containerName(backuper), backuper.State, containerName(target))
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(backupers)) {
+		if _, ok := targets[name]; !ok {
+			report.add(IssueOrphanedBackuper, SeverityError, name, "%s has no container to backup", containerName(backupers[name]))
+		}
+	}
+
+	for _, i := range []struct {
+		label    string
+		template string
+		count    *int
+	}{{mngr.labels.restore, TemplateRestore, &report.Restores}, {mngr.labels.forceBackup, TemplateForceBackup, &report.ForceBackups}} {
+		oneOffs, err := mngr.listContainersWithLabel(ctx, i.label, true)
+		if err != nil {
+			return HealthReport{}, err
+		}
+
+		*i.count = len(oneOffs)
+
+		for _, oneOff := range oneOffs {
+			name := getContainerLabel(&oneOff, i.label)
+
+			if _, ok := targets[name]; !ok {
+				report.add(IssueOrphanedOneOff, SeverityWarning, name, "%s container %s has no container to backup", i.template, containerName(&oneOff))
+			}
+
+			// one-off containers are autoremoved, so stopped one is left from failed run
+			if !containerIsAlive(&oneOff) {
+				report.add(IssueLeftoverOneOff, SeverityWarning, name, "%s container %s is %s and was not removed", i.template, containerName(&oneOff), oneOff.State)
+			}
+		}
+	}
+
+	for i := range report.Issues {
+		report.Issues[i].Host = mngr.host
+	}
+
+	return report, nil
+}
+
+// containersGroupedByLabel indexes all containers with label by its value and reports duplicated values
+func (mngr *ContainerManager) containersGroupedByLabel(ctx context.Context, label string, report *HealthReport) (map[string]*types.Container, error) {
+	cntrs, err := mngr.listContainersWithLabel(ctx, label, true)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string][]*types.Container{}
+
+	for i := range cntrs {
+		value := mngr.nameFromLabel(&cntrs[i], label)
+		groups[value] = append(groups[value], &cntrs[i])
+	}
+
+	byValue := map[string]*types.Container{}
+
+	for _, value := range slices.Sorted(maps.Keys(groups)) {
+		group := groups[value]
+
+		if len(group) > 1 {
+			names := []string{}
+			for _, cntr := range group {
+				names = append(names, containerName(cntr))
+			}
+
+			report.add(IssueDuplicateName, SeverityError, value, "label %s=%s is set on %d containers: %s", label, value, len(group), strings.Join(names, ", "))
+		}
+
+		byValue[value] = group[0]
+	}
+
+	return byValue, nil
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (tm *testMngr) expectOneOffList(label string, cntrs []types.Container) {
+	tm.docker.EXPECT().ContainerList(mock.Anything, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.KeyValuePair{Key: "label", Value: label}),
+	}).Return(cntrs, nil).Once()
+}
+
+func TestHealthy(t *testing.T) {
+	tm := newTestMngr(t, []string{"example"}, []string{"example"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	tm.expectOneOffList(tm.mngr.labels.restore, nil)
+	tm.expectOneOffList(tm.mngr.labels.forceBackup, nil)
+
+	report, err := tm.mngr.Health(context.Background())
+	require.NoError(t, err)
+	require.True(t, report.Healthy())
+	require.Empty(t, report.Issues)
+	require.Equal(t, 1, report.Targets)
+	require.Equal(t, 1, report.Backupers)
+}
+
+func TestHealthIssues(t *testing.T) {
+	tm := newTestMngr(t, []string{"stopped", "missing", "drifted", "bad name"}, []string{"stopped", "drifted", "orphaned"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	tm.mngr.tmpls.Restore = nil
+
+	stoppedTarget := tm.liveBackupCntrs["stopped"]
+	stoppedTarget.State = ContainerStatusRunning
+	tm.liveBackupCntrs["stopped"] = stoppedTarget
+
+	stopped := tm.liveBackupers["stopped"]
+	stopped.State = "exited"
+	tm.liveBackupers["stopped"] = stopped
+
+	drifted := tm.liveBackupers["drifted"]
+	drifted.Labels[tm.mngr.labels.backuperConsistencyHash] = "stale"
+	tm.liveBackupers["drifted"] = drifted
+
+	duplicate := genBackupCntr(tm.mngr, "missing")
+	duplicate.ID = "duplicateid"
+	tm.stoppedBackupCntrs["duplicate"] = duplicate
+
+	tm.resetExpectCallList()
+	tm.expectCntrList()
+
+	tm.expectOneOffList(tm.mngr.labels.restore, nil)
+	tm.expectOneOffList(tm.mngr.labels.forceBackup, []types.Container{{
+		ID:     "forceid",
+		State:  "exited",
+		Labels: map[string]string{tm.mngr.labels.forceBackup: "drifted"},
+	}})
+
+	report, err := tm.mngr.Health(context.Background())
+	require.NoError(t, err)
+	require.False(t, report.Healthy())
+
+	kinds := map[string]string{}
+	for _, issue := range report.Issues {
+		kinds[issue.Kind] = issue.Name
+	}
+
+	require.Equal(t, map[string]string{
+		IssueMissingTemplate:  "",
+		IssueDuplicateName:    "missing",
+		IssueInvalidName:      "bad name",
+		IssueMissingBackuper:  "missing",
+		IssueDriftedBackuper:  "drifted",
+		IssueStoppedBackuper:  "stopped",
+		IssueOrphanedBackuper: "orphaned",
+		IssueLeftoverOneOff:   "drifted",
+	}, kinds)
+}
@@ -35,6 +35,9 @@ type testMngr struct {
 	stoppedBackupers   map[string]types.Container
 	stoppedBackupCntrs map[string]types.Container
 
+	// ids of containers running with tty
+	ttyCntrs map[string]bool
+
 	listCalls []CallUnsetter
 
 	eventsChan chan events.Message
@@ -51,16 +54,17 @@ func genBackupCntr(mngr *ContainerManager, name string) types.Container {
 	}
 }
 
-func genOnlineBackuper(mngr *ContainerManager, name string) types.Container {
+func genOnlineBackuper(t *testing.T, mngr *ContainerManager, name string) types.Container {
 	tmpl := mngr.tmpls.Backuper.Overlay(&Template{
 		Labels:  map[string]string{mngr.labels.backuperName: name},
 		Volumes: []string{"/data:/data:ro"},
 	})
-	hash := tmpl.Hash()
+	hash, err := tmpl.Fingerprint("")
+	require.NoError(t, err)
 
 	return types.Container{
-		ID:     "backuperid" + name,
-		Status: ContainerStatusRunning,
+		ID:    "backuperid" + name,
+		State: ContainerStatusRunning,
 		Labels: map[string]string{
 			mngr.labels.backuperName:            name,
 			mngr.labels.backuperConsistencyHash: hash,
@@ -74,6 +78,9 @@ func newTestMngr(t *testing.T, backupCntrs []string, backupers []string, tmpls U
 	err := env.ParseWithOptions(&cfg, env.Options{Environment: map[string]string{}})
 	require.NoError(t, err)
 
+	// engine is not detected, podman tests set it explicitly
+	cfg.Engine = EngineDocker
+
 	docker := mocks.NewDockerApi(t)
 
 	if tmpls.Backuper == nil {
@@ -99,14 +106,19 @@ func newTestMngr(t *testing.T, backupCntrs []string, backupers []string, tmpls U
 		liveBackupCntrs:    make(map[string]types.Container),
 		stoppedBackupers:   make(map[string]types.Container),
 		stoppedBackupCntrs: make(map[string]types.Container),
+		ttyCntrs:           make(map[string]bool),
 	}
 
+	docker.EXPECT().ContainerInspect(mock.Anything, mock.Anything).RunAndReturn(func(_ context.Context, cntrId string) (types.ContainerJSON, error) {
+		return types.ContainerJSON{Config: &container.Config{Tty: tst.ttyCntrs[cntrId]}}, nil
+	}).Maybe()
+
 	for _, name := range backupCntrs {
 		tst.liveBackupCntrs[name] = genBackupCntr(mngr, name)
 	}
 
 	for _, name := range backupers {
-		tst.liveBackupers[name] = genOnlineBackuper(mngr, name)
+		tst.liveBackupers[name] = genOnlineBackuper(t, mngr, name)
 	}
 
 	tst.expectCntrList()
@@ -261,7 +273,7 @@ func (tm *testMngr) startBackupCntr(name string) {
 	tm.expectCntrList()
 
 	tm.eventsChan <- events.Message{
-		Action: events.ActionStart,
+		Action: events.ActionCreate,
 		Actor: events.Actor{
 			Attributes: map[string]string{tm.mngr.labels.backupName: name},
 		},
@@ -275,7 +287,7 @@ func (tm *testMngr) removeBackupCntr(name string) {
 	tm.expectCntrList()
 
 	tm.eventsChan <- events.Message{
-		Action: events.ActionDie,
+		Action: events.ActionDestroy,
 		Actor: events.Actor{
 			Attributes: map[string]string{tm.mngr.labels.backupName: name},
 		},
@@ -301,7 +313,8 @@ func (tm *testMngr) expectBackuperCreateAndStart(t *testing.T, name string, labe
 			Volumes: []string{"/data:/data:ro"},
 		})
 	}
-	hash := tmpl.Hash()
+	hash, err := tmpl.Fingerprint("")
+	require.NoError(t, err)
 
 	_, cntrCfg, hstCfg, netCfg, err := tmpl.CreateConfig(tm.mngr.conf.BackupTag)
 	require.NoError(t, err)
@@ -382,4 +395,30 @@ func (tm *testMngr) expectRestoreCreateAndStart(t *testing.T, name string) {
 
 	tm.docker.EXPECT().ContainerCreate(mock.Anything, cntrCfg, hstCfg, netCfg, mock.Anything, fmt.Sprintf("docker-backup-maestro.restore_%s", name)).Return(container.CreateResponse{ID: "restoreid" + name}, nil).Once()
 	tm.docker.EXPECT().ContainerStart(mock.Anything, "restoreid"+name, mock.Anything).Return(nil).Once()
+	tm.docker.EXPECT().ContainerLogs(mock.Anything, "restoreid"+name, mock.Anything).Return(io.NopCloser(strings.NewReader("")), nil).Once()
+}
+
+func (tm *testMngr) expectContainerEvents(action events.Action) (chan events.Message, chan error) {
+	eventsChan := make(chan events.Message)
+	errChan := make(chan error)
+
+	tm.docker.EXPECT().Events(mock.Anything, mock.MatchedBy(func(opts events.ListOptions) bool {
+		return opts.Filters.ExactMatch("event", string(action))
+	})).Return(eventsChan, errChan).Once()
+
+	return eventsChan, errChan
+}
+
+// expectForceBackupRun expects force-backup container to be created and started, and exit with exitCode right away
+func (tm *testMngr) expectForceBackupRun(name string, exitCode string) {
+	tm.docker.EXPECT().ContainerCreate(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, fmt.Sprintf("docker-backup-maestro.forcebackup_%s", name)).Return(container.CreateResponse{ID: "forceid" + name}, nil).Once()
+	tm.docker.EXPECT().ContainerLogs(mock.Anything, "forceid"+name, mock.Anything).Return(io.NopCloser(strings.NewReader("")), nil).Once()
+
+	dieChan, _ := tm.expectContainerEvents(events.ActionDie)
+
+	tm.docker.EXPECT().ContainerStart(mock.Anything, "forceid"+name, mock.Anything).Run(func(_ context.Context, _ string, _ container.StartOptions) {
+		go func() {
+			dieChan <- events.Message{Actor: events.Actor{Attributes: map[string]string{"exitCode": exitCode}}}
+		}()
+	}).Return(nil).Once()
 }
@@ -0,0 +1,202 @@
+package internal
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/docker/cli/cli/connhelper"
+	"github.com/docker/docker/client"
+	"gopkg.in/yaml.v2"
+)
+
+// HostConfig is docker endpoint listed in HOSTS_PATH file. Every host is managed by its own ContainerManager
+type HostConfig struct {
+	Name string `yaml:"name"`
+	// unix://, tcp:// or ssh:// address, DOCKER_HOST is used if empty
+	Host string `yaml:"host"`
+	// dir with ca.pem, cert.pem and key.pem for tcp host, same as DOCKER_CERT_PATH
+	TLSCertPath string `yaml:"tls_cert_path"`
+
+	LabelPrefix         string `yaml:"label_prefix"`
+	BackupTemplate      string `yaml:"backup_template"`
+	RestoreTemplate     string `yaml:"restore_template"`
+	ForceBackupTemplate string `yaml:"forcebackup_template"`
+
+	// maestro env vars overridden for this host
+	Env map[string]string `yaml:"env"`
+}
+
+type hostsFile struct {
+	Hosts []HostConfig `yaml:"hosts"`
+}
+
+var hostNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// ReadHostsFromFile reads docker hosts managed by maestro. Host names must be unique
+func ReadHostsFromFile(path string) ([]HostConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("hosts file '%s' read failed: %w", path, err)
+	}
+
+	var file hostsFile
+
+	err = yaml.UnmarshalStrict([]byte(os.ExpandEnv(string(data))), &file)
+	if err != nil {
+		return nil, fmt.Errorf("hosts file '%s' parsing failed: %w", path, err)
+	}
+
+	if len(file.Hosts) == 0 {
+		return nil, fmt.Errorf("hosts file '%s' has no hosts", path)
+	}
+
+	names := map[string]bool{}
+
+	for _, host := range file.Hosts {
+		if !hostNameRegex.MatchString(host.Name) {
+			return nil, fmt.Errorf("hosts file '%s': invalid host name '%s', must contain only letters, digits and - _ .", path, host.Name)
+		}
+
+		if names[host.Name] {
+			return nil, fmt.Errorf("hosts file '%s': host name '%s' is not unique", path, host.Name)
+		}
+
+		names[host.Name] = true
+	}
+
+	return file.Hosts, nil
+}
+
+// config is maestro config of host: env vars overlaid with host settings. Formats and tags derived
+// from LABEL_PREFIX follow label prefix of host, state of every host is kept in its own file
+func (host HostConfig) config(environ []string) (Config, error) {
+	vars := env.ToMap(environ)
+
+	for key, val := range map[string]string{
+		"LABEL_PREFIX":          host.LabelPrefix,
+		"BACKUP_TMPL_PATH":      host.BackupTemplate,
+		"RESTORE_TMPL_PATH":     host.RestoreTemplate,
+		"FORCEBACKUP_TMPL_PATH": host.ForceBackupTemplate,
+	} {
+		if len(val) > 0 {
+			vars[key] = val
+		}
+	}
+
+	maps.Copy(vars, host.Env)
+
+	var cfg Config
+
+	err := env.ParseWithOptions(&cfg, env.Options{Environment: vars})
+	if err != nil {
+		return Config{}, fmt.Errorf("host %s: failed to set config - %w", host.Name, err)
+	}
+
+	if _, ok := host.Env["STATE_PATH"]; !ok && len(cfg.StatePath) > 0 {
+		cfg.StatePath = hostStatePath(cfg.StatePath, host.Name)
+	}
+
+	return cfg, nil
+}
+
+// hostStatePath inserts host name before extension: /data/state.json -> /data/state.prod.json
+func hostStatePath(path string, name string) string {
+	ext := filepath.Ext(path)
+
+	return strings.TrimSuffix(path, ext) + "." + name + ext
+}
+
+// dockerClientOpts returns docker client options connecting to host
+func (host HostConfig) dockerClientOpts() ([]client.Opt, error) {
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+
+	if len(host.Host) == 0 {
+		return opts, nil
+	}
+
+	if strings.HasPrefix(host.Host, "ssh://") {
+		// docker cli of remote host proxies api over ssh, same as docker -H ssh://
+		helper, err := connhelper.GetConnectionHelper(host.Host)
+		if err != nil {
+			return nil, fmt.Errorf("host %s: invalid ssh address - %w", host.Name, err)
+		}
+
+		return append(opts, client.WithHost(helper.Host), client.WithDialContext(helper.Dialer)), nil
+	}
+
+	opts = append(opts, client.WithHost(host.Host))
+
+	if len(host.TLSCertPath) > 0 {
+		opts = append(opts, client.WithTLSClientConfig(
+			filepath.Join(host.TLSCertPath, "ca.pem"),
+			filepath.Join(host.TLSCertPath, "cert.pem"),
+			filepath.Join(host.TLSCertPath, "key.pem"),
+		))
+	}
+
+	return opts, nil
+}
+
+// hostNames returns names of hosts managed by maestro, empty if maestro manages single host
+func hostNames(mngrs []*ContainerManager) []string {
+	names := []string{}
+
+	for _, mngr := range mngrs {
+		if len(mngr.host) > 0 {
+			names = append(names, mngr.host)
+		}
+	}
+
+	return names
+}
+
+// selectHosts returns manager of named host, or all managers if name is empty
+func selectHosts(mngrs []*ContainerManager, name string) ([]*ContainerManager, error) {
+	if len(name) == 0 {
+		return mngrs, nil
+	}
+
+	idx := slices.IndexFunc(mngrs, func(mngr *ContainerManager) bool {
+		return mngr.host == name
+	})
+
+	if idx < 0 {
+		if len(hostNames(mngrs)) == 0 {
+			return nil, fmt.Errorf("unknown host '%s', maestro manages single host (HOSTS_PATH is not set)", name)
+		}
+
+		return nil, fmt.Errorf("unknown host '%s', must be one of %s", name, strings.Join(hostNames(mngrs), ", "))
+	}
+
+	return mngrs[idx : idx+1], nil
+}
+
+// hostError prefixes error with host name if maestro manages several hosts
+func hostError(mngr *ContainerManager, err error) error {
+	if err == nil || len(mngr.host) == 0 {
+		return err
+	}
+
+	return fmt.Errorf("host %s: %w", mngr.host, err)
+}
+
+// mergeHealth sums reports of several hosts
+func mergeHealth(reports []HealthReport) HealthReport {
+	merged := HealthReport{Issues: []HealthIssue{}}
+
+	for _, report := range reports {
+		merged.Targets += report.Targets
+		merged.Backupers += report.Backupers
+		merged.Restores += report.Restores
+		merged.ForceBackups += report.ForceBackups
+		merged.Issues = append(merged.Issues, report.Issues...)
+	}
+
+	return merged
+}
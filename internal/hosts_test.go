@@ -0,0 +1,247 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func writeHostsFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "hosts.yml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestReadHostsFromFile(t *testing.T) {
+	path := writeHostsFile(t, `
+hosts:
+  - name: local
+  - name: prod
+    host: tcp://10.0.0.1:2376
+    tls_cert_path: /certs/prod
+    label_prefix: prod-maestro
+    backup_template: /root/prod/backup_tmpl.yml
+    env:
+      BUILD_PARALLELISM: "4"
+  - name: edge
+    host: ssh://maestro@edge.example.com
+`)
+
+	hosts, err := ReadHostsFromFile(path)
+	require.NoError(t, err)
+	require.Len(t, hosts, 3)
+	require.Equal(t, HostConfig{
+		Name:           "prod",
+		Host:           "tcp://10.0.0.1:2376",
+		TLSCertPath:    "/certs/prod",
+		LabelPrefix:    "prod-maestro",
+		BackupTemplate: "/root/prod/backup_tmpl.yml",
+		Env:            map[string]string{"BUILD_PARALLELISM": "4"},
+	}, hosts[1])
+
+	for name, content := range map[string]string{
+		"no hosts":      "hosts: []",
+		"no name":       "hosts: [{host: tcp://10.0.0.1:2376}]",
+		"invalid name":  "hosts: [{name: 'prod/1'}]",
+		"duplicate":     "hosts: [{name: prod}, {name: prod}]",
+		"unknown field": "hosts: [{name: prod, adress: tcp://10.0.0.1:2376}]",
+	} {
+		_, err := ReadHostsFromFile(writeHostsFile(t, content))
+		require.Error(t, err, name)
+	}
+}
+
+func TestHostConfig(t *testing.T) {
+	environ := []string{"STATE_PATH=/data/state.json", "NAME_SANITIZE=true", "BUILD_PARALLELISM=2"}
+
+	cfg, err := HostConfig{
+		Name:        "prod",
+		LabelPrefix: "prod-maestro",
+		Env:         map[string]string{"BUILD_PARALLELISM": "4"},
+	}.config(environ)
+	require.NoError(t, err)
+
+	// values derived from label prefix follow prefix of host
+	require.Equal(t, "prod-maestro", cfg.LabelPrefix)
+	require.Equal(t, "prod-maestro.backup_{name}", cfg.BackupNameFormat)
+	require.Equal(t, "prod-maestro.backup", cfg.BackupTag)
+
+	require.True(t, cfg.NameSanitize)
+	require.Equal(t, 4, cfg.BuildParallelism)
+	require.Equal(t, "/data/state.prod.json", cfg.StatePath)
+
+	// state path set for host is used as is
+	cfg, err = HostConfig{Name: "prod", Env: map[string]string{"STATE_PATH": "/data/prod.json"}}.config(environ)
+	require.NoError(t, err)
+	require.Equal(t, "/data/prod.json", cfg.StatePath)
+	require.Equal(t, "docker-backup-maestro.backup_{name}", cfg.BackupNameFormat)
+
+	_, err = HostConfig{Name: "prod", Env: map[string]string{"BUILD_PARALLELISM": "many"}}.config(environ)
+	require.ErrorContains(t, err, "host prod")
+}
+
+func TestHostDockerClient(t *testing.T) {
+	for _, tc := range []struct {
+		host   HostConfig
+		daemon string
+	}{
+		{HostConfig{Name: "unix", Host: "unix:///var/run/docker.sock"}, "unix:///var/run/docker.sock"},
+		{HostConfig{Name: "tcp", Host: "tcp://10.0.0.1:2375"}, "tcp://10.0.0.1:2375"},
+		// connection is proxied over ssh, address is placeholder
+		{HostConfig{Name: "ssh", Host: "ssh://maestro@edge.example.com"}, "http://docker.example.com"},
+	} {
+		opts, err := tc.host.dockerClientOpts()
+		require.NoError(t, err, tc.host.Name)
+
+		cli, err := client.NewClientWithOpts(opts...)
+		require.NoError(t, err, tc.host.Name)
+		require.Equal(t, tc.daemon, cli.DaemonHost(), tc.host.Name)
+	}
+
+	opts, err := HostConfig{Name: "tls", Host: "tcp://10.0.0.1:2376", TLSCertPath: t.TempDir()}.dockerClientOpts()
+	require.NoError(t, err)
+
+	// certificates are read when client is created
+	_, err = client.NewClientWithOpts(opts...)
+	require.ErrorContains(t, err, "ca.pem")
+}
+
+func TestSelectHosts(t *testing.T) {
+	single := []*ContainerManager{{}}
+
+	mngrs, err := selectHosts(single, "")
+	require.NoError(t, err)
+	require.Len(t, mngrs, 1)
+
+	_, err = selectHosts(single, "prod")
+	require.ErrorContains(t, err, "HOSTS_PATH")
+
+	several := []*ContainerManager{{host: "local"}, {host: "prod"}}
+
+	mngrs, err = selectHosts(several, "prod")
+	require.NoError(t, err)
+	require.Equal(t, []*ContainerManager{several[1]}, mngrs)
+
+	mngrs, err = selectHosts(several, "")
+	require.NoError(t, err)
+	require.Len(t, mngrs, 2)
+
+	_, err = selectHosts(several, "edge")
+	require.ErrorContains(t, err, "must be one of local, prod")
+}
+
+func TestControlServerHosts(t *testing.T) {
+	local := newTestMngr(t, []string{"app"}, []string{"app"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	local.mngr.host = "local"
+
+	prod := newTestMngr(t, []string{"db"}, []string{"db"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	prod.mngr.host = "prod"
+
+	socketPath := filepath.Join(t.TempDir(), "maestro.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	served := make(chan error)
+	go func() {
+		served <- NewControlServer(local.mngr, prod.mngr).Serve(ctx, socketPath, "")
+	}()
+
+	client := NewControlClient(socketPath)
+
+	require.Eventually(t, func() bool {
+		return client.ForHost("local").Available(ctx)
+	}, time.Second, 10*time.Millisecond)
+
+	// reads without host are merged
+	entries, err := client.List(ctx, ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "local", entries[0].Host)
+	require.Equal(t, "app", entries[0].Name)
+	require.Equal(t, "prod", entries[1].Host)
+	require.Equal(t, "db", entries[1].Name)
+
+	entries, err = client.ForHost("prod").List(ctx, ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "db", entries[0].Name)
+
+	for _, tm := range []testMngr{local, prod} {
+		tm.expectOneOffList(tm.mngr.labels.restore, nil)
+		tm.expectOneOffList(tm.mngr.labels.forceBackup, nil)
+	}
+
+	report, err := client.Health(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Targets)
+	require.Equal(t, 2, report.Backupers)
+
+	// actions need host
+	require.ErrorContains(t, client.Reconcile(ctx), "host is required")
+	require.ErrorContains(t, client.ForHost("edge").Reconcile(ctx), "unknown host 'edge'")
+	require.NoError(t, client.ForHost("prod").Reconcile(ctx))
+
+	_, err = client.StartJob(ctx, JobRequest{Type: JobTypeRestore, Name: "db"})
+	require.ErrorContains(t, err, "host is required")
+
+	rec := httptest.NewRecorder()
+	metricsHandler([]*ContainerManager{local.mngr, prod.mngr}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Contains(t, rec.Body.String(), `maestro_managed_targets{host="local"} 1`)
+	require.Contains(t, rec.Body.String(), `maestro_managed_targets{host="prod"} 1`)
+
+	cancel()
+	require.NoError(t, <-served)
+}
+
+func TestRunHostsRetry(t *testing.T) {
+	local := newTestMngr(t, []string{"app"}, []string{"app"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	local.mngr.host = "local"
+	local.expectListenEvents()
+
+	prod := newTestMngr(t, []string{"db"}, []string{"db"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	prod.mngr.host = "prod"
+
+	// first reconcile of prod fails, must be set before default expectations to take precedence
+	prod.resetExpectCallList()
+	prod.docker.EXPECT().ContainerList(mock.Anything, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.KeyValuePair{Key: "label", Value: prod.mngr.labels.backuperName}),
+	}).Return(nil, errors.New("docker is down")).Once()
+	prod.expectCntrList()
+
+	prod.docker.EXPECT().Events(mock.Anything, mock.Anything).Return(make(chan events.Message), make(chan error)).Times(2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- runHosts(ctx, []*ContainerManager{local.mngr, prod.mngr}, 10*time.Millisecond)
+	}()
+
+	// failed host is run again, other host keeps running
+	require.Eventually(t, func() bool {
+		status := prod.mngr.Status()
+		return status.LastReconcile != nil && len(status.LastReconcileError) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	require.Empty(t, done)
+	require.NotNil(t, local.mngr.Status().LastReconcile)
+
+	cancel()
+	require.NoError(t, <-done)
+}
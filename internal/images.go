@@ -0,0 +1,277 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/image"
+)
+
+const RecreateReasonImageChanged = "image_changed"
+
+// image with daily pull policy is pulled again if it was pulled earlier than this
+const dailyPullInterval = 24 * time.Hour
+
+// ensureImage builds or pulls image of container config according to pull policy
+func (mngr *ContainerManager) ensureImage(ctx context.Context, buildInfo *BuildInfo, tag string, policy string) error {
+	if buildInfo != nil {
+		return mngr.buildImages(ctx, []buildTarget{{tag: tag, info: buildInfo}}, policy)
+	}
+
+	return mngr.pullImage(ctx, tag, policy)
+}
+
+// withDefaultTag adds latest tag to image without tag or digest. Image is returned in familiar form,
+// the same docker lists it in RepoTags, e.g. alpine:latest or registry:5000/backup:latest
+func withDefaultTag(tag string) string {
+	named, err := reference.ParseNormalizedNamed(tag)
+	if err != nil {
+		// invalid reference is left for docker to report
+		return tag
+	}
+
+	return reference.FamiliarString(reference.TagNameOnly(named))
+}
+
+// forcedPullPolicy is used by explicit pull and update-images commands: image is pulled
+// even if it is present, unless template forbids to pull it
+func forcedPullPolicy(tmpl *Template) (string, error) {
+	policy, err := tmpl.ImagePullPolicy()
+	if err != nil {
+		return "", err
+	}
+
+	if policy == PullNever {
+		return PullNever, nil
+	}
+
+	return PullAlways, nil
+}
+
+// localImage returns local image with tag, nil if there is no such image
+func (mngr *ContainerManager) localImage(ctx context.Context, tag string) (*image.Summary, error) {
+	tag = withDefaultTag(tag)
+
+	localImages, err := mngr.docker.ImageList(ctx, image.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("image list failed: %w", err)
+	}
+
+	for _, localImg := range localImages {
+		for _, localTag := range localImg.RepoTags {
+			if withDefaultTag(localTag) == tag {
+				return &localImg, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// localImageId returns id of local image with tag, empty if there is no such image
+func (mngr *ContainerManager) localImageId(ctx context.Context, tag string) (string, error) {
+	localImg, err := mngr.localImage(ctx, tag)
+	if err != nil || localImg == nil {
+		return "", err
+	}
+
+	return localImg.ID, nil
+}
+
+func (mngr *ContainerManager) recordPull(tag string, at time.Time) {
+	mngr.pullsMu.Lock()
+	defer mngr.pullsMu.Unlock()
+
+	mngr.lastPulls[tag] = at
+}
+
+// pulledSince reports if image was pulled after given time. Pulls of this maestro process are remembered,
+// other pulls are known by time image was last tagged, as tag is moved when pull brings new image
+func (mngr *ContainerManager) pulledSince(ctx context.Context, tag string, imageId string, since time.Time) (bool, error) {
+	mngr.pullsMu.Lock()
+	at, ok := mngr.lastPulls[tag]
+	mngr.pullsMu.Unlock()
+
+	if ok && at.After(since) {
+		return true, nil
+	}
+
+	inspect, _, err := mngr.docker.ImageInspectWithRaw(ctx, imageId)
+	if err != nil {
+		return false, fmt.Errorf("image inspect of %s failed: %w", tag, err)
+	}
+
+	return inspect.Metadata.LastTagTime.After(since), nil
+}
+
+// backuperFingerprint returns fingerprint of backuper config. If FINGERPRINT_IMAGE is on,
+// id of local backuper image is a part of fingerprint and is returned as well
+func (mngr *ContainerManager) backuperFingerprint(ctx context.Context, cfg *Template) (string, string, error) {
+	var imageId string
+
+	if mngr.conf.FingerprintImage {
+		_, cntrCfg, _, _, err := cfg.CreateConfig(mngr.conf.BackupTag)
+		if err != nil {
+			return "", "", err
+		}
+
+		imageId, err = mngr.localImageId(ctx, cntrCfg.Image)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	hash, err := cfg.Fingerprint(imageId)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fingerprint backup container config - %w", err)
+	}
+
+	return hash, imageId, nil
+}
+
+// UpdateImages pulls or builds images of all templates and recreates backupers
+// running image other than current local image of backup template
+func (mngr *ContainerManager) UpdateImages(ctx context.Context) error {
+	updated := map[string]bool{}
+
+	// builds are made together, so shared dependent builds are built once
+	builds := map[string][]buildTarget{}
+
+	for _, i := range []struct {
+		tmpl *Template
+		tag  string
+	}{{mngr.tmpls.Backuper, mngr.conf.BackupTag}, {mngr.tmpls.Restore, mngr.conf.RestoreTag}, {mngr.tmpls.ForceBackup, mngr.conf.ForceTag}} {
+		if i.tmpl == nil {
+			continue
+		}
+
+		bInfo, cntrCfg, _, _, err := i.tmpl.CreateConfig(i.tag)
+		if err != nil {
+			return err
+		}
+
+		// restore and force-backup templates usually share image with backup template
+		if updated[cntrCfg.Image] {
+			continue
+		}
+
+		policy, err := forcedPullPolicy(i.tmpl)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("updating image", logKeyAction, "update", logKeyImage, cntrCfg.Image)
+
+		updated[cntrCfg.Image] = true
+
+		if bInfo != nil {
+			builds[policy] = append(builds[policy], buildTarget{tag: cntrCfg.Image, info: bInfo})
+			continue
+		}
+
+		err = mngr.pullImage(ctx, cntrCfg.Image, policy)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, policy := range slices.Sorted(maps.Keys(builds)) {
+		err := mngr.buildImages(ctx, builds[policy], policy)
+		if err != nil {
+			return err
+		}
+	}
+
+	// images are updated without lock, so docker events are handled meanwhile
+	return mngr.withLifecycleLock(func() error {
+		return mngr.rollBackupers(ctx)
+	})
+}
+
+// rollBackupers recreates backupers created from image other than current local image. Must be called
+// with lifecycle lock held
+func (mngr *ContainerManager) rollBackupers(ctx context.Context) error {
+	_, cntrCfg, _, _, err := mngr.tmpls.Backuper.CreateConfig(mngr.conf.BackupTag)
+	if err != nil {
+		return err
+	}
+
+	imageId, err := mngr.localImageId(ctx, cntrCfg.Image)
+	if err != nil {
+		return err
+	}
+
+	if len(imageId) == 0 {
+		return fmt.Errorf("backup image %s not found", cntrCfg.Image)
+	}
+
+	backupers, err := mngr.listContainersWithLabel(ctx, mngr.labels.backuperName, true)
+	if err != nil {
+		return err
+	}
+
+	for _, backuper := range backupers {
+		name := getContainerLabel(&backuper, mngr.labels.backuperName)
+
+		if backuper.ImageID == imageId {
+			slog.Info("backup container image is up to date", logKeyBackupName, name, logKeyContainerId, backuper.ID)
+			continue
+		}
+
+		// backuper is stopped by restore or force-backup, it is recreated by next update
+		if mngr.oneOffs[name] {
+			slog.Info("one-off container is running, backup container is left as is", logKeyBackupName, name, logKeyContainerId, backuper.ID)
+			continue
+		}
+
+		target, err := mngr.getTargetByName(ctx, name, true)
+
+		// duplicate must not stop update of other backupers, it is reported and skipped until resolved
+		var dupErr *duplicateLabelError
+		if errors.As(err, &dupErr) && dupErr.label == mngr.labels.backupName {
+			mngr.reportDuplicateName(dupErr.value, dupErr.cntrs)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// orphaned backuper is dropped by reconcile
+		if target == nil {
+			continue
+		}
+
+		err = mngr.recreateBackuper(ctx, name, backuper.ID, RecreateReasonImageChanged)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runImageUpdates updates images and rolls backupers every interval until ctx is done
+func (mngr *ContainerManager) runImageUpdates(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := mngr.UpdateImages(ctx)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("periodic image update failed", logKeyError, err)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func (tm *testMngr) expectLocalImage(tag, id string) {
+	tm.docker.EXPECT().ImageList(mock.Anything, mock.Anything).Return([]image.Summary{{ID: id, RepoTags: []string{tag}}}, nil)
+}
+
+func TestUpdateImages(t *testing.T) {
+	tm := newTestMngr(t, []string{"example", "example2"}, []string{"example", "example2"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	for name, id := range map[string]string{"example": "sha256:old", "example2": "sha256:new"} {
+		backuper := tm.liveBackupers[name]
+		backuper.ImageID = id
+		tm.liveBackupers[name] = backuper
+	}
+
+	tm.resetExpectCallList()
+	tm.expectCntrList()
+
+	// restore and force-backup templates share image with backup template, so it is pulled once
+	tm.expectPull("alpine:latest")
+	tm.expectLocalImage("alpine:latest", "sha256:new")
+
+	// only backuper with outdated image is recreated
+	tm.expectBackuperRemove("example")
+	tm.expectBackuperCreateAndStart(t, "example", nil, nil)
+
+	require.NoError(t, tm.mngr.UpdateImages(context.Background()))
+
+	require.Equal(t, 1.0, testutil.ToFloat64(tm.mngr.metrics.recreations.WithLabelValues(RecreateReasonImageChanged)))
+}
+
+func TestUpdateImagesDuringOneOff(t *testing.T) {
+	tm := newTestMngr(t, []string{"example"}, []string{"example"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	backuper := tm.liveBackupers["example"]
+	backuper.ImageID = "sha256:old"
+	tm.liveBackupers["example"] = backuper
+
+	tm.resetExpectCallList()
+	tm.expectCntrList()
+
+	tm.expectPull("alpine:latest")
+	tm.expectLocalImage("alpine:latest", "sha256:new")
+
+	// backuper is stopped by restore, so it is not recreated and started in the middle of it
+	tm.mngr.oneOffs["example"] = true
+
+	require.NoError(t, tm.mngr.UpdateImages(context.Background()))
+
+	tm.docker.AssertNotCalled(t, "ContainerRemove", mock.Anything, "backuperidexample", mock.Anything)
+	require.Zero(t, testutil.ToFloat64(tm.mngr.metrics.recreations.WithLabelValues(RecreateReasonImageChanged)))
+}
+
+func TestUpdateImagesDuplicateName(t *testing.T) {
+	tm := newTestMngr(t, []string{"example", "example2"}, []string{"example", "example2"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	for _, name := range []string{"example", "example2"} {
+		backuper := tm.liveBackupers[name]
+		backuper.ImageID = "sha256:old"
+		tm.liveBackupers[name] = backuper
+	}
+
+	// with sanitizing targets are looked up in list of all containers, so duplicate is found
+	// whatever order backupers are rolled in
+	tm.mngr.conf.NameSanitize = true
+
+	dup := genBackupCntr(tm.mngr, "example")
+	dup.ID = "backupidexampledup"
+	tm.stoppedBackupCntrs["exampledup"] = dup
+
+	tm.resetExpectCallList()
+	tm.expectCntrList()
+
+	tm.expectPull("alpine:latest")
+	tm.expectLocalImage("alpine:latest", "sha256:new")
+
+	// duplicate is skipped, other backuper is still updated
+	tm.expectBackuperRemove("example2")
+	tm.expectBackuperCreateAndStart(t, "example2", nil, nil)
+
+	require.NoError(t, tm.mngr.UpdateImages(context.Background()))
+	require.True(t, tm.mngr.duplicates["example"])
+}
+
+func TestWithDefaultTag(t *testing.T) {
+	for tag, want := range map[string]string{
+		"alpine":                          "alpine:latest",
+		"alpine:3":                        "alpine:3",
+		"docker.io/library/alpine":        "alpine:latest",
+		"registry:5000/backup":            "registry:5000/backup:latest",
+		"registry:5000/backup:1":          "registry:5000/backup:1",
+		"registry-1.example.com/org/back": "registry-1.example.com/org/back:latest",
+	} {
+		require.Equal(t, want, withDefaultTag(tag), tag)
+	}
+}
+
+func TestLocalImageWithPort(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "registry:5000/backup"}})
+
+	tm.expectLocalImage("registry:5000/backup:latest", "sha256:id")
+
+	id, err := tm.mngr.localImageId(context.Background(), "registry:5000/backup")
+	require.NoError(t, err)
+	require.Equal(t, "sha256:id", id)
+}
+
+func TestFingerprintImage(t *testing.T) {
+	tm := newTestMngr(t, []string{"example"}, []string{"example"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	tm.mngr.conf.FingerprintImage = true
+
+	backuper := tm.liveBackupers["example"]
+	backuper.ImageID = "sha256:old"
+	tm.liveBackupers["example"] = backuper
+
+	tm.resetExpectCallList()
+	tm.expectCntrList()
+
+	tm.expectLocalImage("alpine:latest", "sha256:new")
+
+	tm.expectBackuperRemove("example")
+
+	tmpl := tm.mngr.tmpls.Backuper.Overlay(&Template{
+		Labels:  map[string]string{tm.mngr.labels.backuperName: "example"},
+		Volumes: []string{"/data:/data:ro"},
+	})
+	hash, err := tmpl.Fingerprint("sha256:new")
+	require.NoError(t, err)
+
+	tm.docker.EXPECT().ContainerCreate(mock.Anything, mock.MatchedBy(func(cfg *container.Config) bool {
+		return cfg.Labels[tm.mngr.labels.backuperConsistencyHash] == hash
+	}), mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(container.CreateResponse{ID: "hello"}, nil).Once()
+	tm.docker.EXPECT().ContainerStart(mock.Anything, "hello", mock.Anything).Return(nil).Once()
+
+	require.NoError(t, tm.mngr.Reconcile(context.Background()))
+
+	require.Equal(t, 1.0, testutil.ToFloat64(tm.mngr.metrics.recreations.WithLabelValues(RecreateReasonImageChanged)))
+}
+
+func TestPullPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy string
+		local  bool
+		pull   bool
+		err    bool
+	}{
+		{PullAlways, true, true, false},
+		{PullMissing, true, false, false},
+		{PullMissing, false, true, false},
+		{PullNever, true, false, false},
+		{PullNever, false, false, true},
+		{PullDaily, true, true, false},
+	} {
+		tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+		local := []string{}
+		if tc.local {
+			local = append(local, "alpine:latest")
+		}
+
+		// image is not looked up if it is pulled anyway
+		if tc.policy != PullAlways {
+			tm.expectImageList(local)
+		}
+
+		if tc.pull {
+			tm.expectPull("alpine:latest")
+		}
+
+		if tc.policy == PullDaily {
+			tm.docker.EXPECT().ImageInspectWithRaw(mock.Anything, mock.Anything).Return(types.ImageInspect{}, nil, nil).Once()
+		}
+
+		err := tm.mngr.pullImage(context.Background(), "alpine", tc.policy)
+		if tc.err {
+			require.Error(t, err, tc.policy)
+		} else {
+			require.NoError(t, err, tc.policy)
+		}
+	}
+}
+
+func TestPullPolicyDaily(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	tm.expectImageList([]string{"alpine:latest"})
+	tm.docker.EXPECT().ImageInspectWithRaw(mock.Anything, mock.Anything).Return(types.ImageInspect{}, nil, nil).Once()
+	tm.expectPull("alpine:latest")
+
+	require.NoError(t, tm.mngr.pullImage(context.Background(), "alpine", PullDaily))
+
+	// pulled less than a day ago
+	require.NoError(t, tm.mngr.pullImage(context.Background(), "alpine", PullDaily))
+}
+
+func TestPullPolicyDailyTagged(t *testing.T) {
+	for _, tc := range []struct {
+		tagged time.Duration
+		pull   bool
+	}{
+		{time.Hour, false},
+		{48 * time.Hour, true},
+	} {
+		// pull is not remembered by fresh maestro process, so it is known by tag time
+		tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+		tm.expectLocalImage("alpine:latest", "sha256:alpine")
+		tm.docker.EXPECT().ImageInspectWithRaw(mock.Anything, "sha256:alpine").Return(types.ImageInspect{
+			Metadata: image.Metadata{LastTagTime: time.Now().Add(-tc.tagged)},
+		}, nil, nil).Once()
+
+		if tc.pull {
+			tm.expectPull("alpine:latest")
+		}
+
+		require.NoError(t, tm.mngr.pullImage(context.Background(), "alpine", PullDaily), tc.tagged)
+	}
+}
+
+func TestBuildPolicy(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	tm.expectImageList([]string{"maestro-backup:latest"})
+
+	require.NoError(t, tm.mngr.buildImage(context.Background(), &BuildInfo{Context: "."}, "maestro-backup", PullMissing))
+
+	tm.expectBuild("maestro-backup:latest")
+
+	require.NoError(t, tm.mngr.buildImage(context.Background(), &BuildInfo{Context: "."}, "maestro-backup", PullBuild))
+}
@@ -0,0 +1,281 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+const (
+	JobTypeRestore        = "restore"
+	JobTypeRestoreAll     = "restore-all"
+	JobTypeForceBackup    = "force-backup"
+	JobTypeForceBackupAll = "force-backup-all"
+)
+
+// how many finished jobs are kept in memory
+const finishedJobsLimit = 100
+
+// how long daemon waits for canceled jobs on shutdown: one-off container is aborted
+// and backuper is started back, each step is limited by oneOffCleanupTimeout
+const jobsShutdownTimeout = 2 * oneOffCleanupTimeout
+
+type JobInfo struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`
+	Host       string     `json:"host,omitempty"`
+	Name       string     `json:"name"`
+	Status     JobStatus  `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type job struct {
+	mu   sync.Mutex
+	info JobInfo
+	logs []byte
+
+	// closed and replaced on every logs write
+	changed chan struct{}
+	done    chan struct{}
+	cancel  context.CancelFunc
+}
+
+func (j *job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.logs = append(j.logs, p...)
+
+	close(j.changed)
+	j.changed = make(chan struct{})
+
+	return len(p), nil
+}
+
+func (j *job) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	j.info.FinishedAt = &now
+
+	if err != nil {
+		j.info.Status = JobFailed
+		j.info.Error = err.Error()
+	} else {
+		j.info.Status = JobSucceeded
+	}
+
+	close(j.done)
+}
+
+// Cancel stops job. One-off container cleanup is still done by job itself, use Wait to wait for it
+func (j *job) Cancel() {
+	j.cancel()
+}
+
+func (j *job) Info() JobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.info
+}
+
+// Wait blocks until job is finished or ctx is done
+func (j *job) Wait(ctx context.Context) (JobInfo, error) {
+	select {
+	case <-j.done:
+		return j.Info(), nil
+	case <-ctx.Done():
+		return JobInfo{}, ctx.Err()
+	}
+}
+
+// WriteLogs copies job logs to writer. If follow is set, waits for new logs until job is finished or ctx is done
+func (j *job) WriteLogs(ctx context.Context, w io.Writer, follow bool) error {
+	offset := 0
+
+	for {
+		j.mu.Lock()
+		chunk := j.logs[offset:]
+		changed := j.changed
+		j.mu.Unlock()
+
+		if len(chunk) > 0 {
+			n, err := w.Write(chunk)
+			if err != nil {
+				return err
+			}
+
+			offset += n
+
+			if f, ok := w.(interface{ Flush() }); ok {
+				f.Flush()
+			}
+		}
+
+		if !follow {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-j.done:
+			// write what was left after last change
+			follow = false
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+type JobRegistry struct {
+	mu   sync.Mutex
+	jobs []*job
+
+	running sync.WaitGroup
+}
+
+func NewJobRegistry() *JobRegistry {
+	return &JobRegistry{}
+}
+
+// Start runs job in background. Only one running job per backup name of docker host is allowed.
+// Empty name means job for all backups of host, which conflicts with any other running job of host
+func (reg *JobRegistry) Start(ctx context.Context, typ, host, name string, run func(ctx context.Context, out io.Writer) error) (JobInfo, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	for _, j := range reg.jobs {
+		info := j.Info()
+		if info.Status != JobRunning || info.Host != host {
+			continue
+		}
+
+		if info.Name == name || len(info.Name) == 0 || len(name) == 0 {
+			return JobInfo{}, fmt.Errorf("job %s (%s) is already running for '%s'", info.ID, info.Type, info.Name)
+		}
+	}
+
+	id, err := newJobId()
+	if err != nil {
+		return JobInfo{}, err
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+
+	j := &job{
+		info: JobInfo{
+			ID:        id,
+			Type:      typ,
+			Host:      host,
+			Name:      name,
+			Status:    JobRunning,
+			StartedAt: time.Now(),
+		},
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+		cancel:  cancel,
+	}
+
+	reg.jobs = append(reg.jobs, j)
+	reg.prune()
+
+	reg.running.Add(1)
+
+	go func() {
+		defer reg.running.Done()
+		defer cancel()
+		j.finish(run(jobCtx, j))
+	}()
+
+	return j.Info(), nil
+}
+
+// Wait blocks until all jobs are finished or timeout passes. Jobs must be canceled before,
+// so that they clean up their one-off containers
+func (reg *JobRegistry) Wait(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		reg.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		slog.Error("timed out waiting for jobs to finish")
+	}
+}
+
+func (reg *JobRegistry) Get(id string) *job {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	for _, j := range reg.jobs {
+		if j.info.ID == id {
+			return j
+		}
+	}
+
+	return nil
+}
+
+func (reg *JobRegistry) List() []JobInfo {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	infos := []JobInfo{}
+
+	for _, j := range reg.jobs {
+		infos = append(infos, j.Info())
+	}
+
+	return infos
+}
+
+// prune drops oldest finished jobs over the limit. Must be called with lock held
+func (reg *JobRegistry) prune() {
+	finished := 0
+	for _, j := range reg.jobs {
+		if j.Info().Status != JobRunning {
+			finished++
+		}
+	}
+
+	reg.jobs = slices.DeleteFunc(reg.jobs, func(j *job) bool {
+		if finished <= finishedJobsLimit || j.Info().Status == JobRunning {
+			return false
+		}
+
+		finished--
+		return true
+	})
+}
+
+func newJobId() (string, error) {
+	b := make([]byte, 6)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate job id: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
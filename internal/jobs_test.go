@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobRegistry(t *testing.T) {
+	reg := NewJobRegistry()
+
+	release := make(chan struct{})
+
+	info, err := reg.Start(context.Background(), JobTypeRestore, "", "example", func(ctx context.Context, out io.Writer) error {
+		fmt.Fprintln(out, "line1")
+		<-release
+		fmt.Fprintln(out, "line2")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, JobRunning, info.Status)
+
+	_, err = reg.Start(context.Background(), JobTypeForceBackup, "", "example", func(ctx context.Context, out io.Writer) error {
+		return nil
+	})
+	require.ErrorContains(t, err, "already running")
+
+	// same backup name on other docker host is independent
+	other, err := reg.Start(context.Background(), JobTypeForceBackup, "remote", "example", func(ctx context.Context, out io.Writer) error {
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "remote", other.Host)
+
+	_, err = reg.Get(other.ID).Wait(context.Background())
+	require.NoError(t, err)
+
+	j := reg.Get(info.ID)
+	require.NotNil(t, j)
+
+	var logs strings.Builder
+
+	logsDone := make(chan error)
+	go func() {
+		logsDone <- j.WriteLogs(context.Background(), &logs, true)
+	}()
+
+	close(release)
+
+	res, err := j.Wait(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, JobSucceeded, res.Status)
+	require.NotNil(t, res.FinishedAt)
+
+	require.NoError(t, <-logsDone)
+	require.Equal(t, "line1\nline2\n", logs.String())
+
+	require.Len(t, reg.List(), 2)
+}
+
+func TestJobRegistryFailed(t *testing.T) {
+	reg := NewJobRegistry()
+
+	info, err := reg.Start(context.Background(), JobTypeForceBackup, "", "example", func(ctx context.Context, out io.Writer) error {
+		return errors.New("boom")
+	})
+	require.NoError(t, err)
+
+	res, err := reg.Get(info.ID).Wait(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, JobFailed, res.Status)
+	require.Equal(t, "boom", res.Error)
+}
+
+func TestControlServerJobs(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "maestro.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewControlServer(NewContainerManager(nil, UserTemplates{}, Config{}))
+
+	served := make(chan error)
+	go func() {
+		served <- srv.Serve(ctx, socketPath, "")
+	}()
+
+	client := NewControlClient(socketPath)
+
+	require.Eventually(t, func() bool {
+		_, err := client.Jobs(ctx)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	release := make(chan struct{})
+
+	info, err := srv.jobs.Start(ctx, JobTypeRestore, "", "example", func(ctx context.Context, out io.Writer) error {
+		fmt.Fprintln(out, "restoring")
+		<-release
+		return errors.New("restore failed")
+	})
+	require.NoError(t, err)
+
+	jobs, err := client.Jobs(ctx)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.Equal(t, info.ID, jobs[0].ID)
+
+	close(release)
+
+	res, err := client.WaitJob(ctx, info.ID)
+	require.NoError(t, err)
+	require.Equal(t, JobFailed, res.Status)
+	require.Equal(t, "restore failed", res.Error)
+
+	var logs strings.Builder
+	require.NoError(t, client.JobLogs(ctx, info.ID, true, &logs))
+	require.Equal(t, "restoring\n", logs.String())
+
+	_, err = client.WaitJob(ctx, "unknown")
+	require.ErrorContains(t, err, "not found")
+
+	_, err = client.StartJob(ctx, JobRequest{Type: "unknown", Name: "example"})
+	require.ErrorContains(t, err, "unknown job type")
+
+	cancel()
+	require.NoError(t, <-served)
+}
+
+func TestJobRegistryWaitCanceled(t *testing.T) {
+	tm := newTestMngr(t, []string{"example"}, []string{"example"}, UserTemplates{
+		Backuper:    &Template{Image: "alpine"},
+		ForceBackup: &Template{Image: "alpine"},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	tm.expectBackuperStop("example")
+	tm.expectImageList([]string{"alpine:latest"})
+
+	started := make(chan struct{})
+
+	tm.docker.EXPECT().ContainerCreate(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "docker-backup-maestro.forcebackup_example").Return(container.CreateResponse{ID: "forceid"}, nil).Once()
+	tm.docker.EXPECT().ContainerStart(mock.Anything, "forceid", mock.Anything).Run(func(_ context.Context, _ string, _ container.StartOptions) {
+		close(started)
+	}).Return(nil).Once()
+	tm.docker.EXPECT().ContainerLogs(mock.Anything, "forceid", mock.Anything).Return(io.NopCloser(strings.NewReader("")), nil).Maybe()
+
+	tm.expectContainerEvents(events.ActionDie)
+	destroyChan, _ := tm.expectContainerEvents(events.ActionDestroy)
+
+	// one-off container is stopped slowly, after daemon context is already gone
+	tm.docker.EXPECT().ContainerStop(mock.Anything, "forceid", mock.Anything).Run(func(ctx context.Context, containerID string, options container.StopOptions) {
+		time.Sleep(100 * time.Millisecond)
+
+		go func() {
+			destroyChan <- events.Message{}
+		}()
+	}).Return(nil).Once()
+
+	tm.expectBackuperStart("example")
+
+	reg := NewJobRegistry()
+
+	info, err := reg.Start(ctx, JobTypeForceBackup, "", "example", func(ctx context.Context, out io.Writer) error {
+		return tm.mngr.ForceBackup(ctx, "example", OneOffOptions{Output: out})
+	})
+	require.NoError(t, err)
+
+	<-started
+	cancel()
+
+	reg.Wait(time.Minute)
+
+	tm.docker.AssertCalled(t, "ContainerStart", mock.Anything, "backuperidexample", mock.Anything)
+
+	res := reg.Get(info.ID).Info()
+	require.Equal(t, JobFailed, res.Status)
+	require.Contains(t, res.Error, context.Canceled.Error())
+}
@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	TemplateBackup      = "backup"
+	TemplateRestore     = "restore"
+	TemplateForceBackup = "force-backup"
+)
+
+// Consistency of backuper with its container to backup
+const (
+	SyncInSync   = "in-sync"
+	SyncDrifted  = "drifted"
+	SyncMissing  = "missing"
+	SyncOrphaned = "orphaned"
+)
+
+type ListOptions struct {
+	All          bool
+	Backupers    bool
+	Restores     bool
+	ForceBackups bool
+}
+
+// ListEntry describes listed container together with its container to backup and backuper.
+// Image, networks and paths are of backuper, or of listed restore/force-backup container
+type ListEntry struct {
+	Host string `json:"host,omitempty" yaml:"host,omitempty"`
+	Name string `json:"name" yaml:"name"`
+
+	// listed restore or force-backup container
+	Container   string `json:"container,omitempty" yaml:"container,omitempty"`
+	ContainerId string `json:"container_id,omitempty" yaml:"container_id,omitempty"`
+	State       string `json:"state,omitempty" yaml:"state,omitempty"`
+
+	Target      string `json:"target,omitempty" yaml:"target,omitempty"`
+	TargetState string `json:"target_state,omitempty" yaml:"target_state,omitempty"`
+
+	Backuper      string `json:"backuper,omitempty" yaml:"backuper,omitempty"`
+	BackuperId    string `json:"backuper_id,omitempty" yaml:"backuper_id,omitempty"`
+	BackuperState string `json:"backuper_state,omitempty" yaml:"backuper_state,omitempty"`
+	Sync          string `json:"sync" yaml:"sync"`
+
+	Template string     `json:"template" yaml:"template"`
+	Image    string     `json:"image,omitempty" yaml:"image,omitempty"`
+	Networks []string   `json:"networks,omitempty" yaml:"networks,omitempty"`
+	Paths    []string   `json:"paths,omitempty" yaml:"paths,omitempty"`
+	LastJob  *JobResult `json:"last_job,omitempty" yaml:"last_job,omitempty"`
+}
+
+func (mngr *ContainerManager) List(ctx context.Context, opts ListOptions) ([]ListEntry, error) {
+	targets, err := mngr.containersByLabelValue(ctx, mngr.labels.backupName)
+	if err != nil {
+		return nil, err
+	}
+
+	backupers, err := mngr.containersByLabelValue(ctx, mngr.labels.backuperName)
+	if err != nil {
+		return nil, err
+	}
+
+	label, template := mngr.labels.backupName, TemplateBackup
+
+	if opts.Backupers {
+		label = mngr.labels.backuperName
+	}
+
+	if opts.Restores {
+		label, template = mngr.labels.restore, TemplateRestore
+	}
+
+	if opts.ForceBackups {
+		label, template = mngr.labels.forceBackup, TemplateForceBackup
+	}
+
+	cntrs, err := mngr.listContainersWithLabel(ctx, label, opts.All)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []ListEntry{}
+
+	for _, cntr := range cntrs {
+		name := mngr.nameFromLabel(&cntr, label)
+
+		entry := ListEntry{
+			Host:     mngr.host,
+			Name:     name,
+			Template: template,
+		}
+
+		target := targets[name]
+		if target != nil {
+			entry.Target = containerName(target)
+			entry.TargetState = target.State
+		}
+
+		backuper := backupers[name]
+		if backuper != nil {
+			entry.Backuper = containerName(backuper)
+			entry.BackuperId = backuper.ID
+			entry.BackuperState = backuper.State
+		}
+
+		entry.Sync, err = mngr.backuperSync(ctx, target, backuper)
+		if err != nil {
+			return nil, err
+		}
+
+		described := backuper
+		if template != TemplateBackup {
+			entry.Container = containerName(&cntr)
+			entry.ContainerId = cntr.ID
+			entry.State = cntr.State
+
+			described = &cntr
+		}
+
+		if described != nil {
+			entry.Image = described.Image
+			entry.Networks = containerNetworks(described)
+			entry.Paths = containerPaths(described)
+		}
+
+		state, err := mngr.backups.get(name)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.LastJob = state.LastJob
+
+		entries = append(entries, entry)
+	}
+
+	slices.SortFunc(entries, func(a, b ListEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return entries, nil
+}
+
+// containersByLabelValue lists all containers with label, indexed by label value. If value is
+// duplicated, last container wins
+func (mngr *ContainerManager) containersByLabelValue(ctx context.Context, label string) (map[string]*types.Container, error) {
+	cntrs, err := mngr.listContainersWithLabel(ctx, label, true)
+	if err != nil {
+		return nil, err
+	}
+
+	byValue := map[string]*types.Container{}
+
+	for i := range cntrs {
+		byValue[mngr.nameFromLabel(&cntrs[i], label)] = &cntrs[i]
+	}
+
+	return byValue, nil
+}
+
+// backuperSync compares backuper fingerprint with fingerprint of config it would be created with now
+func (mngr *ContainerManager) backuperSync(ctx context.Context, target, backuper *types.Container) (string, error) {
+	if backuper == nil {
+		return SyncMissing, nil
+	}
+
+	if target == nil {
+		return SyncOrphaned, nil
+	}
+
+	hash, _, err := mngr.backuperFingerprint(ctx, mngr.tmpls.Backuper.Overlay(mngr.backuperConfigFrom(target, false)))
+	if err != nil {
+		return "", err
+	}
+
+	if hash != getContainerLabel(backuper, mngr.labels.backuperConsistencyHash) {
+		return SyncDrifted, nil
+	}
+
+	return SyncInSync, nil
+}
+
+func containerName(cntr *types.Container) string {
+	if len(cntr.Names) == 0 {
+		return cntr.ID
+	}
+
+	return strings.TrimPrefix(cntr.Names[0], "/")
+}
+
+func containerNetworks(cntr *types.Container) []string {
+	if cntr.NetworkSettings == nil {
+		return nil
+	}
+
+	return slices.Sorted(maps.Keys(cntr.NetworkSettings.Networks))
+}
+
+func containerPaths(cntr *types.Container) []string {
+	var paths []string
+
+	for _, mount := range cntr.Mounts {
+		paths = append(paths, mount.Destination)
+	}
+
+	slices.Sort(paths)
+
+	return paths
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList(t *testing.T) {
+	tm := newTestMngr(t, []string{"example", "example2", "example3"}, []string{"example", "example2"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	target := tm.liveBackupCntrs["example"]
+	target.Names = []string{"/app"}
+	target.State = ContainerStatusRunning
+	tm.liveBackupCntrs["example"] = target
+
+	backuper := tm.liveBackupers["example"]
+	backuper.Names = []string{"/docker-backup-maestro.backup_example"}
+	backuper.Image = "alpine"
+	backuper.Mounts = []types.MountPoint{{Destination: "/data"}}
+	backuper.NetworkSettings = &types.SummaryNetworkSettings{Networks: map[string]*network.EndpointSettings{"db": {}, "bridge": {}}}
+	tm.liveBackupers["example"] = backuper
+
+	// backuper created with other config
+	backuper2 := tm.liveBackupers["example2"]
+	backuper2.Labels[tm.mngr.labels.backuperConsistencyHash] = "stale"
+	tm.liveBackupers["example2"] = backuper2
+
+	tm.resetExpectCallList()
+	tm.expectCntrList()
+
+	entries, err := tm.mngr.List(context.Background(), ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	require.Equal(t, ListEntry{
+		Name:          "example",
+		Target:        "app",
+		TargetState:   ContainerStatusRunning,
+		Backuper:      "docker-backup-maestro.backup_example",
+		BackuperId:    "backuperidexample",
+		BackuperState: ContainerStatusRunning,
+		Sync:          SyncInSync,
+		Template:      TemplateBackup,
+		Image:         "alpine",
+		Networks:      []string{"bridge", "db"},
+		Paths:         []string{"/data"},
+	}, entries[0])
+
+	require.Equal(t, SyncDrifted, entries[1].Sync)
+	require.Equal(t, SyncMissing, entries[2].Sync)
+
+	var out bytes.Buffer
+	require.NoError(t, printOutput(&out, OutputJson, entries, nil, func(w io.Writer) {}))
+
+	var decoded []ListEntry
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	require.Equal(t, entries, decoded)
+
+	out.Reset()
+	printList(&out, entries)
+	require.Contains(t, out.String(), "NAME")
+	require.Contains(t, out.String(), "drifted")
+
+	require.Error(t, checkOutputFormat("xml"))
+}
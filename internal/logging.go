@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Keys of fields used across maestro logs
+const (
+	logKeyBackupName  = "backup_name"
+	logKeyContainerId = "container_id"
+	logKeyAction      = "action"
+	logKeyTemplate    = "template"
+	logKeyImage       = "image"
+	logKeyError       = "error"
+	logKeyStream      = "stream"
+	logKeyHost        = "host"
+)
+
+// Build and pull progress is written to its own stream at debug level,
+// so it does not mix with operational logs
+const progressStream = "progress"
+
+const (
+	LogFormatText = "text"
+	LogFormatJson = "json"
+)
+
+// SetupLogging sets default slog logger (used by log package as well) with given level and format
+func SetupLogging(w io.Writer, level, format string) error {
+	var lvl slog.Level
+
+	err := lvl.UnmarshalText([]byte(level))
+	if err != nil {
+		return fmt.Errorf("invalid LOG_LEVEL '%s' - %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+
+	switch strings.ToLower(format) {
+	case LogFormatText:
+		handler = slog.NewTextHandler(w, opts)
+	case LogFormatJson:
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid LOG_FORMAT '%s', must be %s or %s", format, LogFormatText, LogFormatJson)
+	}
+
+	slog.SetDefault(slog.New(handler))
+
+	return nil
+}
+
+// progressLog returns logger for build and pull progress of image
+func progressLog(action, image string) *slog.Logger {
+	return slog.With(logKeyStream, progressStream, logKeyAction, action, logKeyImage, image)
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupLoggingJson(t *testing.T) {
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	var out bytes.Buffer
+	require.NoError(t, SetupLogging(&out, "info", "json"))
+
+	slog.Info("creating backup container", logKeyAction, "create", logKeyBackupName, "example")
+	progressLog("build", "backup:latest").Debug("step 1/3")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 1)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	require.Equal(t, "INFO", entry["level"])
+	require.Equal(t, "creating backup container", entry["msg"])
+	require.Equal(t, "create", entry[logKeyAction])
+	require.Equal(t, "example", entry[logKeyBackupName])
+}
+
+func TestSetupLoggingDebugProgress(t *testing.T) {
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	var out bytes.Buffer
+	require.NoError(t, SetupLogging(&out, "DEBUG", "text"))
+
+	progressLog("pull", "alpine:latest").Debug("downloading")
+
+	require.Contains(t, out.String(), "level=DEBUG msg=downloading stream=progress action=pull image=alpine:latest")
+}
+
+func TestSetupLoggingInvalid(t *testing.T) {
+	require.ErrorContains(t, SetupLogging(&bytes.Buffer{}, "verbose", "text"), "LOG_LEVEL")
+	require.ErrorContains(t, SetupLogging(&bytes.Buffer{}, "info", "logfmt"), "LOG_FORMAT")
+}
@@ -0,0 +1,310 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const metricsNamespace = "maestro"
+
+// how long metrics scrape waits for docker to list containers
+const metricsListTimeout = 5 * time.Second
+
+const (
+	RecreateReasonConfigChanged = "config_changed"
+)
+
+type metrics struct {
+	registry *prometheus.Registry
+
+	reconcileRuns     *prometheus.CounterVec
+	reconcileDuration prometheus.Histogram
+	recreations       *prometheus.CounterVec
+	events            *prometheus.CounterVec
+
+	imagePulls         *prometheus.CounterVec
+	imagePullDuration  prometheus.Histogram
+	imageBuilds        *prometheus.CounterVec
+	imageBuildDuration prometheus.Histogram
+
+	jobs              *prometheus.CounterVec
+	lastForceBackupAt *prometheus.GaugeVec
+
+	scheduleSkips prometheus.Counter
+}
+
+func newMetrics(mngr *ContainerManager) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+
+		reconcileRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "reconcile_runs_total",
+			Help:      "Number of reconcile runs by result",
+		}, []string{"result"}),
+		reconcileDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "reconcile_duration_seconds",
+			Help:      "Duration of reconcile runs",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+		}),
+		recreations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "backuper_recreations_total",
+			Help:      "Number of backup containers recreated by reason",
+		}, []string{"reason"}),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "docker_events_total",
+			Help:      "Number of docker events of containers labeled for backup by action",
+		}, []string{"action"}),
+
+		imagePulls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "image_pulls_total",
+			Help:      "Number of image pulls by result",
+		}, []string{"result"}),
+		imagePullDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "image_pull_duration_seconds",
+			Help:      "Duration of image pulls",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+		}),
+		imageBuilds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "image_builds_total",
+			Help:      "Number of image builds by result",
+		}, []string{"result"}),
+		imageBuildDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "image_build_duration_seconds",
+			Help:      "Duration of image builds",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		}),
+
+		jobs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "jobs_total",
+			Help:      "Number of finished one-off jobs by type and container exit code (or unknown, timeout, canceled, error)",
+		}, []string{"type", "exit_code"}),
+		lastForceBackupAt: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "last_successful_force_backup_timestamp_seconds",
+			Help:      "Unix time of last force-backup container exited with code 0",
+		}, []string{"backup_name"}),
+
+		scheduleSkips: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "scheduled_runs_skipped_total",
+			Help:      "Number of scheduled force-backups skipped because job of the same name was still running",
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.reconcileRuns,
+		m.reconcileDuration,
+		m.recreations,
+		m.events,
+		m.imagePulls,
+		m.imagePullDuration,
+		m.imageBuilds,
+		m.imageBuildDuration,
+		m.jobs,
+		m.lastForceBackupAt,
+		m.scheduleSkips,
+		&containersCollector{mngr: mngr},
+		&backupsCollector{mngr: mngr},
+	)
+
+	return m
+}
+
+func resultLabel(err error) string {
+	if err != nil {
+		return "failure"
+	}
+
+	return "success"
+}
+
+// containersCollector counts targets and backupers at scrape time, so counts are never stale
+type containersCollector struct {
+	mngr *ContainerManager
+}
+
+var (
+	targetsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "managed_targets"),
+		"Number of containers labeled for backup",
+		nil, nil,
+	)
+	backupersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "backupers"),
+		"Number of backup containers by state",
+		[]string{"state"}, nil,
+	)
+	duplicatesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "duplicate_backup_names"),
+		"Number of backup names set on more than one container, such names get no backup container",
+		nil, nil,
+	)
+)
+
+func (c *containersCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- targetsDesc
+	ch <- backupersDesc
+	ch <- duplicatesDesc
+}
+
+func (c *containersCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsListTimeout)
+	defer cancel()
+
+	targets, err := c.mngr.listContainersWithLabel(ctx, c.mngr.labels.backupName, true)
+	if err != nil {
+		slog.Error("metrics: failed to list containers", logKeyError, err)
+		ch <- prometheus.NewInvalidMetric(targetsDesc, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(targetsDesc, prometheus.GaugeValue, float64(len(targets)))
+	ch <- prometheus.MustNewConstMetric(duplicatesDesc, prometheus.GaugeValue, float64(len(c.mngr.groupDuplicates(targets, c.mngr.labels.backupName))))
+
+	backupers, err := c.mngr.listContainersWithLabel(ctx, c.mngr.labels.backuperName, true)
+	if err != nil {
+		slog.Error("metrics: failed to list containers", logKeyError, err)
+		ch <- prometheus.NewInvalidMetric(backupersDesc, err)
+		return
+	}
+
+	running := 0
+	for _, backuper := range backupers {
+		if containerIsAlive(&backuper) {
+			running++
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(backupersDesc, prometheus.GaugeValue, float64(running), "running")
+	ch <- prometheus.MustNewConstMetric(backupersDesc, prometheus.GaugeValue, float64(len(backupers)-running), "stopped")
+}
+
+// backupsCollector reports last successful backups at scrape time, so backup markers are checked on scrape
+type backupsCollector struct {
+	mngr *ContainerManager
+}
+
+var (
+	lastBackupDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "last_successful_backup_timestamp_seconds"),
+		"Unix time of last successful backup by source: force-backup, log, marker",
+		[]string{"backup_name", "source"}, nil,
+	)
+	lastRestoreDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "last_successful_restore_timestamp_seconds"),
+		"Unix time of last restore container exited with code 0",
+		[]string{"backup_name"}, nil,
+	)
+)
+
+func (c *backupsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lastBackupDesc
+	ch <- lastRestoreDesc
+}
+
+func (c *backupsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsListTimeout)
+	defer cancel()
+
+	states, err := c.mngr.LastBackups(ctx)
+	if err != nil {
+		slog.Error("metrics: failed to get last backups", logKeyError, err)
+		ch <- prometheus.NewInvalidMetric(lastBackupDesc, err)
+		return
+	}
+
+	for _, state := range states {
+		if state.LastBackup != nil {
+			ch <- prometheus.MustNewConstMetric(lastBackupDesc, prometheus.GaugeValue, float64(state.LastBackup.Unix()), state.Name, state.LastBackupSource)
+		}
+
+		if state.LastRestore != nil {
+			ch <- prometheus.MustNewConstMetric(lastRestoreDesc, prometheus.GaugeValue, float64(state.LastRestore.Unix()), state.Name)
+		}
+	}
+}
+
+func (mngr *ContainerManager) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(mngr.metrics.registry, promhttp.HandlerOpts{})
+}
+
+// hostGatherer adds host label to all metrics of host, so metrics of several hosts could be served together
+type hostGatherer struct {
+	host     string
+	gatherer prometheus.Gatherer
+}
+
+func (g hostGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+
+	labelName := "host"
+
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			metric.Label = append(metric.Label, &dto.LabelPair{Name: &labelName, Value: &g.host})
+
+			slices.SortFunc(metric.Label, func(a, b *dto.LabelPair) int {
+				return strings.Compare(a.GetName(), b.GetName())
+			})
+		}
+	}
+
+	return families, err
+}
+
+// metricsHandler serves metrics of all docker hosts, labeled with host name if maestro manages several hosts
+func metricsHandler(mngrs []*ContainerManager) http.Handler {
+	if len(hostNames(mngrs)) == 0 {
+		return mngrs[0].MetricsHandler()
+	}
+
+	gatherers := prometheus.Gatherers{}
+
+	for _, mngr := range mngrs {
+		gatherers = append(gatherers, hostGatherer{host: mngr.host, gatherer: mngr.metrics.registry})
+	}
+
+	return promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
+}
+
+// ServeMetrics serves /metrics of all docker hosts on tcp address until ctx is done
+func ServeMetrics(ctx context.Context, addr string, mngrs []*ContainerManager) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metricsHandler(mngrs))
+
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	slog.Info("metrics listening", "addr", addr)
+
+	err := srv.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
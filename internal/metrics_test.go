@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsContainers(t *testing.T) {
+	tm := newTestMngr(t, []string{"example", "example2"}, []string{"example"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	rec := httptest.NewRecorder()
+	tm.mngr.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "maestro_managed_targets 2\n")
+	require.Contains(t, rec.Body.String(), "maestro_backupers{state=\"running\"} 1\n")
+	require.Contains(t, rec.Body.String(), "maestro_backupers{state=\"stopped\"} 0\n")
+}
+
+func TestMetricsForceBackup(t *testing.T) {
+	tm := newTestMngr(t, []string{"example"}, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	tm.expectImageList([]string{"alpine:latest"})
+
+	tm.expectForceBackupRun("example", "3")
+
+	err := tm.mngr.ForceBackup(context.Background(), "example", OneOffOptions{})
+	require.NoError(t, err)
+
+	require.Equal(t, 1.0, testutil.ToFloat64(tm.mngr.metrics.jobs.WithLabelValues(JobTypeForceBackup, "3")))
+	require.Equal(t, 0, testutil.CollectAndCount(tm.mngr.metrics.lastForceBackupAt))
+
+	tm.expectForceBackupRun("example", "0")
+
+	err = tm.mngr.ForceBackup(context.Background(), "example", OneOffOptions{})
+	require.NoError(t, err)
+
+	require.Equal(t, 1.0, testutil.ToFloat64(tm.mngr.metrics.jobs.WithLabelValues(JobTypeForceBackup, "0")))
+	require.Greater(t, testutil.ToFloat64(tm.mngr.metrics.lastForceBackupAt.WithLabelValues("example")), 0.0)
+
+	rec := httptest.NewRecorder()
+	tm.mngr.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Contains(t, rec.Body.String(), "maestro_last_successful_backup_timestamp_seconds{backup_name=\"example\",source=\"force-backup\"}")
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/docker/docker/api/types"
+)
+
+var ErrInvalidBackupName = errors.New("invalid backup name")
+
+var invalidBackupNameChars = regexp.MustCompile("[^a-zA-Z0-9-._]")
+
+// ValidateBackupName checks backup name is not empty and contains only characters allowed
+// in container names and labels
+func ValidateBackupName(name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("%w: name is empty", ErrInvalidBackupName)
+	}
+
+	if invalidBackupNameChars.MatchString(name) {
+		return fmt.Errorf("%w '%s': must contain only letters, digits and '-' '_' '.' (set NAME_SANITIZE=true to replace other characters)", ErrInvalidBackupName, name)
+	}
+
+	return nil
+}
+
+// SanitizeBackupName replaces every character not allowed in backup name with '_'
+func SanitizeBackupName(name string) string {
+	return invalidBackupNameChars.ReplaceAllString(name, "_")
+}
+
+// resolveBackupName validates name given by label, api or cli, and returns name maestro uses
+// for backup, restore and force-backup containers. Name is sanitized first if NAME_SANITIZE is on
+func (mngr *ContainerManager) resolveBackupName(name string) (string, error) {
+	if mngr.conf.NameSanitize {
+		name = SanitizeBackupName(name)
+	}
+
+	err := ValidateBackupName(name)
+	if err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// nameFromLabel returns backup name container is labeled with. Names of containers to backup
+// are sanitized if NAME_SANITIZE is on, so they match names of their backupers
+func (mngr *ContainerManager) nameFromLabel(cntr *types.Container, label string) string {
+	name := getContainerLabel(cntr, label)
+
+	if label == mngr.labels.backupName && mngr.conf.NameSanitize {
+		name = SanitizeBackupName(name)
+	}
+
+	return name
+}
+
+// getTargetByName returns container to backup by resolved backup name, nil if there is no such container
+func (mngr *ContainerManager) getTargetByName(ctx context.Context, name string, searchAll bool) (*types.Container, error) {
+	if !mngr.conf.NameSanitize {
+		return mngr.getContainerByLabelValue(ctx, mngr.labels.backupName, name, searchAll)
+	}
+
+	// different original names could be sanitized to the same name, so all targets are checked
+	cntrs, err := mngr.listContainersWithLabel(ctx, mngr.labels.backupName, searchAll)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []types.Container
+
+	for _, cntr := range cntrs {
+		if mngr.nameFromLabel(&cntr, mngr.labels.backupName) == name {
+			found = append(found, cntr)
+		}
+	}
+
+	if len(found) > 1 {
+		return nil, &duplicateLabelError{label: mngr.labels.backupName, value: name, cntrs: found}
+	}
+
+	if len(found) == 1 {
+		return &found[0], nil
+	}
+
+	return nil, nil
+}
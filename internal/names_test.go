@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBackupName(t *testing.T) {
+	for _, name := range []string{"example", "my-app_1.db"} {
+		require.NoError(t, ValidateBackupName(name), name)
+	}
+
+	for _, name := range []string{"", "my app", "app/db", "app:1"} {
+		require.ErrorIs(t, ValidateBackupName(name), ErrInvalidBackupName, name)
+	}
+
+	require.Equal(t, "my_app_db", SanitizeBackupName("my app/db"))
+}
+
+func TestInvalidBackupName(t *testing.T) {
+	tm := newTestMngr(t, []string{"bad name"}, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	// invalid name is skipped without failing reconcile
+	require.NoError(t, tm.mngr.Reconcile(context.Background()))
+
+	for _, fn := range []func(ctx context.Context, name string) error{
+		tm.mngr.CreateBackuper,
+		tm.mngr.StartBackuper,
+		tm.mngr.Stop,
+		tm.mngr.RemoveBackuper,
+	} {
+		require.ErrorIs(t, fn(context.Background(), ""), ErrInvalidBackupName)
+		require.ErrorIs(t, fn(context.Background(), "bad name"), ErrInvalidBackupName)
+	}
+
+	err := tm.mngr.Restore(context.Background(), "bad name", OneOffOptions{})
+	require.ErrorContains(t, err, "invalid backup name 'bad name'")
+
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	var logs bytes.Buffer
+	require.NoError(t, SetupLogging(&logs, "info", "text"))
+
+	// invalid name is logged as is
+	require.NoError(t, tm.mngr.dropBackuper(context.Background(), "bad name"))
+	require.Contains(t, logs.String(), `msg="backup container not found, skipping" backup_name="bad name"`)
+}
+
+func TestSanitizedBackupName(t *testing.T) {
+	tm := newTestMngr(t, []string{"my app"}, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	tm.mngr.conf.NameSanitize = true
+
+	tm.docker.EXPECT().ContainerList(mock.Anything, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.KeyValuePair{Key: "label", Value: tm.mngr.labels.backuperName + "=my_app"}),
+	}).Return([]types.Container{}, nil).Once()
+
+	tm.expectImageList([]string{"alpine:latest"})
+
+	// backuper gets sanitized name and original name is kept in label
+	tm.expectBackuperCreateAndStart(t, "my_app", nil, &Template{
+		Labels: map[string]string{
+			tm.mngr.labels.backuperName:         "my_app",
+			tm.mngr.labels.backuperOriginalName: "my app",
+		},
+		Volumes: []string{"/data:/data:ro"},
+	})
+
+	require.NoError(t, tm.mngr.Reconcile(context.Background()))
+}
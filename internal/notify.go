@@ -0,0 +1,367 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	NotifyBackuperCreated   = "backuper_created"
+	NotifyBackuperRecreated = "backuper_recreated"
+	NotifyBackuperDropped   = "backuper_dropped"
+	NotifyJobSucceeded      = "job_succeeded"
+	NotifyJobFailed         = "job_failed"
+	NotifyBuildFailed       = "build_failed"
+	NotifyPullFailed        = "pull_failed"
+	NotifyReconcileFailed   = "reconcile_failed"
+	NotifyDuplicateName     = "duplicate_name"
+	NotifyHostFailed        = "host_failed"
+)
+
+// Webhook kinds, set as url scheme prefix, e.g. slack+https://hooks.slack.com/...
+// Url without prefix receives NotifyEvent as is
+const (
+	webhookGeneric = "generic"
+	webhookSlack   = "slack"
+	webhookDiscord = "discord"
+	webhookGotify  = "gotify"
+	webhookNtfy    = "ntfy"
+)
+
+const (
+	notifyRequestTimeout = 10 * time.Second
+	notifyRetryDelay     = time.Second
+	// how long maestro waits for pending notifications on exit
+	notifyFlushTimeout = 30 * time.Second
+	// how many one-off container log lines are sent with job notification
+	notifyLogTailLines = 20
+)
+
+type NotifyEvent struct {
+	Event    string    `json:"event"`
+	Host     string    `json:"host,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	JobType  string    `json:"job_type,omitempty"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	LogTail  string    `json:"log_tail,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+func (ev NotifyEvent) Title() string {
+	switch ev.Event {
+	case NotifyBackuperCreated:
+		return fmt.Sprintf("maestro: backup container %s created", ev.Name)
+	case NotifyBackuperRecreated:
+		return fmt.Sprintf("maestro: backup container %s recreated", ev.Name)
+	case NotifyBackuperDropped:
+		return fmt.Sprintf("maestro: backup container %s dropped", ev.Name)
+	case NotifyJobSucceeded:
+		return fmt.Sprintf("maestro: %s of %s succeeded", ev.JobType, ev.Name)
+	case NotifyJobFailed:
+		return fmt.Sprintf("maestro: %s of %s failed", ev.JobType, ev.Name)
+	case NotifyBuildFailed:
+		return fmt.Sprintf("maestro: build of %s failed", ev.Name)
+	case NotifyPullFailed:
+		return fmt.Sprintf("maestro: pull of %s failed", ev.Name)
+	case NotifyReconcileFailed:
+		return "maestro: reconcile failed"
+	case NotifyDuplicateName:
+		return fmt.Sprintf("maestro: backup name %s is duplicated, backup container is skipped", ev.Name)
+	case NotifyHostFailed:
+		return fmt.Sprintf("maestro: docker host %s failed, retrying", ev.Host)
+	}
+
+	return "maestro: " + ev.Event
+}
+
+// Message is title with details: exit code, reason, error and log tail
+func (ev NotifyEvent) Message() string {
+	var msg strings.Builder
+
+	msg.WriteString(ev.Title())
+
+	if len(ev.Host) > 0 {
+		fmt.Fprintf(&msg, "\nhost: %s", ev.Host)
+	}
+
+	if ev.ExitCode != nil {
+		fmt.Fprintf(&msg, "\nexit code: %d", *ev.ExitCode)
+	}
+
+	if len(ev.Reason) > 0 {
+		fmt.Fprintf(&msg, "\nreason: %s", ev.Reason)
+	}
+
+	if len(ev.Error) > 0 {
+		fmt.Fprintf(&msg, "\nerror: %s", ev.Error)
+	}
+
+	if len(ev.LogTail) > 0 {
+		fmt.Fprintf(&msg, "\nlogs:\n%s", ev.LogTail)
+	}
+
+	return msg.String()
+}
+
+func (ev NotifyEvent) isFailure() bool {
+	return ev.Event == NotifyJobFailed || ev.Event == NotifyBuildFailed || ev.Event == NotifyPullFailed || ev.Event == NotifyReconcileFailed || ev.Event == NotifyDuplicateName
+}
+
+type webhook struct {
+	kind string
+	url  string
+}
+
+func parseWebhook(raw string) (webhook, error) {
+	kind, rawUrl, found := strings.Cut(raw, "+")
+	if !found || strings.Contains(kind, "/") {
+		kind, rawUrl = webhookGeneric, raw
+	}
+
+	switch kind {
+	case webhookGeneric, webhookSlack, webhookDiscord, webhookGotify, webhookNtfy:
+	default:
+		return webhook{}, fmt.Errorf("unknown webhook kind '%s' in %s", kind, raw)
+	}
+
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return webhook{}, fmt.Errorf("invalid webhook url %s: %w", raw, err)
+	}
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return webhook{}, fmt.Errorf("invalid webhook url %s: scheme must be http or https", raw)
+	}
+
+	return webhook{kind: kind, url: rawUrl}, nil
+}
+
+// request builds payload in shape expected by webhook kind
+func (hook webhook) request(ctx context.Context, ev NotifyEvent) (*http.Request, error) {
+	target := hook.url
+
+	var payload any
+
+	switch hook.kind {
+	case webhookSlack:
+		payload = map[string]string{"text": ev.Message()}
+
+	case webhookDiscord:
+		payload = map[string]string{"content": ev.Message()}
+
+	case webhookGotify:
+		priority := 5
+		if ev.isFailure() {
+			priority = 8
+		}
+
+		payload = map[string]any{"title": ev.Title(), "message": ev.Message(), "priority": priority}
+
+	case webhookNtfy:
+		// json is published to server root with topic in body
+		parsed, err := url.Parse(hook.url)
+		if err != nil {
+			return nil, err
+		}
+
+		topic := path.Base(parsed.Path)
+		parsed.Path = path.Dir(parsed.Path)
+		target = parsed.String()
+
+		priority := 3
+		if ev.isFailure() {
+			priority = 5
+		}
+
+		payload = map[string]any{"topic": topic, "title": ev.Title(), "message": ev.Message(), "priority": priority}
+
+	default:
+		payload = ev
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+// Notifier posts events to webhooks in background. Zero value has no webhooks and drops all events
+type Notifier struct {
+	hooks      []webhook
+	retries    int
+	retryDelay time.Duration
+	http       *http.Client
+
+	// docker host set on every event, if maestro manages several hosts
+	host string
+
+	pending sync.WaitGroup
+}
+
+func NewNotifier(urls []string, retries int) (*Notifier, error) {
+	n := &Notifier{
+		retries:    retries,
+		retryDelay: notifyRetryDelay,
+		http:       &http.Client{Timeout: notifyRequestTimeout},
+	}
+
+	for _, raw := range urls {
+		raw = strings.TrimSpace(raw)
+		if len(raw) == 0 {
+			continue
+		}
+
+		hook, err := parseWebhook(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		n.hooks = append(n.hooks, hook)
+	}
+
+	return n, nil
+}
+
+// Notify sends event to all webhooks asynchronously, each is retried with backoff on failure
+func (n *Notifier) Notify(ev NotifyEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	if len(ev.Host) == 0 {
+		ev.Host = n.host
+	}
+
+	for _, hook := range n.hooks {
+		n.pending.Add(1)
+
+		go func() {
+			defer n.pending.Done()
+
+			err := n.deliver(hook, ev)
+			if err != nil {
+				slog.Error("failed to send notification", "event", ev.Event, "webhook", hook.kind, logKeyBackupName, ev.Name, logKeyError, err)
+			}
+		}()
+	}
+}
+
+// Wait blocks until all pending notifications are delivered or timeout is reached
+func (n *Notifier) Wait(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		n.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		slog.Error("timed out waiting for notifications to be sent")
+	}
+}
+
+func (n *Notifier) deliver(hook webhook, ev NotifyEvent) error {
+	var err error
+
+	delay := n.retryDelay
+
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		err = n.post(hook, ev)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func (n *Notifier) post(hook webhook, ev NotifyEvent) error {
+	req, err := hook.request(context.Background(), ev)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.http.Do(req)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+// tailWriter keeps last lines written to it
+type tailWriter struct {
+	mu    sync.Mutex
+	lines []string
+	// unfinished last line
+	partial string
+	limit   int
+}
+
+func newTailWriter(limit int) *tailWriter {
+	return &tailWriter{limit: limit}
+}
+
+func (tw *tailWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	lines := strings.Split(tw.partial+string(p), "\n")
+
+	tw.partial = lines[len(lines)-1]
+	tw.lines = append(tw.lines, lines[:len(lines)-1]...)
+
+	if len(tw.lines) > tw.limit {
+		tw.lines = tw.lines[len(tw.lines)-tw.limit:]
+	}
+
+	return len(p), nil
+}
+
+func (tw *tailWriter) String() string {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	lines := slices.Clone(tw.lines)
+	if len(tw.partial) > 0 {
+		lines = append(lines, tw.partial)
+		if len(lines) > tw.limit {
+			lines = lines[1:]
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type webhookRequest struct {
+	path string
+	body map[string]any
+}
+
+// newWebhookServer records requests, first failures requests are responded with error
+func newWebhookServer(t *testing.T, failures int) (*httptest.Server, func() []webhookRequest) {
+	var (
+		mu       sync.Mutex
+		requests []webhookRequest
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		req := webhookRequest{path: r.URL.Path}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req.body))
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		requests = append(requests, req)
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv, func() []webhookRequest {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]webhookRequest{}, requests...)
+	}
+}
+
+func TestNotifierPayloads(t *testing.T) {
+	srv, requests := newWebhookServer(t, 0)
+
+	n, err := NewNotifier([]string{
+		srv.URL + "/generic",
+		"slack+" + srv.URL + "/slack",
+		"discord+" + srv.URL + "/discord",
+		"gotify+" + srv.URL + "/message?token=abc",
+		"ntfy+" + srv.URL + "/ntfy/backups",
+	}, 0)
+	require.NoError(t, err)
+
+	exitCode := 3
+	n.Notify(NotifyEvent{Event: NotifyJobFailed, Name: "example", JobType: JobTypeForceBackup, ExitCode: &exitCode, Error: "boom", LogTail: "last line"})
+	n.Wait(time.Second)
+
+	byPath := map[string]map[string]any{}
+	for _, req := range requests() {
+		byPath[req.path] = req.body
+	}
+
+	require.Len(t, byPath, 5)
+
+	require.Equal(t, NotifyJobFailed, byPath["/generic"]["event"])
+	require.Equal(t, "example", byPath["/generic"]["name"])
+	require.Equal(t, 3.0, byPath["/generic"]["exit_code"])
+	require.Equal(t, "last line", byPath["/generic"]["log_tail"])
+
+	message := "maestro: force-backup of example failed\nexit code: 3\nerror: boom\nlogs:\nlast line"
+
+	require.Equal(t, message, byPath["/slack"]["text"])
+	require.Equal(t, message, byPath["/discord"]["content"])
+
+	require.Equal(t, "maestro: force-backup of example failed", byPath["/message"]["title"])
+	require.Equal(t, message, byPath["/message"]["message"])
+	require.Equal(t, 8.0, byPath["/message"]["priority"])
+
+	require.Equal(t, "backups", byPath["/ntfy"]["topic"])
+	require.Equal(t, message, byPath["/ntfy"]["message"])
+}
+
+func TestNotifierRetries(t *testing.T) {
+	srv, requests := newWebhookServer(t, 2)
+
+	n, err := NewNotifier([]string{srv.URL}, 2)
+	require.NoError(t, err)
+	n.retryDelay = time.Millisecond
+
+	n.Notify(NotifyEvent{Event: NotifyBackuperCreated, Name: "example"})
+	n.Wait(time.Second)
+
+	require.Len(t, requests(), 1)
+	require.Equal(t, NotifyBackuperCreated, requests()[0].body["event"])
+}
+
+func TestNotifierInvalidUrl(t *testing.T) {
+	for _, raw := range []string{"teams+https://example.com", "ftp://example.com", "slack+example.com"} {
+		_, err := NewNotifier([]string{raw}, 0)
+		require.Error(t, err, raw)
+	}
+}
+
+func TestTailWriter(t *testing.T) {
+	tw := newTailWriter(3)
+
+	for i := range 5 {
+		fmt.Fprintf(tw, "line%d\n", i)
+	}
+
+	fmt.Fprint(tw, "unfinished")
+
+	require.Equal(t, "line3\nline4\nunfinished", tw.String())
+}
+
+func TestNotifyForceBackupFailed(t *testing.T) {
+	srv, requests := newWebhookServer(t, 0)
+
+	tm := newTestMngr(t, []string{"example"}, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	var err error
+	tm.mngr.notifier, err = NewNotifier([]string{srv.URL}, 0)
+	require.NoError(t, err)
+
+	tm.expectImageList([]string{"alpine:latest"})
+	tm.expectForceBackupRun("example", "3")
+
+	// non-zero exit code is not an error of force-backup call, but it is notified as failure
+	require.NoError(t, tm.mngr.ForceBackup(context.Background(), "example", OneOffOptions{}))
+
+	tm.mngr.notifier.Wait(time.Second)
+
+	require.Len(t, requests(), 1)
+	require.Equal(t, NotifyJobFailed, requests()[0].body["event"])
+	require.Equal(t, JobTypeForceBackup, requests()[0].body["job_type"])
+	require.Equal(t, 3.0, requests()[0].body["exit_code"])
+	require.Equal(t, "one-off container exited with code 3", requests()[0].body["error"])
+}
@@ -0,0 +1,497 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-units"
+	controlapi "github.com/moby/buildkit/api/services/control"
+)
+
+// Modes of build and pull progress output of cli commands
+const (
+	ProgressAuto  = "auto"
+	ProgressPlain = "plain"
+	ProgressTTY   = "tty"
+	ProgressQuiet = "quiet"
+)
+
+// lines of build step log kept to be shown when step fails
+const stepLogLines = 10
+
+// progressRenderer shows progress of one build or pull
+type progressRenderer interface {
+	buildStatus(status *controlapi.StatusResponse)
+	// buildStream is output of classic builder and messages of daemon
+	buildStream(line string)
+	pullStatus(line pullRespLine)
+	finish(err error)
+}
+
+type progressOutput struct {
+	mode   string
+	out    io.Writer
+	screen *ttyScreen
+}
+
+// SetProgress sets how cli commands show build and pull progress. Auto is tty if out is terminal and plain otherwise
+func (mngr *ContainerManager) SetProgress(mode string, out io.Writer) error {
+	switch mode {
+	case ProgressAuto:
+		mode = ProgressPlain
+
+		if f, ok := out.(*os.File); ok {
+			if fi, err := f.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+				mode = ProgressTTY
+			}
+		}
+	case ProgressPlain, ProgressTTY, ProgressQuiet:
+	default:
+		return fmt.Errorf("unknown progress '%s', must be one of %s, %s, %s, %s", mode, ProgressAuto, ProgressPlain, ProgressTTY, ProgressQuiet)
+	}
+
+	mngr.progress = progressOutput{mode: mode, out: out, screen: &ttyScreen{w: out}}
+
+	return nil
+}
+
+func (mngr *ContainerManager) newProgress(action, image string) progressRenderer {
+	switch mngr.progress.mode {
+	case ProgressPlain:
+		return &plainProgress{w: mngr.progress.out, image: image, steps: newBuildSteps(), layers: newPullLayers()}
+	case ProgressTTY:
+		return &ttyProgress{screen: mngr.progress.screen, action: action, image: image, start: time.Now(), steps: newBuildSteps(), layers: newPullLayers()}
+	case ProgressQuiet:
+		return quietProgress{}
+	}
+
+	// daemon writes raw progress to logs
+	return &logProgress{log: progressLog(action, image)}
+}
+
+type buildStep struct {
+	num       int
+	name      string
+	started   time.Time
+	completed time.Time
+	cached    bool
+	err       string
+	logs      []string
+}
+
+func (step *buildStep) done() bool {
+	return step.cached || !step.completed.IsZero()
+}
+
+func (step *buildStep) duration(now time.Time) time.Duration {
+	if step.started.IsZero() {
+		return 0
+	}
+
+	if !step.completed.IsZero() {
+		now = step.completed
+	}
+
+	return now.Sub(step.started).Round(100 * time.Millisecond)
+}
+
+// buildSteps aggregates BuildKit vertexes, which are sent many times while they change, into steps
+type buildSteps struct {
+	byDigest map[string]*buildStep
+	order    []*buildStep
+}
+
+func newBuildSteps() *buildSteps {
+	return &buildSteps{byDigest: map[string]*buildStep{}}
+}
+
+func (steps *buildSteps) get(digest string) *buildStep {
+	step, ok := steps.byDigest[digest]
+	if !ok {
+		step = &buildStep{num: len(steps.order) + 1}
+		steps.byDigest[digest] = step
+		steps.order = append(steps.order, step)
+	}
+
+	return step
+}
+
+// update applies vertexes and logs of status, returns steps in order they changed
+func (steps *buildSteps) update(status *controlapi.StatusResponse) []*buildStep {
+	var changed []*buildStep
+
+	for _, v := range status.Vertexes {
+		step := steps.get(v.Digest)
+
+		step.name = v.Name
+		step.cached = step.cached || v.Cached
+		step.err = v.Error
+
+		if v.Started != nil {
+			step.started = v.Started.AsTime()
+		}
+
+		if v.Completed != nil {
+			step.completed = v.Completed.AsTime()
+		}
+
+		changed = append(changed, step)
+	}
+
+	for _, l := range status.Logs {
+		step := steps.get(l.Vertex)
+
+		step.logs = append(step.logs, strings.Split(strings.TrimSuffix(string(l.Msg), "\n"), "\n")...)
+
+		if len(step.logs) > stepLogLines {
+			step.logs = step.logs[len(step.logs)-stepLogLines:]
+		}
+	}
+
+	return changed
+}
+
+type pullLayer struct {
+	status  string
+	current int64
+	total   int64
+}
+
+// pullLayers collapses per layer pull progress into summary of image
+type pullLayers struct {
+	byId  map[string]*pullLayer
+	order []string
+}
+
+func newPullLayers() *pullLayers {
+	return &pullLayers{byId: map[string]*pullLayer{}}
+}
+
+// update returns false if line is not about layer, e.g. pulling from, digest or status message
+func (layers *pullLayers) update(line pullRespLine) bool {
+	if len(line.Id) == 0 || strings.HasPrefix(line.Status, "Pulling from") {
+		return false
+	}
+
+	layer, ok := layers.byId[line.Id]
+	if !ok {
+		layer = &pullLayer{}
+		layers.byId[line.Id] = layer
+		layers.order = append(layers.order, line.Id)
+	}
+
+	layer.status = line.Status
+
+	if line.Status == "Downloading" {
+		layer.current = line.ProgressDetail.Current
+		layer.total = line.ProgressDetail.Total
+	}
+
+	if line.Status == "Download complete" {
+		layer.current = layer.total
+	}
+
+	return true
+}
+
+func (layers *pullLayers) summary() string {
+	var (
+		done, existed  int
+		current, total int64
+	)
+
+	for _, id := range layers.order {
+		layer := layers.byId[id]
+
+		switch layer.status {
+		case "Pull complete":
+			done++
+		case "Already exists":
+			done++
+			existed++
+		}
+
+		if layer.total > 0 {
+			current += layer.current
+			total += layer.total
+		}
+	}
+
+	summary := fmt.Sprintf("%d/%d layers", done, len(layers.order))
+
+	if existed > 0 {
+		summary += fmt.Sprintf(" (%d already exist)", existed)
+	}
+
+	if total > 0 {
+		summary += fmt.Sprintf(", %s/%s", units.HumanSize(float64(current)), units.HumanSize(float64(total)))
+	}
+
+	return summary
+}
+
+// logProgress writes every progress line to logs, same as daemon always did
+type logProgress struct {
+	log *slog.Logger
+}
+
+func (p *logProgress) buildStatus(status *controlapi.StatusResponse) {
+	for _, v := range status.Vertexes {
+		p.log.Debug(v.Name)
+	}
+	for _, v := range status.Logs {
+		p.log.Debug(strings.TrimSuffix(string(v.Msg), "\n"))
+	}
+	for _, v := range status.Statuses {
+		p.log.Debug(v.ID)
+	}
+	for _, v := range status.Warnings {
+		p.log.Warn(string(v.Short))
+	}
+}
+
+func (p *logProgress) buildStream(line string) {
+	p.log.Debug(line)
+}
+
+func (p *logProgress) pullStatus(line pullRespLine) {
+	if len(line.Message) > 0 {
+		p.log.Debug(line.Message)
+	} else {
+		p.log.Debug(line.Status, "layer", line.Id, "progress", line.Progress)
+	}
+}
+
+func (p *logProgress) finish(err error) {
+	if err != nil {
+		p.log.Debug(err.Error())
+	}
+}
+
+type quietProgress struct{}
+
+func (quietProgress) buildStatus(*controlapi.StatusResponse) {}
+func (quietProgress) buildStream(string)                     {}
+func (quietProgress) pullStatus(pullRespLine)                {}
+func (quietProgress) finish(error)                           {}
+
+// plainProgress prints line when build step starts and finishes, step logs and pull summary
+type plainProgress struct {
+	w      io.Writer
+	image  string
+	steps  *buildSteps
+	layers *pullLayers
+
+	printedStart map[*buildStep]bool
+	printedDone  map[*buildStep]bool
+}
+
+func (p *plainProgress) printf(format string, args ...any) {
+	fmt.Fprintf(p.w, format+"\n", args...)
+}
+
+func (p *plainProgress) buildStatus(status *controlapi.StatusResponse) {
+	if p.printedStart == nil {
+		p.printedStart = map[*buildStep]bool{}
+		p.printedDone = map[*buildStep]bool{}
+	}
+
+	for _, step := range p.steps.update(status) {
+		if !p.printedStart[step] && (!step.started.IsZero() || step.cached) {
+			p.printedStart[step] = true
+			p.printf("#%d %s", step.num, step.name)
+		}
+
+		if p.printedDone[step] || !step.done() {
+			continue
+		}
+
+		p.printedDone[step] = true
+
+		switch {
+		case step.cached:
+			p.printf("#%d CACHED", step.num)
+		case len(step.err) > 0:
+			p.printf("#%d ERROR %s", step.num, step.err)
+		default:
+			p.printf("#%d DONE %s", step.num, step.duration(time.Now()))
+		}
+	}
+
+	for _, l := range status.Logs {
+		step := p.steps.get(l.Vertex)
+
+		for _, line := range strings.Split(strings.TrimSuffix(string(l.Msg), "\n"), "\n") {
+			p.printf("#%d %s", step.num, line)
+		}
+	}
+
+	for _, w := range status.Warnings {
+		p.printf("WARNING: %s", w.Short)
+	}
+}
+
+func (p *plainProgress) buildStream(line string) {
+	p.printf("%s", line)
+}
+
+func (p *plainProgress) pullStatus(line pullRespLine) {
+	if p.layers.update(line) {
+		return
+	}
+
+	if len(line.Message) > 0 {
+		p.printf("%s", line.Message)
+	} else {
+		p.printf("%s", line.Status)
+	}
+}
+
+func (p *plainProgress) finish(err error) {
+	if len(p.layers.order) > 0 {
+		p.printf("%s: %s", p.image, p.layers.summary())
+	}
+
+	if err != nil {
+		p.printf("ERROR %s", err)
+	}
+}
+
+// ttyProgress redraws block of lines of build or pull on every update
+type ttyProgress struct {
+	screen  *ttyScreen
+	section *ttySection
+	action  string
+	image   string
+	start   time.Time
+	end     time.Time
+	steps   *buildSteps
+	layers  *pullLayers
+	err     error
+}
+
+func (p *ttyProgress) buildStatus(status *controlapi.StatusResponse) {
+	p.steps.update(status)
+	p.redraw()
+}
+
+func (p *ttyProgress) buildStream(line string) {
+	// classic builder output has no steps, so last line is shown as is
+	step := p.steps.get("")
+	step.name = line
+	step.started = time.Now()
+	p.redraw()
+}
+
+func (p *ttyProgress) pullStatus(line pullRespLine) {
+	p.layers.update(line)
+	p.redraw()
+}
+
+func (p *ttyProgress) finish(err error) {
+	p.err = err
+	p.end = time.Now()
+	p.redraw()
+}
+
+func (p *ttyProgress) redraw() {
+	now := time.Now()
+	if !p.end.IsZero() {
+		now = p.end
+	}
+
+	elapsed := now.Sub(p.start).Round(100 * time.Millisecond)
+
+	var lines []string
+
+	if p.action == "pull" {
+		lines = append(lines, fmt.Sprintf("[+] Pulling %s %s: %s", p.image, elapsed, p.layers.summary()))
+	} else {
+		done := 0
+		for _, step := range p.steps.order {
+			if step.done() {
+				done++
+			}
+		}
+
+		lines = append(lines, fmt.Sprintf("[+] Building %s %s (%d/%d)", p.image, elapsed, done, len(p.steps.order)))
+
+		for _, step := range p.steps.order {
+			switch {
+			case step.cached:
+				lines = append(lines, fmt.Sprintf(" => CACHED %s", step.name))
+			case len(step.err) > 0:
+				lines = append(lines, fmt.Sprintf(" => ERROR %s %s", step.name, step.duration(now)))
+
+				for _, log := range step.logs {
+					lines = append(lines, "    "+log)
+				}
+			default:
+				lines = append(lines, fmt.Sprintf(" => %s %s", step.name, step.duration(now)))
+			}
+		}
+	}
+
+	if p.err != nil {
+		lines = append(lines, "ERROR "+p.err.Error())
+	}
+
+	if p.section == nil {
+		p.section = p.screen.add()
+	}
+
+	p.screen.update(p.section, lines)
+}
+
+type ttySection struct {
+	lines []string
+}
+
+// ttyScreen keeps progress of images built or pulled at the same time in separate blocks and redraws them together
+type ttyScreen struct {
+	mu       sync.Mutex
+	w        io.Writer
+	sections []*ttySection
+	drawn    int
+}
+
+func (s *ttyScreen) add() *ttySection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	section := &ttySection{}
+	s.sections = append(s.sections, section)
+
+	return section
+}
+
+func (s *ttyScreen) update(section *ttySection, lines []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	section.lines = lines
+
+	var b strings.Builder
+
+	// move cursor to first drawn line and clear screen below it
+	if s.drawn > 0 {
+		fmt.Fprintf(&b, "\033[%dF\033[J", s.drawn)
+	}
+
+	s.drawn = 0
+
+	for _, sec := range s.sections {
+		for _, line := range sec.lines {
+			b.WriteString(line)
+			b.WriteString("\n")
+			s.drawn++
+		}
+	}
+
+	io.WriteString(s.w, b.String())
+}
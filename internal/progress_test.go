@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func buildStatusSequence() []*controlapi.StatusResponse {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return []*controlapi.StatusResponse{
+		{Vertexes: []*controlapi.Vertex{
+			{Digest: "sha256:1", Name: "[1/2] FROM alpine", Started: timestamppb.New(start), Cached: true},
+			{Digest: "sha256:2", Name: "[2/2] RUN make", Started: timestamppb.New(start)},
+		}},
+		{Logs: []*controlapi.VertexLog{{Vertex: "sha256:2", Msg: []byte("compiling\nlinking\n")}}},
+		{Vertexes: []*controlapi.Vertex{
+			{Digest: "sha256:2", Name: "[2/2] RUN make", Started: timestamppb.New(start), Completed: timestamppb.New(start.Add(1500 * time.Millisecond))},
+		}},
+		// vertexes are sent again while they change, steps are printed once
+		{Vertexes: []*controlapi.Vertex{
+			{Digest: "sha256:2", Name: "[2/2] RUN make", Started: timestamppb.New(start), Completed: timestamppb.New(start.Add(1500 * time.Millisecond))},
+			{Digest: "sha256:3", Name: "exporting to image", Started: timestamppb.New(start), Completed: timestamppb.New(start), Error: "no space left"},
+		}, Logs: []*controlapi.VertexLog{{Vertex: "sha256:3", Msg: []byte("writing layer\n")}}},
+	}
+}
+
+func pullStatusSequence() []pullRespLine {
+	lines := []pullRespLine{
+		{Status: "Pulling from library/alpine", Id: "latest"},
+		{Status: "Already exists", Id: "aaa"},
+		{Status: "Pulling fs layer", Id: "bbb"},
+		{Status: "Downloading", Id: "bbb"},
+		{Status: "Download complete", Id: "bbb"},
+		{Status: "Pull complete", Id: "bbb"},
+		{Status: "Digest: sha256:123"},
+		{Status: "Status: Downloaded newer image for alpine:latest"},
+	}
+
+	lines[3].ProgressDetail.Current = 1000000
+	lines[3].ProgressDetail.Total = 3000000
+
+	return lines
+}
+
+func TestProgressPlainBuild(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	var out bytes.Buffer
+	require.NoError(t, tm.mngr.SetProgress(ProgressPlain, &out))
+
+	progress := tm.mngr.newProgress("build", "backup:latest")
+
+	for _, status := range buildStatusSequence() {
+		progress.buildStatus(status)
+	}
+
+	progress.finish(errors.New("build failed"))
+
+	require.Equal(t, `#1 [1/2] FROM alpine
+#1 CACHED
+#2 [2/2] RUN make
+#2 compiling
+#2 linking
+#2 DONE 1.5s
+#3 exporting to image
+#3 ERROR no space left
+#3 writing layer
+ERROR build failed
+`, out.String())
+}
+
+func TestProgressPlainPull(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	var out bytes.Buffer
+	require.NoError(t, tm.mngr.SetProgress(ProgressPlain, &out))
+
+	progress := tm.mngr.newProgress("pull", "alpine:latest")
+
+	for _, line := range pullStatusSequence() {
+		progress.pullStatus(line)
+	}
+
+	progress.finish(nil)
+
+	// layers are collapsed into summary
+	require.Equal(t, `Pulling from library/alpine
+Digest: sha256:123
+Status: Downloaded newer image for alpine:latest
+alpine:latest: 2/2 layers (1 already exist), 3MB/3MB
+`, out.String())
+}
+
+func TestProgressTTY(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	var out bytes.Buffer
+	require.NoError(t, tm.mngr.SetProgress(ProgressTTY, &out))
+
+	build := tm.mngr.newProgress("build", "backup:latest")
+	pull := tm.mngr.newProgress("pull", "alpine:latest")
+
+	for _, status := range buildStatusSequence() {
+		build.buildStatus(status)
+	}
+
+	for _, line := range pullStatusSequence() {
+		pull.pullStatus(line)
+	}
+
+	build.finish(nil)
+	pull.finish(nil)
+
+	// every update redraws all blocks, last redraw is the final state
+	redraws := strings.Split(out.String(), "\033[J")
+	last := redraws[len(redraws)-1]
+
+	require.Contains(t, last, "[+] Building backup:latest")
+	require.Contains(t, last, "(3/3)")
+	require.Contains(t, last, " => CACHED [1/2] FROM alpine\n")
+	require.Contains(t, last, " => [2/2] RUN make 1.5s\n")
+	require.Contains(t, last, " => ERROR exporting to image 0s\n    writing layer\n")
+	require.Contains(t, last, "[+] Pulling alpine:latest")
+	require.Contains(t, last, "2/2 layers (1 already exist), 3MB/3MB\n")
+	require.Contains(t, out.String(), "\033[6F\033[J"+last)
+}
+
+func TestProgressQuiet(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	var out bytes.Buffer
+	require.NoError(t, tm.mngr.SetProgress(ProgressQuiet, &out))
+
+	progress := tm.mngr.newProgress("build", "backup:latest")
+
+	for _, status := range buildStatusSequence() {
+		progress.buildStatus(status)
+	}
+
+	progress.finish(errors.New("build failed"))
+
+	require.Empty(t, out.String())
+}
+
+func TestSetProgress(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	// buffer is not a terminal
+	require.NoError(t, tm.mngr.SetProgress(ProgressAuto, &bytes.Buffer{}))
+	require.Equal(t, ProgressPlain, tm.mngr.progress.mode)
+
+	require.Error(t, tm.mngr.SetProgress("fancy", &bytes.Buffer{}))
+}
+
+func TestPullProgress(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	var out bytes.Buffer
+	require.NoError(t, tm.mngr.SetProgress(ProgressPlain, &out))
+
+	resp := `{"status":"Pulling from library/alpine","id":"latest"}
+{"status":"Downloading","id":"bbb","progressDetail":{"current":500,"total":1000}}
+{"status":"Pull complete","id":"bbb"}
+`
+
+	tm.docker.EXPECT().ImagePull(mock.Anything, "alpine:latest", mock.Anything).Return(io.NopCloser(strings.NewReader(resp)), nil).Once()
+
+	require.NoError(t, tm.mngr.pullImage(context.Background(), "alpine", PullAlways))
+	require.Equal(t, "Pulling from library/alpine\nalpine:latest: 1/1 layers, 500B/1kB\n", out.String())
+}
@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+)
+
+// jobTicket is one-off container waiting in queue or running
+type jobTicket struct {
+	name     string
+	group    string
+	priority int
+	seq      uint64
+
+	ready   chan struct{}
+	granted bool
+}
+
+// jobQueue limits how many one-off containers run at once. Waiting containers are started by priority,
+// then in order they were queued. Containers of the same group run one after another
+type jobQueue struct {
+	mu sync.Mutex
+
+	// 0 means no limit
+	limit   int
+	running int
+	groups  map[string]bool
+	waiting []*jobTicket
+	seq     uint64
+}
+
+func newJobQueue(limit int) *jobQueue {
+	return &jobQueue{
+		limit:  limit,
+		groups: map[string]bool{},
+	}
+}
+
+// acquire waits for turn of one-off container. Returned release must be called when container is over
+func (q *jobQueue) acquire(ctx context.Context, name string, group string, priority int) (release func(), err error) {
+	q.mu.Lock()
+
+	q.seq++
+	ticket := &jobTicket{name: name, group: group, priority: priority, seq: q.seq, ready: make(chan struct{})}
+	q.waiting = append(q.waiting, ticket)
+
+	q.dispatch()
+
+	if !ticket.granted {
+		slog.Info("one-off container queued", logKeyBackupName, name, "group", group, "priority", priority, "running", q.running)
+	}
+
+	q.mu.Unlock()
+
+	release = func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		q.running--
+		delete(q.groups, ticket.group)
+
+		q.dispatch()
+	}
+
+	select {
+	case <-ticket.ready:
+		return release, nil
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// turn came at the same time as cancel
+	if ticket.granted {
+		q.running--
+		delete(q.groups, ticket.group)
+	} else {
+		q.waiting = slices.DeleteFunc(q.waiting, func(waiting *jobTicket) bool {
+			return waiting == ticket
+		})
+	}
+
+	q.dispatch()
+
+	return nil, ctx.Err()
+}
+
+// dispatch starts waiting tickets while limit allows. Ticket of busy group does not block tickets after it
+func (q *jobQueue) dispatch() {
+	slices.SortStableFunc(q.waiting, func(a, b *jobTicket) int {
+		if a.priority != b.priority {
+			return cmp.Compare(b.priority, a.priority)
+		}
+
+		return cmp.Compare(a.seq, b.seq)
+	})
+
+	waiting := q.waiting[:0]
+
+	for _, ticket := range q.waiting {
+		if (q.limit > 0 && q.running >= q.limit) || (len(ticket.group) > 0 && q.groups[ticket.group]) {
+			waiting = append(waiting, ticket)
+			continue
+		}
+
+		q.running++
+		if len(ticket.group) > 0 {
+			q.groups[ticket.group] = true
+		}
+
+		ticket.granted = true
+		close(ticket.ready)
+	}
+
+	clear(q.waiting[len(waiting):])
+	q.waiting = waiting
+}
+
+// jobOrder returns group and priority of backup name set by labels of container to backup
+func (mngr *ContainerManager) jobOrder(ctx context.Context, name string) (string, int, error) {
+	var target *types.Container
+
+	if mngr.conf.Swarm {
+		svc, err := mngr.getTargetService(ctx, name)
+		if err != nil {
+			return "", 0, err
+		}
+
+		if svc != nil {
+			target = serviceTarget(svc)
+		}
+	}
+
+	if target == nil {
+		var err error
+
+		target, err = mngr.getTargetByName(ctx, name, true)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+
+	if target == nil {
+		return "", 0, nil
+	}
+
+	group, priority := mngr.targetOrder(name, target)
+
+	return group, priority, nil
+}
+
+// targetOrder returns group and priority labels of container to backup. Invalid priority is logged
+// and counted as default one, so typo in label does not stop backups
+func (mngr *ContainerManager) targetOrder(name string, target *types.Container) (string, int) {
+	group := target.Labels[mngr.labels.backupGroup]
+
+	value, ok := target.Labels[mngr.labels.backupPriority]
+	if !ok {
+		return group, 0
+	}
+
+	priority, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("invalid backup priority, default is used", logKeyBackupName, name, "priority", value, logKeyError, err)
+		return group, 0
+	}
+
+	return group, priority
+}
+
+// runQueued runs one-off containers of names. Without MAX_CONCURRENT_JOBS they run one by one by priority
+// until first failure. Otherwise all of them are queued at once, and failure of one does not stop others
+func (mngr *ContainerManager) runQueued(ctx context.Context, names []string, opts OneOffOptions, run func(ctx context.Context, name string, opts OneOffOptions) error) error {
+	if mngr.jobQueue.limit <= 0 {
+		priorities := map[string]int{}
+
+		for _, name := range names {
+			_, priority, err := mngr.jobOrder(ctx, name)
+			if err != nil {
+				return err
+			}
+
+			priorities[name] = priority
+		}
+
+		slices.SortStableFunc(names, func(a, b string) int {
+			return cmp.Compare(priorities[b], priorities[a])
+		})
+
+		for _, name := range names {
+			err := run(ctx, name, opts)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if opts.Output != nil {
+		opts.Output = &syncWriter{w: opts.Output}
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+
+	for _, name := range names {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			err := run(ctx, name, opts)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// syncWriter serializes writes of one-off containers running at the same time to shared output
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (sw *syncWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	return sw.w.Write(p)
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// acquireAsync queues ticket and sends its release once it gets turn
+func acquireAsync(q *jobQueue, name string, group string, priority int) chan func() {
+	granted := make(chan func(), 1)
+
+	go func() {
+		release, err := q.acquire(context.Background(), name, group, priority)
+		if err == nil {
+			granted <- release
+		}
+	}()
+
+	return granted
+}
+
+func waitingCount(q *jobQueue) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.waiting)
+}
+
+func TestJobQueuePriority(t *testing.T) {
+	q := newJobQueue(1)
+
+	release, err := q.acquire(context.Background(), "first", "", 0)
+	require.NoError(t, err)
+
+	low := acquireAsync(q, "low", "", 0)
+	require.Eventually(t, func() bool { return waitingCount(q) == 1 }, time.Second, time.Millisecond)
+
+	high := acquireAsync(q, "high", "", 10)
+	require.Eventually(t, func() bool { return waitingCount(q) == 2 }, time.Second, time.Millisecond)
+
+	release()
+
+	releaseHigh := <-high
+	require.Empty(t, low)
+
+	releaseHigh()
+	(<-low)()
+
+	require.Zero(t, q.running)
+}
+
+func TestJobQueueGroup(t *testing.T) {
+	q := newJobQueue(0)
+
+	release, err := q.acquire(context.Background(), "db1", "nas", 0)
+	require.NoError(t, err)
+
+	second := acquireAsync(q, "db2", "nas", 0)
+	require.Eventually(t, func() bool { return waitingCount(q) == 1 }, time.Second, time.Millisecond)
+
+	// busy group does not block others
+	releaseOther, err := q.acquire(context.Background(), "app", "", 0)
+	require.NoError(t, err)
+	releaseOther()
+
+	require.Empty(t, second)
+
+	release()
+	(<-second)()
+
+	require.Empty(t, q.groups)
+}
+
+func TestJobQueueCancel(t *testing.T) {
+	q := newJobQueue(1)
+
+	release, err := q.acquire(context.Background(), "first", "", 0)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = q.acquire(ctx, "second", "", 0)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Zero(t, waitingCount(q))
+
+	release()
+
+	release, err = q.acquire(context.Background(), "third", "", 0)
+	require.NoError(t, err)
+	release()
+}
+
+func TestForceBackupAllPriority(t *testing.T) {
+	tm := newTestMngr(t, []string{"low", "high"}, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	tm.liveBackupCntrs["high"].Labels[tm.mngr.labels.backupPriority] = "10"
+
+	tm.expectImageList([]string{"alpine:latest"})
+
+	// events streams are handed out in order of expectations, so containers must run in this order
+	tm.expectForceBackupRun("high", "0")
+	tm.expectForceBackupRun("low", "0")
+
+	require.NoError(t, tm.mngr.ForceBackupAll(context.Background(), false, OneOffOptions{}))
+
+	high, err := tm.mngr.backups.get("high")
+	require.NoError(t, err)
+
+	low, err := tm.mngr.backups.get("low")
+	require.NoError(t, err)
+
+	require.True(t, high.LastJob.At.Before(low.LastJob.At))
+}
+
+func TestForceBackupAllLimit(t *testing.T) {
+	tm := newTestMngr(t, []string{"example", "example2"}, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	tm.mngr.jobQueue = newJobQueue(2)
+
+	tm.expectImageList([]string{"alpine:latest"})
+
+	tm.expectForceBackupRun("example", "0")
+
+	// failure of one container does not stop the other
+	tm.docker.EXPECT().ContainerCreate(mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "docker-backup-maestro.forcebackup_example2").Return(container.CreateResponse{}, errors.New("no space left on device")).Once()
+
+	err := tm.mngr.ForceBackupAll(context.Background(), false, OneOffOptions{})
+	require.ErrorContains(t, err, "no space left on device")
+
+	state, err := tm.mngr.backups.get("example")
+	require.NoError(t, err)
+	require.Equal(t, "0", state.LastJob.Result)
+}
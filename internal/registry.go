@@ -0,0 +1,392 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+)
+
+// docker hub credentials are stored under this key in config.json and in credential helpers
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+const dockerHubHost = "docker.io"
+
+// REGISTRY_AUTH_<host>=user:password or REGISTRY_AUTH_<host>_FILE=<path to file with user:password>.
+// In host every character except letters and digits is replaced with '_', e.g. REGISTRY_AUTH_REGISTRY_EXAMPLE_COM_5000.
+// REGISTRY_AUTH_<host>_HOST=<registry host> keeps original host, which could not be restored from env form
+const (
+	registryAuthEnvPrefix     = "REGISTRY_AUTH_"
+	registryAuthEnvFileSuffix = "_FILE"
+	registryAuthEnvHostSuffix = "_HOST"
+)
+
+const credentialHelperTimeout = 10 * time.Second
+
+type dockerConfigFile struct {
+	Auths       map[string]registry.AuthConfig `json:"auths"`
+	CredsStore  string                         `json:"credsStore"`
+	CredHelpers map[string]string              `json:"credHelpers"`
+}
+
+// credentialHelper runs docker-credential-<helper> with action (get, list) and input on stdin
+type credentialHelper func(ctx context.Context, helper, action, input string) ([]byte, error)
+
+// registryAuth resolves registry credentials from docker config.json (stored auths and credential
+// helpers) and REGISTRY_AUTH_<host> env vars, env vars take precedence. Zero value has no credentials
+type registryAuth struct {
+	// by registry host
+	auths map[string]registry.AuthConfig
+	// by env form of registry host
+	envAuths map[string]registry.AuthConfig
+	// original registry hosts set by REGISTRY_AUTH_<host>_HOST, by env form of registry host
+	envHosts map[string]string
+
+	credsStore  string
+	credHelpers map[string]string
+
+	runHelper credentialHelper
+}
+
+func loadRegistryAuth(configPath string, environ []string) (*registryAuth, error) {
+	ra := &registryAuth{
+		auths:       map[string]registry.AuthConfig{},
+		envAuths:    map[string]registry.AuthConfig{},
+		envHosts:    map[string]string{},
+		credHelpers: map[string]string{},
+		runHelper:   execCredentialHelper,
+	}
+
+	if len(configPath) > 0 {
+		err := ra.loadDockerConfig(configPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(key, registryAuthEnvPrefix) {
+			continue
+		}
+
+		host := strings.TrimPrefix(key, registryAuthEnvPrefix)
+
+		if strings.HasSuffix(host, registryAuthEnvHostSuffix) {
+			host = strings.TrimSuffix(host, registryAuthEnvHostSuffix)
+
+			if envRegistryHost(value) != envRegistryHost(host) {
+				return nil, fmt.Errorf("%s is %s, but it must be registry host of %s%s", key, value, registryAuthEnvPrefix, host)
+			}
+
+			ra.envHosts[envRegistryHost(host)] = value
+
+			continue
+		}
+
+		if strings.HasSuffix(host, registryAuthEnvFileSuffix) {
+			host = strings.TrimSuffix(host, registryAuthEnvFileSuffix)
+
+			data, err := os.ReadFile(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s - %w", key, err)
+			}
+
+			value = strings.TrimSpace(string(data))
+		}
+
+		username, password, found := strings.Cut(value, ":")
+		if !found || len(username) == 0 {
+			return nil, fmt.Errorf("%s must be in form user:password", key)
+		}
+
+		ra.envAuths[envRegistryHost(host)] = registry.AuthConfig{Username: username, Password: password}
+	}
+
+	return ra, nil
+}
+
+func (ra *registryAuth) loadDockerConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to read docker config %s - %w", path, err)
+	}
+
+	var cfg dockerConfigFile
+
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return fmt.Errorf("failed to parse docker config %s - %w", path, err)
+	}
+
+	for key, auth := range cfg.Auths {
+		// auth is base64 of user:password, as written by docker login
+		if len(auth.Auth) > 0 && len(auth.Username) == 0 {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return fmt.Errorf("invalid auth of %s in docker config %s - %w", key, path, err)
+			}
+
+			auth.Username, auth.Password, _ = strings.Cut(string(decoded), ":")
+		}
+
+		auth.Auth = ""
+		auth.ServerAddress = key
+
+		ra.auths[registryHost(key)] = auth
+	}
+
+	ra.credsStore = cfg.CredsStore
+
+	for key, helper := range cfg.CredHelpers {
+		ra.credHelpers[registryHost(key)] = helper
+	}
+
+	return nil
+}
+
+// forImage returns credentials of image registry, nil if there are none
+func (ra *registryAuth) forImage(ctx context.Context, ref string) (*registry.AuthConfig, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference %s - %w", ref, err)
+	}
+
+	return ra.forHost(ctx, reference.Domain(named))
+}
+
+func (ra *registryAuth) forHost(ctx context.Context, host string) (*registry.AuthConfig, error) {
+	if auth, ok := ra.envAuths[envRegistryHost(host)]; ok {
+		auth.ServerAddress = helperServerUrl(host)
+		return &auth, nil
+	}
+
+	if helper, ok := ra.credHelpers[host]; ok {
+		return ra.fromHelper(ctx, helper, helperServerUrl(host))
+	}
+
+	if auth, ok := ra.auths[host]; ok {
+		return &auth, nil
+	}
+
+	if len(ra.credsStore) > 0 {
+		return ra.fromHelper(ctx, ra.credsStore, helperServerUrl(host))
+	}
+
+	return nil, nil
+}
+
+// encodedForImage returns credentials of image registry encoded for ImagePull, empty if there are none
+func (ra *registryAuth) encodedForImage(ctx context.Context, ref string) (string, error) {
+	auth, err := ra.forImage(ctx, ref)
+	if err != nil || auth == nil {
+		return "", err
+	}
+
+	return registry.EncodeAuthConfig(*auth)
+}
+
+// all returns credentials of all known registries for ImageBuild, as base images may come from any of them
+func (ra *registryAuth) all(ctx context.Context) (map[string]registry.AuthConfig, error) {
+	auths := map[string]registry.AuthConfig{}
+
+	for _, auth := range ra.auths {
+		auths[auth.ServerAddress] = auth
+	}
+
+	hosts := map[string]string{}
+
+	if len(ra.credsStore) > 0 {
+		stored, err := ra.listHelper(ctx, ra.credsStore)
+		if err != nil {
+			// e.g. config.json of docker desktop mounted without its helper, build may need no credentials at all
+			slog.Warn("credential helper failed, builds get no credentials stored in it", "helper", ra.credsStore, logKeyError, err)
+		}
+
+		for server := range stored {
+			hosts[server] = ra.credsStore
+		}
+	}
+
+	for host, helper := range ra.credHelpers {
+		hosts[helperServerUrl(host)] = helper
+	}
+
+	for server, helper := range hosts {
+		auth, err := ra.fromHelper(ctx, helper, server)
+		if err != nil {
+			return nil, err
+		}
+
+		if auth != nil {
+			auths[server] = *auth
+		}
+	}
+
+	for envHost, auth := range ra.envAuths {
+		host := ra.envHost(envHost)
+		if len(host) == 0 {
+			slog.Warn("registry host of env credentials is unknown, builds get no credentials of it", "env", registryAuthEnvPrefix+envHost+registryAuthEnvHostSuffix)
+			continue
+		}
+
+		server := helperServerUrl(host)
+		auth.ServerAddress = server
+		auths[server] = auth
+	}
+
+	return auths, nil
+}
+
+// envHost returns registry host of REGISTRY_AUTH_<host> env var. Env form is lossy, so host is taken
+// from REGISTRY_AUTH_<host>_HOST or from registries known by docker config, empty if it is unknown
+func (ra *registryAuth) envHost(envHost string) string {
+	if host, ok := ra.envHosts[envHost]; ok {
+		return host
+	}
+
+	known := []string{dockerHubHost}
+
+	for host := range ra.auths {
+		known = append(known, host)
+	}
+
+	for host := range ra.credHelpers {
+		known = append(known, host)
+	}
+
+	for _, host := range known {
+		if envRegistryHost(host) == envHost {
+			return host
+		}
+	}
+
+	return ""
+}
+
+// listHelper returns servers credentials are stored for in credential helper
+func (ra *registryAuth) listHelper(ctx context.Context, helper string) (map[string]string, error) {
+	out, err := ra.runHelper(ctx, helper, "list", "")
+	if err != nil {
+		return nil, err
+	}
+
+	stored := map[string]string{}
+
+	err = json.Unmarshal(out, &stored)
+	if err != nil {
+		return nil, fmt.Errorf("invalid list - %w", err)
+	}
+
+	return stored, nil
+}
+
+type credentialHelperOutput struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+func (ra *registryAuth) fromHelper(ctx context.Context, helper, server string) (*registry.AuthConfig, error) {
+	out, err := ra.runHelper(ctx, helper, "get", server)
+	if err != nil {
+		// helpers report missing credentials as error
+		if strings.Contains(string(out)+err.Error(), "credentials not found") {
+			return nil, nil
+		}
+
+		slog.Warn("credential helper failed, registry is accessed without credentials", "helper", helper, "registry", server, logKeyError, err)
+
+		return nil, nil
+	}
+
+	var creds credentialHelperOutput
+
+	err = json.Unmarshal(out, &creds)
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %s returned invalid credentials for %s - %w", helper, server, err)
+	}
+
+	auth := &registry.AuthConfig{ServerAddress: server}
+
+	// identity token is returned with special username
+	if creds.Username == "<token>" {
+		auth.IdentityToken = creds.Secret
+	} else {
+		auth.Username = creds.Username
+		auth.Password = creds.Secret
+	}
+
+	return auth, nil
+}
+
+func execCredentialHelper(ctx context.Context, helper, action, input string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, credentialHelperTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "docker-credential-"+helper, action)
+	cmd.Stdin = strings.NewReader(input)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+// registryHost normalizes config.json auth key (host or url) to registry host
+func registryHost(key string) string {
+	if strings.Contains(key, "://") {
+		parsed, err := url.Parse(key)
+		if err == nil {
+			key = parsed.Host
+		}
+	}
+
+	key, _, _ = strings.Cut(key, "/")
+
+	if key == "index.docker.io" || key == "registry-1.docker.io" {
+		return dockerHubHost
+	}
+
+	return key
+}
+
+// helperServerUrl returns key credentials of registry host are stored under
+func helperServerUrl(host string) string {
+	if host == dockerHubHost {
+		return dockerHubAuthKey
+	}
+
+	return host
+}
+
+// envRegistryHost converts registry host to form used in REGISTRY_AUTH_<host> env var names
+func envRegistryHost(host string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+
+		return '_'
+	}, strings.ToUpper(host))
+}
@@ -0,0 +1,201 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func writeDockerConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+// fakeCredentialHelper serves credentials by server url like docker-credential-<helper> does
+func fakeCredentialHelper(creds map[string]string) credentialHelper {
+	return func(ctx context.Context, helper, action, input string) ([]byte, error) {
+		if action == "list" {
+			list := []string{}
+			for server := range creds {
+				list = append(list, `"`+server+`":"user"`)
+			}
+
+			return []byte("{" + strings.Join(list, ",") + "}"), nil
+		}
+
+		out, ok := creds[input]
+		if !ok {
+			return []byte("credentials not found in native keychain"), errors.New("exit status 1")
+		}
+
+		return []byte(out), nil
+	}
+}
+
+func TestRegistryAuth(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("cfguser:cfgpass"))
+
+	configPath := writeDockerConfig(t, `{
+		"auths": {
+			"registry.example.com": {"auth": "`+auth+`"},
+			"https://index.docker.io/v1/": {"auth": "`+auth+`"},
+			"env.example.com": {"auth": "`+auth+`"}
+		},
+		"credHelpers": {"ghcr.io": "fake"}
+	}`)
+
+	secretPath := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(secretPath, []byte("fileuser:filepass\n"), 0o600))
+
+	ra, err := loadRegistryAuth(configPath, []string{
+		"REGISTRY_AUTH_ENV_EXAMPLE_COM=envuser:envpass",
+		"REGISTRY_AUTH_LOCALHOST_5000_FILE=" + secretPath,
+		"OTHER=value",
+	})
+	require.NoError(t, err)
+
+	ra.runHelper = fakeCredentialHelper(map[string]string{
+		"ghcr.io": `{"ServerURL":"ghcr.io","Username":"<token>","Secret":"token"}`,
+	})
+
+	for _, tc := range []struct {
+		ref      string
+		username string
+		password string
+		token    string
+	}{
+		{"registry.example.com/backup:1", "cfguser", "cfgpass", ""},
+		{"alpine", "cfguser", "cfgpass", ""},
+		{"env.example.com/backup", "envuser", "envpass", ""},
+		{"localhost:5000/backup", "fileuser", "filepass", ""},
+		{"ghcr.io/org/backup", "", "", "token"},
+		{"quay.io/org/backup", "", "", ""},
+	} {
+		got, err := ra.forImage(context.Background(), tc.ref)
+		require.NoError(t, err, tc.ref)
+
+		if len(tc.username) == 0 && len(tc.token) == 0 {
+			require.Nil(t, got, tc.ref)
+			continue
+		}
+
+		require.NotNil(t, got, tc.ref)
+		require.Equal(t, tc.username, got.Username, tc.ref)
+		require.Equal(t, tc.password, got.Password, tc.ref)
+		require.Equal(t, tc.token, got.IdentityToken, tc.ref)
+	}
+
+	all, err := ra.all(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "cfguser", all["registry.example.com"].Username)
+	require.Equal(t, "cfguser", all[dockerHubAuthKey].Username)
+	require.Equal(t, "envuser", all["env.example.com"].Username)
+	require.Equal(t, "token", all["ghcr.io"].IdentityToken)
+}
+
+func TestRegistryAuthConfigErrors(t *testing.T) {
+	_, err := loadRegistryAuth(filepath.Join(t.TempDir(), "missing.json"), nil)
+	require.NoError(t, err)
+
+	_, err = loadRegistryAuth(writeDockerConfig(t, "{"), nil)
+	require.Error(t, err)
+
+	_, err = loadRegistryAuth("", []string{"REGISTRY_AUTH_EXAMPLE_COM=nopassword"})
+	require.Error(t, err)
+
+	_, err = loadRegistryAuth("", []string{"REGISTRY_AUTH_EXAMPLE_COM_FILE=/nonexistent"})
+	require.Error(t, err)
+
+	_, err = loadRegistryAuth("", []string{"REGISTRY_AUTH_EXAMPLE_COM_HOST=example.org"})
+	require.Error(t, err)
+}
+
+func TestRegistryAuthCredsStore(t *testing.T) {
+	ra, err := loadRegistryAuth(writeDockerConfig(t, `{"credsStore": "fake"}`), nil)
+	require.NoError(t, err)
+
+	ra.runHelper = fakeCredentialHelper(map[string]string{
+		dockerHubAuthKey: `{"ServerURL":"https://index.docker.io/v1/","Username":"hubuser","Secret":"hubpass"}`,
+	})
+
+	got, err := ra.forImage(context.Background(), "library/alpine:3")
+	require.NoError(t, err)
+	require.Equal(t, "hubuser", got.Username)
+
+	// missing credentials are not an error, image is pulled anonymously
+	got, err = ra.forImage(context.Background(), "registry.example.com/backup")
+	require.NoError(t, err)
+	require.Nil(t, got)
+
+	all, err := ra.all(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "hubpass", all[dockerHubAuthKey].Password)
+
+	// docker desktop config mounted without its helper
+	ra, err = loadRegistryAuth(writeDockerConfig(t, `{"credsStore": "desktop"}`), []string{"REGISTRY_AUTH_DOCKER_IO=envuser:envpass"})
+	require.NoError(t, err)
+
+	ra.runHelper = func(ctx context.Context, helper, action, input string) ([]byte, error) {
+		return nil, errors.New(`exec: "docker-credential-desktop": executable file not found in $PATH`)
+	}
+
+	all, err = ra.all(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "envuser", all[dockerHubAuthKey].Username)
+}
+
+func TestPullWithRegistryAuth(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "registry.example.com/backup"}})
+
+	var err error
+	tm.mngr.registry, err = loadRegistryAuth("", []string{"REGISTRY_AUTH_REGISTRY_EXAMPLE_COM=user:pass"})
+	require.NoError(t, err)
+
+	tm.docker.EXPECT().ImagePull(mock.Anything, "registry.example.com/backup:latest", mock.Anything).RunAndReturn(func(ctx context.Context, ref string, opts image.PullOptions) (io.ReadCloser, error) {
+		auth, err := registry.DecodeAuthConfig(opts.RegistryAuth)
+		require.NoError(t, err)
+		require.Equal(t, "user", auth.Username)
+		require.Equal(t, "pass", auth.Password)
+
+		return io.NopCloser(strings.NewReader("")), nil
+	}).Once()
+
+	require.NoError(t, tm.mngr.pullImage(context.Background(), "registry.example.com/backup", PullAlways))
+}
+
+func TestBuildWithRegistryAuth(t *testing.T) {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	var err error
+	tm.mngr.registry, err = loadRegistryAuth("", []string{
+		"REGISTRY_AUTH_REGISTRY_EXAMPLE_COM_5000=user:pass",
+		"REGISTRY_AUTH_REGISTRY_EXAMPLE_COM_5000_HOST=registry.example.com:5000",
+		// host is unknown, so it is not passed to build
+		"REGISTRY_AUTH_OTHER_EXAMPLE_COM=other:pass",
+	})
+	require.NoError(t, err)
+
+	tm.expectImageList([]string{})
+
+	tm.docker.EXPECT().ImageBuild(mock.Anything, mock.Anything, mock.Anything).RunAndReturn(func(ctx context.Context, buildCtx io.Reader, opts types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+		require.Equal(t, "user", opts.AuthConfigs["registry.example.com:5000"].Username)
+		require.Len(t, opts.AuthConfigs, 1)
+
+		return types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(""))}, nil
+	}).Once()
+
+	require.NoError(t, tm.mngr.buildImage(context.Background(), &BuildInfo{Context: "."}, "maestro-backup", PullMissing))
+}
@@ -0,0 +1,336 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// label value disabling SCHEDULE_DEFAULT for container
+const ScheduleOff = "off"
+
+// how often targets are rescanned for schedule changes, when no run is due earlier
+const scheduleRefreshInterval = time.Minute
+
+// ScheduleEntry is planned force-backup of backup name
+type ScheduleEntry struct {
+	Host       string     `json:"host,omitempty" yaml:"host,omitempty"`
+	Name       string     `json:"name" yaml:"name"`
+	Schedule   string     `json:"schedule" yaml:"schedule"`
+	NextRun    *time.Time `json:"next_run,omitempty" yaml:"next_run,omitempty"`
+	LastBackup *time.Time `json:"last_backup,omitempty" yaml:"last_backup,omitempty"`
+	// id of running scheduled job, empty if it is not running
+	RunningJob string `json:"running_job,omitempty" yaml:"running_job,omitempty"`
+	Error      string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type scheduleItem struct {
+	spec     string
+	schedule cron.Schedule
+	err      error
+	next     time.Time
+	jobId    string
+}
+
+// scheduler runs force-backups by cron expressions of backup.schedule labels. Runs are started as jobs
+// of daemon registry, so run is skipped while previous run or any other job of the same name is running
+type scheduler struct {
+	mngr *ContainerManager
+	jobs *JobRegistry
+
+	// random delay up to jitter is added to every run
+	jitter  time.Duration
+	catchUp bool
+
+	mu    sync.Mutex
+	items map[string]*scheduleItem
+}
+
+func newScheduler(mngr *ContainerManager, jobs *JobRegistry) *scheduler {
+	return &scheduler{
+		mngr:  mngr,
+		jobs:  jobs,
+		items: map[string]*scheduleItem{},
+	}
+}
+
+// RunScheduler runs force-backups by schedule until ctx is done. Jobs are started in registry of control server
+func (mngr *ContainerManager) RunScheduler(ctx context.Context, jobs *JobRegistry) {
+	if mngr.tmpls.ForceBackup == nil {
+		return
+	}
+
+	sched := newScheduler(mngr, jobs)
+	sched.jitter = mngr.conf.ScheduleJitter
+	sched.catchUp = mngr.conf.ScheduleCatchUp
+
+	mngr.schedulerMu.Lock()
+	mngr.scheduler = sched
+	mngr.schedulerMu.Unlock()
+
+	for {
+		err := sched.refresh(ctx, time.Now())
+		if err != nil {
+			slog.Error("failed to refresh backup schedule", logKeyError, err)
+		}
+
+		sched.runDue(ctx, time.Now())
+
+		wait := time.Until(sched.nextWakeup(time.Now()))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// scheduleTargets returns schedule of every running container to backup: label value or SCHEDULE_DEFAULT.
+// Names without schedule are skipped
+func (mngr *ContainerManager) scheduleTargets(ctx context.Context) (map[string]string, error) {
+	labels := map[string]map[string]string{}
+
+	cntrs, err := mngr.listContainersWithLabel(ctx, mngr.labels.backupName, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cntr := range cntrs {
+		labels[mngr.nameFromLabel(&cntr, mngr.labels.backupName)] = cntr.Labels
+	}
+
+	if mngr.conf.Swarm {
+		svcs, err := mngr.listTargetServices(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, svc := range svcs {
+			target := serviceTarget(&svc)
+			labels[mngr.nameFromLabel(target, mngr.labels.backupName)] = target.Labels
+		}
+	}
+
+	targets := map[string]string{}
+
+	for name, cntrLabels := range labels {
+		if _, err := mngr.resolveBackupName(name); err != nil {
+			continue
+		}
+
+		spec, ok := cntrLabels[mngr.labels.backupSchedule]
+		if !ok {
+			spec = mngr.conf.ScheduleDefault
+		}
+
+		spec = strings.TrimSpace(spec)
+
+		if len(spec) == 0 || spec == ScheduleOff {
+			continue
+		}
+
+		targets[name] = spec
+	}
+
+	return targets, nil
+}
+
+// refresh picks up added, changed and removed schedules. New schedule missed while maestro was down
+// is run right away if catch-up is on
+func (sched *scheduler) refresh(ctx context.Context, now time.Time) error {
+	targets, err := sched.mngr.scheduleTargets(ctx)
+	if err != nil {
+		return err
+	}
+
+	sched.mu.Lock()
+	defer sched.mu.Unlock()
+
+	for name := range sched.items {
+		if _, ok := targets[name]; !ok {
+			slog.Info("backup schedule removed", logKeyBackupName, name)
+			delete(sched.items, name)
+		}
+	}
+
+	for name, spec := range targets {
+		item, ok := sched.items[name]
+		if ok && item.spec == spec {
+			continue
+		}
+
+		item = &scheduleItem{spec: spec}
+		sched.items[name] = item
+
+		item.schedule, item.err = cron.ParseStandard(spec)
+		if item.err != nil {
+			slog.Error("invalid backup schedule", logKeyBackupName, name, "schedule", spec, logKeyError, item.err)
+			continue
+		}
+
+		item.next = sched.plan(item.schedule.Next(now))
+
+		if sched.catchUp {
+			lastRun, err := sched.lastRun(name)
+			if err != nil {
+				return err
+			}
+
+			// first run after the last one is already over
+			if !lastRun.IsZero() && item.schedule.Next(lastRun).Before(now) {
+				slog.Info("scheduled backup was missed, catching up", logKeyBackupName, name, "last_run", lastRun)
+				item.next = sched.plan(now)
+			}
+		}
+
+		slog.Info("backup scheduled", logKeyBackupName, name, "schedule", spec, "next_run", item.next)
+	}
+
+	return nil
+}
+
+// lastRun returns time of last force-backup of name, successful or not, zero if it never ran
+func (sched *scheduler) lastRun(name string) (time.Time, error) {
+	state, err := sched.mngr.backups.get(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var last time.Time
+
+	if state.LastBackup != nil {
+		last = *state.LastBackup
+	}
+
+	if state.LastJob != nil && state.LastJob.Type == JobTypeForceBackup && state.LastJob.At.After(last) {
+		last = state.LastJob.At
+	}
+
+	return last, nil
+}
+
+// plan adds jitter to scheduled time
+func (sched *scheduler) plan(at time.Time) time.Time {
+	if sched.jitter <= 0 {
+		return at
+	}
+
+	return at.Add(rand.N(sched.jitter))
+}
+
+// runDue starts force-backups which are due and plans their next runs
+func (sched *scheduler) runDue(ctx context.Context, now time.Time) {
+	sched.mu.Lock()
+	defer sched.mu.Unlock()
+
+	for name, item := range sched.items {
+		if item.err != nil || item.next.After(now) {
+			continue
+		}
+
+		item.next = sched.plan(item.schedule.Next(now))
+
+		info, err := sched.jobs.Start(ctx, JobTypeForceBackup, sched.mngr.host, name, func(ctx context.Context, out io.Writer) error {
+			return sched.mngr.ForceBackup(ctx, name, OneOffOptions{Output: out})
+		})
+		if err != nil {
+			// previous run or manual job is still running
+			slog.Warn("skipping scheduled backup", logKeyBackupName, name, logKeyError, err, "next_run", item.next)
+			sched.mngr.metrics.scheduleSkips.Inc()
+			continue
+		}
+
+		item.jobId = info.ID
+
+		slog.Info("scheduled backup started", logKeyBackupName, name, "job_id", info.ID, "next_run", item.next)
+	}
+}
+
+// nextWakeup returns time of the earliest run, but no later than next refresh
+func (sched *scheduler) nextWakeup(now time.Time) time.Time {
+	sched.mu.Lock()
+	defer sched.mu.Unlock()
+
+	wakeup := now.Add(scheduleRefreshInterval)
+
+	for _, item := range sched.items {
+		if item.err == nil && item.next.Before(wakeup) {
+			wakeup = item.next
+		}
+	}
+
+	return wakeup
+}
+
+// entries returns planned runs sorted by name
+func (sched *scheduler) entries() []ScheduleEntry {
+	sched.mu.Lock()
+	defer sched.mu.Unlock()
+
+	entries := []ScheduleEntry{}
+
+	for name, item := range sched.items {
+		entry := ScheduleEntry{Host: sched.mngr.host, Name: name, Schedule: item.spec}
+
+		if item.err != nil {
+			entry.Error = item.err.Error()
+		} else {
+			next := item.next
+			entry.NextRun = &next
+		}
+
+		if sched.jobs != nil && len(item.jobId) > 0 {
+			if j := sched.jobs.Get(item.jobId); j != nil && j.Info().Status == JobRunning {
+				entry.RunningJob = item.jobId
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	slices.SortFunc(entries, func(a, b ScheduleEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return entries
+}
+
+// Schedule returns planned force-backups. Daemon returns its plan, otherwise runs are planned from labels
+// the same way daemon would plan them on start, without jitter
+func (mngr *ContainerManager) Schedule(ctx context.Context) ([]ScheduleEntry, error) {
+	mngr.schedulerMu.Lock()
+	sched := mngr.scheduler
+	mngr.schedulerMu.Unlock()
+
+	if sched == nil {
+		sched = newScheduler(mngr, nil)
+		sched.catchUp = mngr.conf.ScheduleCatchUp
+
+		err := sched.refresh(ctx, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries := sched.entries()
+
+	for i := range entries {
+		state, err := mngr.backups.get(entries[i].Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup state - %w", err)
+		}
+
+		entries[i].LastBackup = state.LastBackup
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule(t *testing.T) {
+	tm := newTestMngr(t, []string{"labeled", "default", "off", "invalid"}, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	tm.mngr.conf.ScheduleDefault = "@daily"
+
+	tm.liveBackupCntrs["labeled"].Labels[tm.mngr.labels.backupSchedule] = "30 3 * * *"
+	tm.liveBackupCntrs["off"].Labels[tm.mngr.labels.backupSchedule] = ScheduleOff
+	tm.liveBackupCntrs["invalid"].Labels[tm.mngr.labels.backupSchedule] = "every night"
+
+	entries, err := tm.mngr.Schedule(context.Background())
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	now := time.Now()
+
+	require.Equal(t, "default", entries[0].Name)
+	require.Equal(t, "@daily", entries[0].Schedule)
+	require.Equal(t, time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local), *entries[0].NextRun)
+
+	require.Equal(t, "invalid", entries[1].Name)
+	require.Nil(t, entries[1].NextRun)
+	require.NotEmpty(t, entries[1].Error)
+
+	require.Equal(t, "labeled", entries[2].Name)
+	require.Equal(t, 3, entries[2].NextRun.Hour())
+	require.Equal(t, 30, entries[2].NextRun.Minute())
+	require.True(t, entries[2].NextRun.After(now))
+}
+
+func TestScheduleCatchUp(t *testing.T) {
+	tm := newTestMngr(t, []string{"missed", "done", "never"}, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	tm.mngr.conf.ScheduleDefault = "0 * * * *"
+
+	now := time.Now()
+
+	require.NoError(t, tm.mngr.backups.recordBackup("missed", BackupSourceForceBackup, now.Add(-3*time.Hour)))
+	// failed run is not retried on start
+	require.NoError(t, tm.mngr.backups.recordJob("done", JobResult{Type: JobTypeForceBackup, Result: "1", At: now.Add(-time.Second)}))
+
+	sched := newScheduler(tm.mngr, nil)
+	sched.catchUp = true
+
+	require.NoError(t, sched.refresh(context.Background(), now))
+
+	require.Equal(t, now, sched.items["missed"].next)
+	require.True(t, sched.items["done"].next.After(now))
+	require.True(t, sched.items["never"].next.After(now))
+
+	sched = newScheduler(tm.mngr, nil)
+
+	require.NoError(t, sched.refresh(context.Background(), now))
+	require.True(t, sched.items["missed"].next.After(now))
+}
+
+func TestScheduleRun(t *testing.T) {
+	tm := newTestMngr(t, []string{"example"}, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	tm.liveBackupCntrs["example"].Labels[tm.mngr.labels.backupSchedule] = "*/5 * * * *"
+
+	jobs := NewJobRegistry()
+	sched := newScheduler(tm.mngr, jobs)
+
+	now := time.Now()
+
+	require.NoError(t, sched.refresh(context.Background(), now))
+	require.True(t, sched.items["example"].next.After(now))
+
+	// manual job of the same name is still running, so scheduled run is skipped
+	release := make(chan struct{})
+	manual, err := jobs.Start(context.Background(), JobTypeRestore, "", "example", func(ctx context.Context, out io.Writer) error {
+		<-release
+		return nil
+	})
+	require.NoError(t, err)
+
+	due := sched.items["example"].next
+	sched.runDue(context.Background(), due)
+
+	require.Len(t, jobs.List(), 1)
+	require.Equal(t, 1.0, testutil.ToFloat64(tm.mngr.metrics.scheduleSkips))
+	require.True(t, sched.items["example"].next.After(due))
+
+	close(release)
+	_, err = jobs.Get(manual.ID).Wait(context.Background())
+	require.NoError(t, err)
+
+	tm.expectImageList([]string{"alpine:latest"})
+	tm.expectForceBackupRun("example", "0")
+
+	due = sched.items["example"].next
+	sched.runDue(context.Background(), due)
+
+	jobId := sched.items["example"].jobId
+	require.NotEmpty(t, jobId)
+
+	res, err := jobs.Get(jobId).Wait(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, JobSucceeded, res.Status)
+	require.Equal(t, JobTypeForceBackup, res.Type)
+
+	state, err := tm.mngr.backups.get("example")
+	require.NoError(t, err)
+	require.Equal(t, BackupSourceForceBackup, state.LastBackupSource)
+
+	// label removed
+	delete(tm.liveBackupCntrs["example"].Labels, tm.mngr.labels.backupSchedule)
+
+	require.NoError(t, sched.refresh(context.Background(), time.Now()))
+	require.Empty(t, sched.entries())
+}
+
+func TestScheduleJitter(t *testing.T) {
+	sched := &scheduler{jitter: time.Minute}
+
+	at := time.Now()
+
+	for range 100 {
+		next := sched.plan(at)
+		require.False(t, next.Before(at))
+		require.True(t, next.Before(at.Add(time.Minute)))
+	}
+}
@@ -0,0 +1,426 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type JobRequest struct {
+	Type           string        `json:"type"`
+	Host           string        `json:"host,omitempty"`
+	Name           string        `json:"name,omitempty"`
+	Timeout        time.Duration `json:"timeout,omitempty"`
+	IncludeStopped bool          `json:"include_stopped,omitempty"`
+}
+
+// ControlServer is served by maestro daemon on unix socket (and optionally tcp), so cli commands
+// do not race with daemon and could hand jobs over to it
+type ControlServer struct {
+	hosts []*ContainerManager
+	jobs  *JobRegistry
+}
+
+// NewControlServer serves managers of all docker hosts. Requests select host with host query parameter
+func NewControlServer(hosts ...*ContainerManager) *ControlServer {
+	return &ControlServer{
+		hosts: hosts,
+		jobs:  NewJobRegistry(),
+	}
+}
+
+// hostByName returns manager of host. Name could be empty if maestro manages single host
+func (srv *ControlServer) hostByName(name string) (*ContainerManager, error) {
+	mngrs, err := selectHosts(srv.hosts, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mngrs) > 1 {
+		return nil, fmt.Errorf("host is required, maestro manages hosts %s", strings.Join(hostNames(srv.hosts), ", "))
+	}
+
+	return mngrs[0], nil
+}
+
+// withHost passes manager of host selected by request to handler
+func (srv *ControlServer) withHost(handler func(w http.ResponseWriter, r *http.Request, mngr *ContainerManager)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mngr, err := srv.hostByName(r.URL.Query().Get("host"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		handler(w, r, mngr)
+	}
+}
+
+// withHosts passes managers of host selected by request, or of all hosts if host is not set
+func (srv *ControlServer) withHosts(handler func(w http.ResponseWriter, r *http.Request, mngrs []*ContainerManager)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mngrs, err := selectHosts(srv.hosts, r.URL.Query().Get("host"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		handler(w, r, mngrs)
+	}
+}
+
+// Serve listens on unix socket and on tcp address if set until ctx is done.
+// Jobs started via server are canceled with ctx as well
+func (srv *ControlServer) Serve(ctx context.Context, socketPath string, tcpAddr string) error {
+	listeners := []net.Listener{}
+
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+
+	if len(socketPath) > 0 {
+		err := os.Remove(socketPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale socket %s: %w", socketPath, err)
+		}
+
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	if len(tcpAddr) > 0 {
+		listener, err := net.Listen("tcp", tcpAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", tcpAddr, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	httpSrv := &http.Server{
+		Handler:     srv.handler(ctx),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		httpSrv.Close()
+	}()
+
+	errChan := make(chan error, len(listeners))
+
+	for _, listener := range listeners {
+		slog.Info("control server listening", "addr", listener.Addr().String())
+
+		go func() {
+			errChan <- httpSrv.Serve(listener)
+		}()
+	}
+
+	for range listeners {
+		err := <-errChan
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			httpSrv.Close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (srv *ControlServer) handler(ctx context.Context) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /status", srv.withHost(func(w http.ResponseWriter, r *http.Request, mngr *ContainerManager) {
+		writeJson(w, http.StatusOK, mngr.Status())
+	}))
+
+	mux.Handle("GET /metrics", metricsHandler(srv.hosts))
+
+	// reads of several hosts are merged, entries are marked with host
+	mux.HandleFunc("GET /list", srv.withHosts(func(w http.ResponseWriter, r *http.Request, mngrs []*ContainerManager) {
+		query := r.URL.Query()
+
+		entries := []ListEntry{}
+
+		for _, mngr := range mngrs {
+			hostEntries, err := mngr.List(r.Context(), ListOptions{
+				All:          query.Has("all"),
+				Backupers:    query.Has("backup"),
+				Restores:     query.Has("restore"),
+				ForceBackups: query.Has("force-backup"),
+			})
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, hostError(mngr, err))
+				return
+			}
+
+			entries = append(entries, hostEntries...)
+		}
+
+		writeJson(w, http.StatusOK, entries)
+	}))
+
+	mux.HandleFunc("GET /backups", srv.withHosts(func(w http.ResponseWriter, r *http.Request, mngrs []*ContainerManager) {
+		states := []BackupState{}
+
+		for _, mngr := range mngrs {
+			hostStates, err := mngr.LastBackups(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, hostError(mngr, err))
+				return
+			}
+
+			states = append(states, hostStates...)
+		}
+
+		writeJson(w, http.StatusOK, states)
+	}))
+
+	mux.HandleFunc("GET /schedule", srv.withHosts(func(w http.ResponseWriter, r *http.Request, mngrs []*ContainerManager) {
+		entries := []ScheduleEntry{}
+
+		for _, mngr := range mngrs {
+			hostEntries, err := mngr.Schedule(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, hostError(mngr, err))
+				return
+			}
+
+			entries = append(entries, hostEntries...)
+		}
+
+		writeJson(w, http.StatusOK, entries)
+	}))
+
+	mux.HandleFunc("GET /health", srv.withHosts(func(w http.ResponseWriter, r *http.Request, mngrs []*ContainerManager) {
+		reports := []HealthReport{}
+
+		for _, mngr := range mngrs {
+			report, err := mngr.Health(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, hostError(mngr, err))
+				return
+			}
+
+			reports = append(reports, report)
+		}
+
+		writeJson(w, http.StatusOK, mergeHealth(reports))
+	}))
+
+	mux.HandleFunc("POST /reconcile", srv.withHost(func(w http.ResponseWriter, r *http.Request, mngr *ContainerManager) {
+		writeResult(w, mngr.Reconcile(r.Context()))
+	}))
+
+	mux.HandleFunc("POST /images/update", srv.withHost(func(w http.ResponseWriter, r *http.Request, mngr *ContainerManager) {
+		writeResult(w, mngr.UpdateImages(r.Context()))
+	}))
+
+	for action, fn := range map[string]func(mngr *ContainerManager, ctx context.Context, name string) error{
+		"create": (*ContainerManager).CreateBackuper,
+		"remove": (*ContainerManager).RemoveBackuper,
+		"start":  (*ContainerManager).StartBackuper,
+		"stop":   (*ContainerManager).Stop,
+	} {
+		mux.HandleFunc("POST /backupers/{name}/"+action, srv.withHost(func(w http.ResponseWriter, r *http.Request, mngr *ContainerManager) {
+			writeResult(w, mngr.withLifecycleLock(func() error {
+				return fn(mngr, r.Context(), r.PathValue("name"))
+			}))
+		}))
+	}
+
+	for action, fn := range map[string]func(mngr *ContainerManager, ctx context.Context) error{
+		"create-all": (*ContainerManager).CreateAll,
+		"remove-all": (*ContainerManager).RemoveAll,
+		"start-all":  (*ContainerManager).StartAll,
+		"stop-all":   (*ContainerManager).StopAll,
+	} {
+		mux.HandleFunc("POST /backupers/"+action, srv.withHost(func(w http.ResponseWriter, r *http.Request, mngr *ContainerManager) {
+			writeResult(w, mngr.withLifecycleLock(func() error {
+				return fn(mngr, r.Context())
+			}))
+		}))
+	}
+
+	mux.HandleFunc("POST /jobs", func(w http.ResponseWriter, r *http.Request) {
+		var req JobRequest
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid job request: %w", err))
+			return
+		}
+
+		mngr, err := srv.hostByName(req.Host)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		info, err := srv.startJob(ctx, mngr, req)
+		if errors.Is(err, ErrInvalidBackupName) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+
+		writeJson(w, http.StatusCreated, info)
+	})
+
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, srv.jobs.List())
+	})
+
+	mux.HandleFunc("GET /jobs/{id}", srv.withJob(func(w http.ResponseWriter, r *http.Request, j *job) {
+		writeJson(w, http.StatusOK, j.Info())
+	}))
+
+	mux.HandleFunc("GET /jobs/{id}/logs", srv.withJob(func(w http.ResponseWriter, r *http.Request, j *job) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+
+		j.WriteLogs(r.Context(), flushWriter{w}, r.URL.Query().Has("follow"))
+	}))
+
+	mux.HandleFunc("GET /jobs/{id}/wait", srv.withJob(func(w http.ResponseWriter, r *http.Request, j *job) {
+		info, err := j.Wait(r.Context())
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+
+		writeJson(w, http.StatusOK, info)
+	}))
+
+	mux.HandleFunc("POST /jobs/{id}/cancel", srv.withJob(func(w http.ResponseWriter, r *http.Request, j *job) {
+		j.Cancel()
+
+		writeJson(w, http.StatusOK, j.Info())
+	}))
+
+	return mux
+}
+
+func (srv *ControlServer) withJob(handler func(w http.ResponseWriter, r *http.Request, j *job)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		j := srv.jobs.Get(r.PathValue("id"))
+		if j == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", r.PathValue("id")))
+			return
+		}
+
+		handler(w, r, j)
+	}
+}
+
+func (srv *ControlServer) startJob(ctx context.Context, mngr *ContainerManager, req JobRequest) (JobInfo, error) {
+	var run func(ctx context.Context, out io.Writer) error
+
+	switch req.Type {
+	case JobTypeRestore:
+		run = func(ctx context.Context, out io.Writer) error {
+			return mngr.Restore(ctx, req.Name, OneOffOptions{Timeout: req.Timeout, Output: out})
+		}
+
+	case JobTypeRestoreAll:
+		req.Name = ""
+		run = func(ctx context.Context, out io.Writer) error {
+			return mngr.RestoreAll(ctx, OneOffOptions{Timeout: req.Timeout, Output: out})
+		}
+
+	case JobTypeForceBackup:
+		run = func(ctx context.Context, out io.Writer) error {
+			return mngr.ForceBackup(ctx, req.Name, OneOffOptions{Timeout: req.Timeout, Output: out})
+		}
+
+	case JobTypeForceBackupAll:
+		req.Name = ""
+		run = func(ctx context.Context, out io.Writer) error {
+			return mngr.ForceBackupAll(ctx, req.IncludeStopped, OneOffOptions{Timeout: req.Timeout, Output: out})
+		}
+
+	default:
+		return JobInfo{}, fmt.Errorf("unknown job type '%s'", req.Type)
+	}
+
+	if req.Type == JobTypeRestore || req.Type == JobTypeForceBackup {
+		_, err := mngr.resolveBackupName(req.Name)
+		if err != nil {
+			return JobInfo{}, fmt.Errorf("%s job: %w", req.Type, err)
+		}
+	}
+
+	info, err := srv.jobs.Start(ctx, req.Type, mngr.host, req.Name, run)
+	if err != nil {
+		return JobInfo{}, err
+	}
+
+	slog.Info("started job", "job_id", info.ID, "job_type", info.Type, logKeyHost, info.Host, logKeyBackupName, info.Name)
+
+	return info, nil
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJson(w http.ResponseWriter, status int, val any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(val)
+	if err != nil {
+		slog.Error("failed to write response", logKeyError, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeResult(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrInvalidBackupName) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJson(w, http.StatusOK, struct{}{})
+}
+
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	return fw.w.Write(p)
+}
+
+func (fw flushWriter) Flush() {
+	if f, ok := fw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
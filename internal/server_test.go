@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControlServerApi(t *testing.T) {
+	tm := newTestMngr(t, []string{"example"}, []string{"example"}, UserTemplates{Backuper: &Template{Image: "alpine"}})
+
+	socketPath := filepath.Join(t.TempDir(), "maestro.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	served := make(chan error)
+	go func() {
+		served <- NewControlServer(tm.mngr).Serve(ctx, socketPath, "")
+	}()
+
+	client := NewControlClient(socketPath)
+
+	require.Eventually(t, func() bool {
+		return client.Available(ctx)
+	}, time.Second, 10*time.Millisecond)
+
+	entries, err := client.List(ctx, ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "example", entries[0].Name)
+	require.Equal(t, SyncInSync, entries[0].Sync)
+
+	entries, err = client.List(ctx, ListOptions{Backupers: true, All: true})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "backuperidexample", entries[0].BackuperId)
+
+	tm.docker.EXPECT().ContainerStart(mock.Anything, "backuperidexample", mock.Anything).Return(nil).Once()
+	require.NoError(t, client.StartBackuper(ctx, "example"))
+
+	require.NoError(t, client.Reconcile(ctx))
+
+	status, err := client.Status(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, status.LastReconcile)
+	require.Empty(t, status.LastReconcileError)
+
+	cancel()
+	require.NoError(t, <-served)
+}
+
+func TestControlClientUnavailable(t *testing.T) {
+	client := NewControlClient(filepath.Join(t.TempDir(), "missing.sock"))
+
+	require.False(t, client.Available(context.Background()))
+}
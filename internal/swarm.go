@@ -0,0 +1,694 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
+)
+
+// label docker sets on containers of swarm tasks
+const swarmServiceIdLabel = "com.docker.swarm.service.id"
+
+const RecreateReasonNodeChanged = "node_changed"
+
+const logKeyServiceId = "service_id"
+
+// how often state of one-off job task is checked
+const swarmJobPollInterval = time.Second
+
+// how long logs of finished one-off job are read before they are closed
+const swarmJobLogsGrace = 2 * time.Second
+
+// swarm service names are dns labels
+var serviceNameRegex = regexp.MustCompile(`[^a-zA-Z0-9-]+`)
+
+const serviceNameMaxLen = 63
+
+// isSwarmTask reports if container with labels (or event attributes) is task of swarm service
+func isSwarmTask(labels map[string]string) bool {
+	_, ok := labels[swarmServiceIdLabel]
+	return ok
+}
+
+// standaloneContainers drops containers of swarm tasks in swarm mode, as their services are managed instead
+func (mngr *ContainerManager) standaloneContainers(cntrs []types.Container) []types.Container {
+	if !mngr.conf.Swarm {
+		return cntrs
+	}
+
+	standalone := []types.Container{}
+
+	for _, cntr := range cntrs {
+		if !isSwarmTask(cntr.Labels) {
+			standalone = append(standalone, cntr)
+		}
+	}
+
+	return standalone
+}
+
+// serviceName converts container name format to valid service name: docker-backup-maestro.backup_db -> docker-backup-maestro-backup-db
+func serviceName(name string) string {
+	name = strings.Trim(serviceNameRegex.ReplaceAllString(name, "-"), "-")
+
+	if len(name) > serviceNameMaxLen {
+		name = strings.TrimRight(name[:serviceNameMaxLen], "-")
+	}
+
+	return name
+}
+
+// serviceLabels returns labels of service to backup: container labels of its tasks overridden by service labels
+func serviceLabels(svc *swarm.Service) map[string]string {
+	labels := map[string]string{}
+
+	if svc.Spec.TaskTemplate.ContainerSpec != nil {
+		maps.Copy(labels, svc.Spec.TaskTemplate.ContainerSpec.Labels)
+	}
+
+	maps.Copy(labels, svc.Spec.Labels)
+
+	return labels
+}
+
+// serviceTarget represents service to backup as container, so backuper config is generated from its labels the same way
+func serviceTarget(svc *swarm.Service) *types.Container {
+	return &types.Container{
+		ID:     svc.ID,
+		Names:  []string{"/" + svc.Spec.Name},
+		Labels: serviceLabels(svc),
+	}
+}
+
+// listTargetServices returns services with backup name label. Labels of task containers are not filtered
+// by daemon, so all services are listed
+func (mngr *ContainerManager) listTargetServices(ctx context.Context) ([]swarm.Service, error) {
+	svcs, err := mngr.docker.ServiceList(ctx, types.ServiceListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("service list failed - %w", err)
+	}
+
+	targets := []swarm.Service{}
+
+	for _, svc := range svcs {
+		if _, ok := serviceLabels(&svc)[mngr.labels.backupName]; ok {
+			targets = append(targets, svc)
+		}
+	}
+
+	return targets, nil
+}
+
+// getTargetService returns service to backup by resolved backup name, nil if there is no such service
+func (mngr *ContainerManager) getTargetService(ctx context.Context, name string) (*swarm.Service, error) {
+	svcs, err := mngr.listTargetServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []swarm.Service
+
+	for _, svc := range svcs {
+		if mngr.nameFromLabel(serviceTarget(&svc), mngr.labels.backupName) == name {
+			found = append(found, svc)
+		}
+	}
+
+	if len(found) > 1 {
+		return nil, fmt.Errorf("services with label %s=%s more than 1: %d", mngr.labels.backupName, name, len(found))
+	}
+
+	if len(found) == 1 {
+		return &found[0], nil
+	}
+
+	return nil, nil
+}
+
+// getServiceByLabelValue returns service with label set to value, nil if there is no such service
+func (mngr *ContainerManager) getServiceByLabelValue(ctx context.Context, label, value string) (*swarm.Service, error) {
+	svcs, err := mngr.docker.ServiceList(ctx, types.ServiceListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", label, value))),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("service list failed - %w", err)
+	}
+
+	if len(svcs) > 1 {
+		return nil, fmt.Errorf("services with label %s=%s more than 1: %d", label, value, len(svcs))
+	}
+
+	if len(svcs) == 1 {
+		return &svcs[0], nil
+	}
+
+	return nil, nil
+}
+
+// serviceNode returns id of node running task of service. Services to backup are expected to have single task,
+// node of the first running one is used. Empty if no task is scheduled
+func (mngr *ContainerManager) serviceNode(ctx context.Context, svc *swarm.Service) (string, error) {
+	tasks, err := mngr.docker.TaskList(ctx, types.TaskListOptions{
+		Filters: filters.NewArgs(filters.Arg("service", svc.ID), filters.Arg("desired-state", "running")),
+	})
+	if err != nil {
+		return "", fmt.Errorf("task list of service %s failed - %w", svc.Spec.Name, err)
+	}
+
+	node := ""
+
+	for _, task := range tasks {
+		if task.Status.State == swarm.TaskStateRunning {
+			return task.NodeID, nil
+		}
+
+		if len(node) == 0 {
+			node = task.NodeID
+		}
+	}
+
+	return node, nil
+}
+
+func nodeConstraint(node string) string {
+	return "node.id==" + node
+}
+
+// specNode returns node service is pinned to
+func specNode(spec swarm.ServiceSpec) string {
+	if spec.TaskTemplate.Placement == nil {
+		return ""
+	}
+
+	for _, constraint := range spec.TaskTemplate.Placement.Constraints {
+		if node, ok := strings.CutPrefix(constraint, "node.id=="); ok {
+			return node
+		}
+	}
+
+	return ""
+}
+
+// serviceSpecFrom converts container template to spec of service pinned to node. Mode is set by caller
+func serviceSpecFrom(cfg *Template, tag string, name string, node string) (swarm.ServiceSpec, error) {
+	buildInfo, cntrCfg, hostCfg, netCfg, err := cfg.CreateConfig(tag)
+	if err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+
+	// image would be built on manager node only
+	if buildInfo != nil {
+		return swarm.ServiceSpec{}, fmt.Errorf("service %s: build is not supported for swarm services, image must be pulled from registry", name)
+	}
+
+	if hostCfg.Privileged || len(hostCfg.Resources.Devices) > 0 || len(hostCfg.SecurityOpt) > 0 {
+		return swarm.ServiceSpec{}, fmt.Errorf("service %s: privileged, devices and security_opt are not supported for swarm services", name)
+	}
+
+	mounts, err := bindMounts(hostCfg.Binds)
+	if err != nil {
+		return swarm.ServiceSpec{}, fmt.Errorf("service %s: %w", name, err)
+	}
+
+	spec := swarm.ServiceSpec{
+		Annotations: swarm.Annotations{
+			Name:   name,
+			Labels: cntrCfg.Labels,
+		},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{
+				Image:         cntrCfg.Image,
+				Labels:        cntrCfg.Labels,
+				Env:           cntrCfg.Env,
+				Command:       cntrCfg.Entrypoint,
+				Args:          cntrCfg.Cmd,
+				Mounts:        mounts,
+				CapabilityAdd: hostCfg.CapAdd,
+			},
+			RestartPolicy: &swarm.RestartPolicy{Condition: restartCondition(hostCfg.RestartPolicy)},
+			Placement:     &swarm.Placement{Constraints: []string{nodeConstraint(node)}},
+		},
+	}
+
+	if netCfg != nil {
+		for _, netName := range slices.Sorted(maps.Keys(netCfg.EndpointsConfig)) {
+			spec.TaskTemplate.Networks = append(spec.TaskTemplate.Networks, swarm.NetworkAttachmentConfig{Target: netName})
+		}
+	}
+
+	return spec, nil
+}
+
+// bindMounts converts compose volumes to service mounts: absolute source is bind, otherwise named volume
+func bindMounts(binds []string) ([]mount.Mount, error) {
+	mounts := []mount.Mount{}
+
+	for _, bind := range binds {
+		parts := strings.Split(bind, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid volume '%s', must be source:target[:mode]", bind)
+		}
+
+		mnt := mount.Mount{Type: mount.TypeVolume, Source: parts[0], Target: parts[1]}
+
+		if strings.HasPrefix(parts[0], "/") {
+			mnt.Type = mount.TypeBind
+		}
+
+		if len(parts) == 3 {
+			mnt.ReadOnly = slices.Contains(strings.Split(parts[2], ","), "ro")
+		}
+
+		mounts = append(mounts, mnt)
+	}
+
+	return mounts, nil
+}
+
+// restartCondition maps container restart policy to service one, service tasks are restarted by default
+func restartCondition(pol container.RestartPolicy) swarm.RestartPolicyCondition {
+	switch pol.Name {
+	case container.RestartPolicyDisabled:
+		return swarm.RestartPolicyConditionNone
+	case container.RestartPolicyOnFailure:
+		return swarm.RestartPolicyConditionOnFailure
+	}
+
+	return swarm.RestartPolicyConditionAny
+}
+
+// createService creates service, image is pulled by nodes with maestro registry credentials
+func (mngr *ContainerManager) createService(ctx context.Context, spec swarm.ServiceSpec) (string, error) {
+	auth, err := mngr.registry.encodedForImage(ctx, spec.TaskTemplate.ContainerSpec.Image)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := mngr.docker.ServiceCreate(ctx, spec, types.ServiceCreateOptions{EncodedRegistryAuth: auth, QueryRegistry: true})
+	if err != nil {
+		return "", fmt.Errorf("failed to create service %s - %w", spec.Name, err)
+	}
+
+	for _, warn := range resp.Warnings {
+		slog.Warn(warn, logKeyServiceId, resp.ID)
+	}
+
+	return resp.ID, nil
+}
+
+// removeService removes service, missing service is not an error
+func (mngr *ContainerManager) removeService(ctx context.Context, svcId string) error {
+	err := mngr.docker.ServiceRemove(ctx, svcId)
+	if err != nil && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to remove service %s - %w", svcId, err)
+	}
+
+	return nil
+}
+
+// reconcileServices creates, recreates and drops backuper services to match services to backup
+func (mngr *ContainerManager) reconcileServices(ctx context.Context) error {
+	targets, err := mngr.listTargetServices(ctx)
+	if err != nil {
+		return err
+	}
+
+	backupers, err := mngr.docker.ServiceList(ctx, types.ServiceListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", mngr.labels.backuperName)),
+	})
+	if err != nil {
+		return fmt.Errorf("service list failed - %w", err)
+	}
+
+	byName := map[string][]swarm.Service{}
+
+	for _, target := range targets {
+		name := mngr.nameFromLabel(serviceTarget(&target), mngr.labels.backupName)
+		byName[name] = append(byName[name], target)
+	}
+
+	for _, backuper := range backupers {
+		name := backuper.Spec.Labels[mngr.labels.backuperName]
+
+		if _, ok := byName[name]; ok {
+			continue
+		}
+
+		slog.Info("dropping backup service", logKeyAction, "drop", logKeyBackupName, name, logKeyServiceId, backuper.ID)
+
+		err := mngr.removeService(ctx, backuper.ID)
+		if err != nil {
+			return err
+		}
+
+		mngr.notifier.Notify(NotifyEvent{Event: NotifyBackuperDropped, Name: name})
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(byName)) {
+		svcs := byName[name]
+
+		// backuper of duplicated name is left as is until duplicate is resolved
+		if len(svcs) > 1 {
+			slog.Warn("backup name is set on more than one service, skipping backup service", logKeyBackupName, name)
+			continue
+		}
+
+		resolved, err := mngr.resolveBackupName(name)
+		if err != nil {
+			slog.Error("skipping backup service", logKeyBackupName, name, logKeyServiceId, svcs[0].ID, logKeyError, err)
+			continue
+		}
+
+		// backuper is scaled to 0 by one-off job and is synced after job scales it back
+		if mngr.oneOffs[resolved] {
+			slog.Info("one-off job is running, backup service is left as is", logKeyBackupName, resolved)
+			continue
+		}
+
+		var backuper *swarm.Service
+
+		idx := slices.IndexFunc(backupers, func(svc swarm.Service) bool {
+			return svc.Spec.Labels[mngr.labels.backuperName] == name
+		})
+		if idx >= 0 {
+			backuper = &backupers[idx]
+		}
+
+		err = mngr.syncBackuperService(ctx, resolved, &svcs[0], backuper)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncBackuperService creates backuper service on node of target task, or recreates it if config or node changed.
+// Must be called with lifecycle lock held
+func (mngr *ContainerManager) syncBackuperService(ctx context.Context, name string, target *swarm.Service, backuper *swarm.Service) error {
+	if mngr.oneOffs[name] {
+		slog.Info("one-off job is running, backup service is left as is", logKeyBackupName, name)
+		return nil
+	}
+
+	node, err := mngr.serviceNode(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	if len(node) == 0 {
+		slog.Info("service has no scheduled task, skipping backup service", logKeyBackupName, name, logKeyServiceId, target.ID)
+		return nil
+	}
+
+	backuperCfg := mngr.tmpls.Backuper.Overlay(mngr.backuperConfigFrom(serviceTarget(target), false))
+
+	hash, _, err := mngr.backuperFingerprint(ctx, backuperCfg)
+	if err != nil {
+		return fmt.Errorf("backup service %s: %w", name, err)
+	}
+
+	backuperCfg.Labels[mngr.labels.backuperConsistencyHash] = hash
+
+	event := NotifyEvent{Event: NotifyBackuperCreated, Name: name}
+
+	if backuper != nil {
+		reason := ""
+
+		switch {
+		case specNode(backuper.Spec) != node:
+			reason = RecreateReasonNodeChanged
+		case backuper.Spec.Labels[mngr.labels.backuperConsistencyHash] != hash:
+			reason = RecreateReasonConfigChanged
+		default:
+			slog.Info("backup service is up to date", logKeyBackupName, name, logKeyServiceId, backuper.ID)
+			return nil
+		}
+
+		mngr.metrics.recreations.WithLabelValues(reason).Inc()
+
+		slog.Info("recreating backup service", logKeyAction, "recreate", logKeyBackupName, name, logKeyServiceId, backuper.ID, "reason", reason)
+
+		err := mngr.removeService(ctx, backuper.ID)
+		if err != nil {
+			return fmt.Errorf("failed to drop backuper %s: %w", name, err)
+		}
+
+		event = NotifyEvent{Event: NotifyBackuperRecreated, Name: name, Reason: reason}
+	} else {
+		slog.Info("creating backup service", logKeyAction, "create", logKeyBackupName, name, "node", node)
+	}
+
+	spec, err := serviceSpecFrom(backuperCfg, mngr.conf.BackupTag, serviceName(strings.ReplaceAll(mngr.conf.BackupNameFormat, "{name}", name)), node)
+	if err != nil {
+		return err
+	}
+
+	replicas := uint64(1)
+	spec.Mode = swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}}
+
+	_, err = mngr.createService(ctx, spec)
+	if err != nil {
+		return err
+	}
+
+	mngr.notifier.Notify(event)
+
+	return nil
+}
+
+// scaleBackuperService sets replicas of backuper service, returns previous replicas. Missing backuper is skipped
+func (mngr *ContainerManager) scaleBackuperService(ctx context.Context, name string, replicas uint64) (uint64, error) {
+	backuper, err := mngr.getServiceByLabelValue(ctx, mngr.labels.backuperName, name)
+	if err != nil || backuper == nil || backuper.Spec.Mode.Replicated == nil {
+		return 0, err
+	}
+
+	spec := backuper.Spec
+	prev := *spec.Mode.Replicated.Replicas
+
+	if prev == replicas {
+		return prev, nil
+	}
+
+	spec.Mode.Replicated = &swarm.ReplicatedService{Replicas: &replicas}
+
+	slog.Info("scaling backup service", logKeyAction, "scale", logKeyBackupName, name, logKeyServiceId, backuper.ID, "replicas", replicas)
+
+	_, err = mngr.docker.ServiceUpdate(ctx, backuper.ID, backuper.Version, spec, types.ServiceUpdateOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to scale backuper %s - %w", name, err)
+	}
+
+	return prev, nil
+}
+
+// serviceTargetNames returns resolved backup names of services to backup, invalid names are skipped
+func (mngr *ContainerManager) serviceTargetNames(ctx context.Context) ([]string, error) {
+	svcs, err := mngr.listTargetServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+
+	for _, svc := range svcs {
+		name, err := mngr.resolveBackupName(serviceLabels(&svc)[mngr.labels.backupName])
+		if err != nil {
+			slog.Error("skipping service", logKeyServiceId, svc.ID, logKeyError, err)
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// oneOffJob runs restore or force-backup of service as replicated-job service on node of service task.
+// Backuper service is scaled down while job runs. Returns exit code of job or reason it was not finished
+func (mngr *ContainerManager) oneOffJob(ctx context.Context, name string, tmpl *Template, tag string, jobNameFormat string, target *swarm.Service, timeout time.Duration, output io.Writer) (result string, err error) {
+	result = "error"
+
+	node, err := mngr.serviceNode(ctx, target)
+	if err != nil {
+		return result, err
+	}
+
+	if len(node) == 0 {
+		return result, fmt.Errorf("service %s has no scheduled task to run job on its node", target.Spec.Name)
+	}
+
+	var replicas uint64
+
+	// reconcile keeps away from backuper until it is scaled back
+	err = mngr.withLifecycleLock(func() error {
+		replicas, err = mngr.scaleBackuperService(ctx, name, 0)
+		if err != nil {
+			return err
+		}
+
+		mngr.oneOffs[name] = true
+
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	// backuper must be scaled back whatever happens with job, original context may be already canceled
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), oneOffCleanupTimeout)
+		defer cancel()
+
+		err = errors.Join(err, mngr.withLifecycleLock(func() error {
+			delete(mngr.oneOffs, name)
+
+			if replicas == 0 {
+				return nil
+			}
+
+			_, err := mngr.scaleBackuperService(cleanupCtx, name, replicas)
+			return err
+		}))
+	}()
+
+	jobCfg := mngr.backuperConfigFrom(serviceTarget(target), true)
+
+	delete(jobCfg.Labels, mngr.labels.backuperName)
+	jobCfg.Labels[tag] = name
+
+	jobCfg = tmpl.Overlay(jobCfg)
+
+	jobName := serviceName(strings.ReplaceAll(jobNameFormat, "{name}", name))
+
+	spec, err := serviceSpecFrom(jobCfg, tag, jobName, node)
+	if err != nil {
+		return result, err
+	}
+
+	completions := uint64(1)
+	spec.Mode = swarm.ServiceMode{ReplicatedJob: &swarm.ReplicatedJob{MaxConcurrent: &completions, TotalCompletions: &completions}}
+	spec.TaskTemplate.RestartPolicy = &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionNone}
+
+	slog.Info("starting one-off job", logKeyAction, "start", logKeyBackupName, name, "node", node)
+
+	svcId, err := mngr.createService(ctx, spec)
+	if err != nil {
+		return result, err
+	}
+
+	// removal stops job task if it is still running
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), oneOffCleanupTimeout)
+		defer cancel()
+
+		err = errors.Join(err, mngr.removeService(cleanupCtx, svcId))
+	}()
+
+	jobCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		jobCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if output == nil {
+		output = os.Stdout
+	}
+
+	logsCtx, cancelLogs := context.WithCancel(jobCtx)
+	defer cancelLogs()
+
+	logsDone := make(chan struct{})
+	go func() {
+		defer close(logsDone)
+
+		reader, err := mngr.docker.ServiceLogs(logsCtx, svcId, container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
+		if err != nil {
+			slog.Error("failed to read one-off job logs", logKeyBackupName, name, logKeyServiceId, svcId, logKeyError, err)
+			return
+		}
+
+		defer reader.Close()
+
+		_ = copyLogs(output, reader, spec.TaskTemplate.ContainerSpec != nil && spec.TaskTemplate.ContainerSpec.TTY)
+	}()
+
+	task, err := mngr.waitForJob(jobCtx, svcId)
+	if jobCtx.Err() != nil {
+		result = "canceled"
+		if errors.Is(jobCtx.Err(), context.DeadlineExceeded) {
+			result = "timeout"
+			return result, fmt.Errorf("one-off job %s timed out", jobName)
+		}
+
+		return result, fmt.Errorf("one-off job %s canceled - %w", jobName, jobCtx.Err())
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	select {
+	case <-logsDone:
+	case <-time.After(swarmJobLogsGrace):
+	}
+
+	if task.Status.ContainerStatus == nil {
+		return result, fmt.Errorf("one-off job %s %s: %s", jobName, task.Status.State, task.Status.Err)
+	}
+
+	exitCode := task.Status.ContainerStatus.ExitCode
+	result = strconv.Itoa(exitCode)
+
+	if exitCode != 0 {
+		slog.Warn("one-off job exited with non-zero code", logKeyBackupName, name, logKeyServiceId, svcId, "exit_code", exitCode)
+	}
+
+	return result, nil
+}
+
+// waitForJob returns task of job service once it is finished
+func (mngr *ContainerManager) waitForJob(ctx context.Context, svcId string) (swarm.Task, error) {
+	ticker := time.NewTicker(swarmJobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		tasks, err := mngr.docker.TaskList(ctx, types.TaskListOptions{
+			Filters: filters.NewArgs(filters.Arg("service", svcId)),
+		})
+		if err != nil {
+			return swarm.Task{}, fmt.Errorf("task list of job %s failed - %w", svcId, err)
+		}
+
+		for _, task := range tasks {
+			switch task.Status.State {
+			case swarm.TaskStateComplete, swarm.TaskStateFailed, swarm.TaskStateRejected, swarm.TaskStateShutdown, swarm.TaskStateOrphaned:
+				return task, nil
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return swarm.Task{}, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newSwarmTestMngr(t *testing.T) testMngr {
+	tm := newTestMngr(t, nil, nil, UserTemplates{Backuper: &Template{Image: "alpine"}})
+	tm.mngr.conf.Swarm = true
+
+	return tm
+}
+
+// genTargetService returns service labeled for backup on its task containers
+func genTargetService(tm testMngr, name string) swarm.Service {
+	return swarm.Service{
+		ID: "svcid" + name,
+		Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{Name: name},
+			TaskTemplate: swarm.TaskSpec{
+				ContainerSpec: &swarm.ContainerSpec{
+					Image: "postgres:16",
+					Labels: map[string]string{
+						tm.mngr.labels.backupName: name,
+						tm.mngr.labels.backupPath: "/srv/" + name,
+					},
+				},
+			},
+		},
+	}
+}
+
+// genBackuperService returns backuper service of name pinned to node
+func genBackuperService(tm testMngr, name string, node string, hash string) swarm.Service {
+	replicas := uint64(1)
+
+	return swarm.Service{
+		ID:   "backuperid" + name,
+		Meta: swarm.Meta{Version: swarm.Version{Index: 10}},
+		Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{
+				Name:   "docker-backup-maestro-backup-" + name,
+				Labels: map[string]string{tm.mngr.labels.backuperName: name, tm.mngr.labels.backuperConsistencyHash: hash},
+			},
+			TaskTemplate: swarm.TaskSpec{Placement: &swarm.Placement{Constraints: []string{nodeConstraint(node)}}},
+			Mode:         swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}},
+		},
+	}
+}
+
+func (tm *testMngr) expectServiceList(targets []swarm.Service, backupers []swarm.Service) {
+	tm.docker.EXPECT().ServiceList(mock.Anything, mock.MatchedBy(func(opts types.ServiceListOptions) bool {
+		return opts.Filters.Len() == 0
+	})).Return(append(append([]swarm.Service{}, targets...), backupers...), nil).Maybe()
+
+	tm.docker.EXPECT().ServiceList(mock.Anything, mock.MatchedBy(func(opts types.ServiceListOptions) bool {
+		return opts.Filters.ExactMatch("label", tm.mngr.labels.backuperName)
+	})).Return(backupers, nil).Maybe()
+
+	for _, target := range targets {
+		name := target.Spec.Name
+
+		found := []swarm.Service{}
+		for _, backuper := range backupers {
+			if backuper.Spec.Labels[tm.mngr.labels.backuperName] == name {
+				found = append(found, backuper)
+			}
+		}
+
+		tm.docker.EXPECT().ServiceList(mock.Anything, mock.MatchedBy(func(opts types.ServiceListOptions) bool {
+			return opts.Filters.ExactMatch("label", tm.mngr.labels.backuperName+"="+name)
+		})).Return(found, nil).Maybe()
+	}
+}
+
+func (tm *testMngr) expectServiceTask(svcId string, node string) {
+	tm.docker.EXPECT().TaskList(mock.Anything, mock.MatchedBy(func(opts types.TaskListOptions) bool {
+		return opts.Filters.ExactMatch("service", svcId) && opts.Filters.ExactMatch("desired-state", "running")
+	})).Return([]swarm.Task{{ServiceID: svcId, NodeID: node, Status: swarm.TaskStatus{State: swarm.TaskStateRunning}}}, nil).Maybe()
+}
+
+func TestSwarmBackuperService(t *testing.T) {
+	tm := newSwarmTestMngr(t)
+
+	tm.expectServiceList([]swarm.Service{genTargetService(tm, "db")}, nil)
+	tm.expectServiceTask("svciddb", "node1")
+
+	var spec swarm.ServiceSpec
+	tm.docker.EXPECT().ServiceCreate(mock.Anything, mock.Anything, types.ServiceCreateOptions{QueryRegistry: true}).Run(func(_ context.Context, service swarm.ServiceSpec, _ types.ServiceCreateOptions) {
+		spec = service
+	}).Return(swarm.ServiceCreateResponse{ID: "backuperiddb"}, nil).Once()
+
+	require.NoError(t, tm.mngr.Reconcile(context.Background()))
+
+	require.Equal(t, "docker-backup-maestro-backup-db", spec.Name)
+	require.Equal(t, "db", spec.Labels[tm.mngr.labels.backuperName])
+	require.Equal(t, "alpine", spec.TaskTemplate.ContainerSpec.Image)
+	require.Equal(t, []string{"node.id==node1"}, spec.TaskTemplate.Placement.Constraints)
+	require.Equal(t, []mount.Mount{{Type: mount.TypeBind, Source: "/srv/db", Target: testDataPath, ReadOnly: true}}, spec.TaskTemplate.ContainerSpec.Mounts)
+	require.Equal(t, uint64(1), *spec.Mode.Replicated.Replicas)
+}
+
+func TestSwarmBackuperServiceMoved(t *testing.T) {
+	tm := newSwarmTestMngr(t)
+
+	target := genTargetService(tm, "db")
+
+	cfg := tm.mngr.tmpls.Backuper.Overlay(tm.mngr.backuperConfigFrom(serviceTarget(&target), false))
+	hash, _, err := tm.mngr.backuperFingerprint(context.Background(), cfg)
+	require.NoError(t, err)
+
+	tm.expectServiceList([]swarm.Service{target}, []swarm.Service{genBackuperService(tm, "db", "node1", hash)})
+
+	node := "node1"
+	tm.docker.EXPECT().TaskList(mock.Anything, mock.Anything).RunAndReturn(func(_ context.Context, _ types.TaskListOptions) ([]swarm.Task, error) {
+		return []swarm.Task{{ServiceID: "svciddb", NodeID: node, Status: swarm.TaskStatus{State: swarm.TaskStateRunning}}}, nil
+	})
+
+	// same node, same config
+	require.NoError(t, tm.mngr.Reconcile(context.Background()))
+
+	// task is rescheduled to other node
+	node = "node2"
+
+	tm.docker.EXPECT().ServiceRemove(mock.Anything, "backuperiddb").Return(nil).Once()
+	tm.docker.EXPECT().ServiceCreate(mock.Anything, mock.MatchedBy(func(spec swarm.ServiceSpec) bool {
+		return specNode(spec) == "node2"
+	}), mock.Anything).Return(swarm.ServiceCreateResponse{ID: "backuperiddb2"}, nil).Once()
+
+	require.NoError(t, tm.mngr.Reconcile(context.Background()))
+	require.Equal(t, 1.0, testutil.ToFloat64(tm.mngr.metrics.recreations.WithLabelValues(RecreateReasonNodeChanged)))
+}
+
+func TestSwarmBackuperServiceDropped(t *testing.T) {
+	tm := newSwarmTestMngr(t)
+
+	tm.expectServiceList(nil, []swarm.Service{genBackuperService(tm, "db", "node1", "")})
+
+	tm.docker.EXPECT().ServiceRemove(mock.Anything, "backuperiddb").Return(nil).Once()
+
+	require.NoError(t, tm.mngr.Reconcile(context.Background()))
+}
+
+func TestSwarmTaskContainersIgnored(t *testing.T) {
+	tm := newSwarmTestMngr(t)
+
+	// task container of service labeled for backup on manager node
+	task := genBackupCntr(tm.mngr, "db")
+	task.Labels[swarmServiceIdLabel] = "svciddb"
+	tm.liveBackupCntrs["db"] = task
+
+	tm.resetExpectCallList()
+	tm.expectCntrList()
+
+	tm.expectServiceList(nil, nil)
+
+	require.NoError(t, tm.mngr.Reconcile(context.Background()))
+
+	require.NoError(t, tm.mngr.handleDockerEvent(context.Background(), events.Message{
+		Action: events.ActionCreate,
+		Actor:  events.Actor{ID: task.ID, Attributes: task.Labels},
+	}))
+}
+
+func TestSwarmForceBackupJob(t *testing.T) {
+	tm := newSwarmTestMngr(t)
+
+	backuper := genBackuperService(tm, "db", "node1", "")
+
+	tm.expectServiceList([]swarm.Service{genTargetService(tm, "db")}, []swarm.Service{backuper})
+	tm.expectServiceTask("svciddb", "node1")
+
+	// backuper is scaled down while job runs and scaled back after
+	for _, replicas := range []uint64{0, 1} {
+		tm.docker.EXPECT().ServiceUpdate(mock.Anything, "backuperiddb", swarm.Version{Index: 10}, mock.MatchedBy(func(spec swarm.ServiceSpec) bool {
+			return *spec.Mode.Replicated.Replicas == replicas
+		}), types.ServiceUpdateOptions{}).Run(func(_ context.Context, _ string, _ swarm.Version, _ swarm.ServiceSpec, _ types.ServiceUpdateOptions) {
+			*backuper.Spec.Mode.Replicated.Replicas = replicas
+		}).Return(swarm.ServiceUpdateResponse{}, nil).Once()
+	}
+
+	tm.docker.EXPECT().ServiceCreate(mock.Anything, mock.MatchedBy(func(spec swarm.ServiceSpec) bool {
+		return spec.Name == "docker-backup-maestro-forcebackup-db" &&
+			spec.Mode.ReplicatedJob != nil &&
+			specNode(spec) == "node1" &&
+			spec.Labels[tm.mngr.labels.forceBackup] == "db" &&
+			spec.TaskTemplate.RestartPolicy.Condition == swarm.RestartPolicyConditionNone &&
+			!spec.TaskTemplate.ContainerSpec.Mounts[0].ReadOnly
+	}), mock.Anything).Return(swarm.ServiceCreateResponse{ID: "jobiddb"}, nil).Once()
+
+	tm.docker.EXPECT().ServiceLogs(mock.Anything, "jobiddb", mock.Anything).Return(io.NopCloser(strings.NewReader("")), nil).Once()
+
+	tm.docker.EXPECT().TaskList(mock.Anything, mock.MatchedBy(func(opts types.TaskListOptions) bool {
+		return opts.Filters.ExactMatch("service", "jobiddb")
+	})).Return([]swarm.Task{{
+		ServiceID: "jobiddb",
+		Status:    swarm.TaskStatus{State: swarm.TaskStateComplete, ContainerStatus: &swarm.ContainerStatus{ExitCode: 0}},
+	}}, nil).Once()
+
+	tm.docker.EXPECT().ServiceRemove(mock.Anything, "jobiddb").Return(nil).Once()
+
+	require.NoError(t, tm.mngr.ForceBackup(context.Background(), "db", OneOffOptions{}))
+
+	state, err := tm.mngr.backups.get("db")
+	require.NoError(t, err)
+	require.Equal(t, BackupSourceForceBackup, state.LastBackupSource)
+}
+
+func TestSwarmReconcileDuringJob(t *testing.T) {
+	tm := newSwarmTestMngr(t)
+
+	// backuper config is outdated, so reconcile would recreate it with one replica
+	tm.expectServiceList([]swarm.Service{genTargetService(tm, "db")}, []swarm.Service{genBackuperService(tm, "db", "node1", "")})
+	tm.expectServiceTask("svciddb", "node1")
+
+	tm.mngr.oneOffs["db"] = true
+
+	require.NoError(t, tm.mngr.Reconcile(context.Background()))
+	require.NoError(t, tm.mngr.withLifecycleLock(func() error {
+		return tm.mngr.syncBackuperService(context.Background(), "db", &swarm.Service{}, nil)
+	}))
+
+	tm.docker.AssertNotCalled(t, "ServiceRemove", mock.Anything, "backuperiddb")
+
+	// job is over
+	delete(tm.mngr.oneOffs, "db")
+
+	tm.docker.EXPECT().ServiceRemove(mock.Anything, "backuperiddb").Return(nil).Once()
+	tm.docker.EXPECT().ServiceCreate(mock.Anything, mock.Anything, mock.Anything).Return(swarm.ServiceCreateResponse{ID: "backuperiddb2"}, nil).Once()
+
+	require.NoError(t, tm.mngr.Reconcile(context.Background()))
+}
+
+func TestSwarmJobFailed(t *testing.T) {
+	tm := newSwarmTestMngr(t)
+
+	tm.expectServiceList([]swarm.Service{genTargetService(tm, "db")}, nil)
+	tm.expectServiceTask("svciddb", "node1")
+
+	tm.docker.EXPECT().ServiceCreate(mock.Anything, mock.Anything, mock.Anything).Return(swarm.ServiceCreateResponse{ID: "jobiddb"}, nil).Once()
+	tm.docker.EXPECT().ServiceLogs(mock.Anything, "jobiddb", mock.Anything).Return(io.NopCloser(strings.NewReader("")), nil).Once()
+
+	tm.docker.EXPECT().TaskList(mock.Anything, mock.MatchedBy(func(opts types.TaskListOptions) bool {
+		return opts.Filters.ExactMatch("service", "jobiddb")
+	})).Return([]swarm.Task{{
+		ServiceID: "jobiddb",
+		Status:    swarm.TaskStatus{State: swarm.TaskStateFailed, ContainerStatus: &swarm.ContainerStatus{ExitCode: 3}},
+	}}, nil).Once()
+
+	tm.docker.EXPECT().ServiceRemove(mock.Anything, "jobiddb").Return(nil).Once()
+
+	err := tm.mngr.Restore(context.Background(), "db", OneOffOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1.0, testutil.ToFloat64(tm.mngr.metrics.jobs.WithLabelValues(JobTypeRestore, "3")))
+
+	state, err := tm.mngr.backups.get("db")
+	require.NoError(t, err)
+	require.Nil(t, state.LastRestore)
+}
+
+func TestServiceSpecFrom(t *testing.T) {
+	spec, err := serviceSpecFrom(&Template{
+		Image:    "restic/restic",
+		Command:  []string{"backup", "/data"},
+		Volumes:  []string{"/srv/db:/data:ro", "cache:/cache"},
+		Networks: []string{"backend", "backup"},
+		Restart:  "on-failure:3",
+	}, "maestro-backup", "backup-db", "node1")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"backup", "/data"}, spec.TaskTemplate.ContainerSpec.Args)
+	require.Equal(t, []mount.Mount{
+		{Type: mount.TypeBind, Source: "/srv/db", Target: "/data", ReadOnly: true},
+		{Type: mount.TypeVolume, Source: "cache", Target: "/cache"},
+	}, spec.TaskTemplate.ContainerSpec.Mounts)
+	require.Equal(t, []swarm.NetworkAttachmentConfig{{Target: "backend"}, {Target: "backup"}}, spec.TaskTemplate.Networks)
+	require.Equal(t, swarm.RestartPolicyConditionOnFailure, spec.TaskTemplate.RestartPolicy.Condition)
+
+	_, err = serviceSpecFrom(&Template{Build: BuildInfo{Context: "/build"}}, "maestro-backup", "backup-db", "node1")
+	require.ErrorContains(t, err, "build is not supported")
+
+	_, err = serviceSpecFrom(&Template{Image: "alpine", Privileged: true}, "maestro-backup", "backup-db", "node1")
+	require.ErrorContains(t, err, "privileged")
+
+	require.Equal(t, "docker-backup-maestro-restore-my-db", serviceName("docker-backup-maestro.restore_my.db"))
+	require.Len(t, serviceName(strings.Repeat("a", 100)), serviceNameMaxLen)
+}
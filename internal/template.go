@@ -1,23 +1,22 @@
 package internal
 
 import (
-	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"maps"
 	"os"
+	"reflect"
 	"slices"
 	"strconv"
 	"strings"
-
-	"crypto/md5"
+	"time"
 
 	"github.com/compose-spec/compose-go/v2/dotenv"
 	composegoutils "github.com/compose-spec/compose-go/v2/utils"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-units"
 	"github.com/mattn/go-shellwords"
 	"github.com/tiendc/go-deepcopy"
 	"gopkg.in/yaml.v2"
@@ -90,9 +89,23 @@ type DependentBuild struct {
 }
 
 type buildInfo struct {
-	Context         string
-	Dockerfile      string
-	Args            StringMapOrArray
+	Context    string
+	Dockerfile string
+	Args       StringMapOrArray
+	Target     string
+	Labels     StringMapOrArray
+	Network    string
+	NoCache    bool `yaml:"no_cache"`
+	Pull       bool
+	CacheFrom  []string `yaml:"cache_from"`
+	ExtraHosts []string `yaml:"extra_hosts"`
+	ShmSize    string   `yaml:"shm_size"`
+	Platforms  []string
+	// Secrets maps secret id to file inside maestro container, /run/secrets/<id> if empty
+	Secrets StringMapOrArray
+	// SSH lists agent sockets or keys forwarded to build: default or id=path[,path]
+	SSH []string `yaml:"ssh"`
+
 	DependentBuilds []DependentBuild
 }
 
@@ -111,6 +124,164 @@ func (val *BuildInfo) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
+func (val *BuildInfo) isEmpty() bool {
+	return reflect.ValueOf(*val).IsZero()
+}
+
+// merge overlays build options field by field: set values replace, maps are merged by key,
+// lists are merged without duplicates and dependent builds are replaced by tag
+func (val *BuildInfo) merge(other *BuildInfo) {
+	if len(other.Context) != 0 {
+		val.Context = other.Context
+	}
+
+	if len(other.Dockerfile) != 0 {
+		val.Dockerfile = other.Dockerfile
+	}
+
+	val.Args = mergeStringMaps(val.Args, other.Args)
+
+	if len(other.Target) != 0 {
+		val.Target = other.Target
+	}
+
+	val.Labels = mergeStringMaps(val.Labels, other.Labels)
+
+	if len(other.Network) != 0 {
+		val.Network = other.Network
+	}
+
+	if other.NoCache {
+		val.NoCache = true
+	}
+
+	if other.Pull {
+		val.Pull = true
+	}
+
+	val.CacheFrom = appendMissing(val.CacheFrom, other.CacheFrom)
+	val.ExtraHosts = appendMissing(val.ExtraHosts, other.ExtraHosts)
+
+	if len(other.ShmSize) != 0 {
+		val.ShmSize = other.ShmSize
+	}
+
+	// only one platform is supported, so it is replaced
+	if len(other.Platforms) != 0 {
+		val.Platforms = slices.Clone(other.Platforms)
+	}
+
+	val.Secrets = mergeStringMaps(val.Secrets, other.Secrets)
+	val.SSH = appendMissing(val.SSH, other.SSH)
+
+	for _, dep := range other.DependentBuilds {
+		dep.Args = maps.Clone(dep.Args)
+
+		idx := slices.IndexFunc(val.DependentBuilds, func(d DependentBuild) bool {
+			return d.Tag == dep.Tag
+		})
+		if idx >= 0 {
+			val.DependentBuilds[idx] = dep
+		} else {
+			val.DependentBuilds = append(val.DependentBuilds, dep)
+		}
+	}
+}
+
+func mergeStringMaps(base StringMapOrArray, other StringMapOrArray) StringMapOrArray {
+	if len(other) == 0 {
+		return base
+	}
+
+	if base == nil {
+		base = StringMapOrArray{}
+	}
+
+	maps.Copy(base, other)
+
+	return base
+}
+
+// appendMissing appends values not in list yet, keeping their order
+func appendMissing(list []string, values []string) []string {
+	for _, v := range values {
+		if !slices.Contains(list, v) {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+// ShmSizeBytes returns shm_size in bytes, 0 if not set
+func (val *BuildInfo) ShmSizeBytes() (int64, error) {
+	if len(val.ShmSize) == 0 {
+		return 0, nil
+	}
+
+	size, err := units.RAMInBytes(val.ShmSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse shm_size '%s' - %w", val.ShmSize, err)
+	}
+
+	return size, nil
+}
+
+// SecretFiles returns files of build secrets by secret id
+func (val *BuildInfo) SecretFiles() map[string]string {
+	files := map[string]string{}
+
+	for id, path := range val.Secrets {
+		if len(path) == 0 {
+			path = "/run/secrets/" + id
+		}
+
+		files[id] = path
+	}
+
+	return files
+}
+
+// SSHAgents returns paths of agent sockets or keys by ssh id. Empty paths mean SSH_AUTH_SOCK
+func (val *BuildInfo) SSHAgents() (map[string][]string, error) {
+	agents := map[string][]string{}
+
+	for _, ssh := range val.SSH {
+		id, paths, _ := strings.Cut(ssh, "=")
+		if len(id) == 0 {
+			return nil, fmt.Errorf("invalid ssh '%s', must be default or id=path", ssh)
+		}
+
+		if _, ok := agents[id]; ok {
+			return nil, fmt.Errorf("duplicated ssh id '%s'", id)
+		}
+
+		agents[id] = []string{}
+
+		if len(paths) > 0 {
+			agents[id] = strings.Split(paths, ",")
+		}
+	}
+
+	return agents, nil
+}
+
+func (val *BuildInfo) Validate() error {
+	_, err := val.ShmSizeBytes()
+	if err != nil {
+		return err
+	}
+
+	// engine api builds for single platform only
+	if len(val.Platforms) > 1 {
+		return fmt.Errorf("only one build platform is supported, got %s", strings.Join(val.Platforms, ", "))
+	}
+
+	_, err = val.SSHAgents()
+
+	return err
+}
+
 type Template struct {
 	Build        BuildInfo
 	Image        string
@@ -127,22 +298,13 @@ type Template struct {
 	Devices      []string
 	Privileged   bool
 
-	autoRemove bool
-}
+	// Timeout limits how long one-off (restore, force-backup) containers may run
+	Timeout string
 
-func (tmpl *Template) Hash() string {
-	hashMd5 := md5.New()
+	// PullPolicy is compose-compatible: always, missing, never, build or daily
+	PullPolicy string `yaml:"pull_policy"`
 
-	jsonStr, err := json.Marshal(tmpl)
-	if err != nil {
-		log.Fatalln(err)
-	}
-
-	hashMd5.Write(jsonStr)
-
-	hashHex := hex.EncodeToString(hashMd5.Sum(nil))
-
-	return hashHex
+	autoRemove bool
 }
 
 func (tmpl *Template) Overlay(other *Template) *Template {
@@ -153,20 +315,17 @@ func (tmpl *Template) Overlay(other *Template) *Template {
 		log.Fatal("deepcopy failed:", err)
 	}
 
-	if len(other.Build.Context) != 0 || len(other.Build.Dockerfile) != 0 {
-		newTmpl.Build = other.Build
-
-		if len(other.Image) == 0 {
-			newTmpl.Image = ""
-		}
+	// image without build replaces build, build without image replaces image
+	if len(other.Image) != 0 && other.Build.isEmpty() {
+		newTmpl.Build = BuildInfo{}
+	} else {
+		newTmpl.Build.merge(&other.Build)
 	}
 
 	if len(other.Image) != 0 {
 		newTmpl.Image = other.Image
-
-		if len(other.Build.Context) == 0 && len(other.Build.Dockerfile) == 0 {
-			newTmpl.Build = BuildInfo{}
-		}
+	} else if len(other.Build.Context) != 0 || len(other.Build.Dockerfile) != 0 {
+		newTmpl.Image = ""
 	}
 
 	if len(other.Entrypoint) != 0 {
@@ -232,9 +391,54 @@ func (tmpl *Template) Overlay(other *Template) *Template {
 		newTmpl.SecOpt = append(newTmpl.SecOpt, other.SecOpt...)
 	}
 
+	if len(other.Timeout) != 0 {
+		newTmpl.Timeout = other.Timeout
+	}
+
+	if len(other.PullPolicy) != 0 {
+		newTmpl.PullPolicy = other.PullPolicy
+	}
+
 	return &newTmpl
 }
 
+func (tmpl *Template) JobTimeout() (time.Duration, error) {
+	if len(tmpl.Timeout) == 0 {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(tmpl.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse timeout '%s' - %w", tmpl.Timeout, err)
+	}
+
+	if timeout < 0 {
+		return 0, fmt.Errorf("timeout must not be negative: %s", tmpl.Timeout)
+	}
+
+	return timeout, nil
+}
+
+const (
+	PullAlways  = "always"
+	PullMissing = "missing"
+	PullNever   = "never"
+	PullBuild   = "build"
+	PullDaily   = "daily"
+)
+
+// ImagePullPolicy returns pull policy of template, missing if not set
+func (tmpl *Template) ImagePullPolicy() (string, error) {
+	switch tmpl.PullPolicy {
+	case "", PullMissing, "if_not_present":
+		return PullMissing, nil
+	case PullAlways, PullNever, PullBuild, PullDaily:
+		return tmpl.PullPolicy, nil
+	}
+
+	return "", fmt.Errorf("unknown pull_policy '%s', must be one of %s, %s, %s, %s, %s", tmpl.PullPolicy, PullAlways, PullMissing, PullNever, PullBuild, PullDaily)
+}
+
 func (tmpl *Template) CreateConfig(tag string) (*BuildInfo, *container.Config, *container.HostConfig, *network.NetworkingConfig, error) {
 	var (
 		environment map[string]string
@@ -305,8 +509,8 @@ func (tmpl *Template) CreateConfig(tag string) (*BuildInfo, *container.Config, *
 			}
 
 			device := container.DeviceMapping{
-				PathOnHost:      elems[0],
-				PathInContainer: elems[1],
+				PathOnHost:        elems[0],
+				PathInContainer:   elems[1],
 				CgroupPermissions: "rwm",
 			}
 
@@ -372,6 +576,16 @@ func ReadTemplateFromFile(path string, required bool) (*Template, error) {
 	slices.Sort(tmpl.Networks)
 	slices.Sort(tmpl.Devices)
 
+	_, err = tmpl.ImagePullPolicy()
+	if err != nil {
+		return nil, fmt.Errorf("backuper template '%s' parsing failed: %w", path, err)
+	}
+
+	err = tmpl.Build.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("backuper template '%s' parsing failed: %w", path, err)
+	}
+
 	return tmpl, nil
 }
 
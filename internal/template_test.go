@@ -3,6 +3,7 @@ package internal
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
@@ -43,15 +44,16 @@ func TestTemplateCreate(t *testing.T) {
 		},
 		Resources: container.Resources{Devices: []container.DeviceMapping{
 			{
-				PathOnHost:      "/dev/sda",
-				PathInContainer: "/dev/sdb",
+				PathOnHost:        "/dev/sda",
+				PathInContainer:   "/dev/sdb",
+				CgroupPermissions: "rwm",
 			},
 		}},
 		Privileged: true,
 	})
 
 	require.Equal(t, *netCfg, network.NetworkingConfig{
-		EndpointsConfig: map[string]*network.EndpointSettings{"example_net": nil},
+		EndpointsConfig: map[string]*network.EndpointSettings{"example_net": {}},
 	})
 
 }
@@ -163,6 +165,62 @@ func TestTemplateOverlayBuild(t *testing.T) {
 	require.Equal(t, tmpl_res.Image, "")
 }
 
+func TestTemplateOverlayBuildPartial(t *testing.T) {
+	base := Template{
+		Image: "backup:local",
+		Build: BuildInfo{
+			Context:   "/ctx",
+			Args:      StringMapOrArray{"VERSION": "1", "MODE": "full"},
+			Target:    "backup",
+			CacheFrom: []string{"backup:cache"},
+			DependentBuilds: []DependentBuild{
+				{Tag: "base:local", Context: "/base"},
+			},
+		},
+	}
+
+	// options without context are merged into inherited build
+	res := base.Overlay(&Template{
+		Build: BuildInfo{
+			Args:      StringMapOrArray{"VERSION": "2"},
+			Target:    "restore",
+			Secrets:   StringMapOrArray{"token": ""},
+			SSH:       []string{"default"},
+			CacheFrom: []string{"backup:cache", "restore:cache"},
+			DependentBuilds: []DependentBuild{
+				{Tag: "base:local", Context: "/base2"},
+				{Tag: "tools:local", Context: "/tools"},
+			},
+		},
+	})
+
+	require.Equal(t, "backup:local", res.Image)
+	require.Equal(t, BuildInfo{
+		Context:   "/ctx",
+		Args:      StringMapOrArray{"VERSION": "2", "MODE": "full"},
+		Target:    "restore",
+		CacheFrom: []string{"backup:cache", "restore:cache"},
+		Secrets:   StringMapOrArray{"token": ""},
+		SSH:       []string{"default"},
+		DependentBuilds: []DependentBuild{
+			{Tag: "base:local", Context: "/base2"},
+			{Tag: "tools:local", Context: "/tools"},
+		},
+	}, res.Build)
+
+	// base template is not changed by overlay
+	require.Equal(t, StringMapOrArray{"VERSION": "1", "MODE": "full"}, base.Build.Args)
+	require.Len(t, base.Build.DependentBuilds, 1)
+
+	// other context keeps inherited options, image is left to build
+	res = base.Overlay(&Template{Build: BuildInfo{Context: "/other"}})
+
+	require.Empty(t, res.Image)
+	require.Equal(t, "/other", res.Build.Context)
+	require.Equal(t, "backup", res.Build.Target)
+	require.Equal(t, StringMapOrArray{"VERSION": "1", "MODE": "full"}, res.Build.Args)
+}
+
 func TestTemplateParse(t *testing.T) {
 	f, err := os.CreateTemp("", "test_tmpl")
 	require.NoError(t, err)
@@ -249,3 +307,119 @@ environment:
 	require.Equal(t, tmpl.EnvFile, StringOneOrArray([]string{".env2"}))
 	require.Equal(t, tmpl.Environment, StringMapOrArray(map[string]string{"ENV": "var2val", "ENV1": "VAL"}))
 }
+
+func TestTemplateJobTimeout(t *testing.T) {
+	tmpl := Template{Image: "alpine", Timeout: "1h"}
+
+	timeout, err := tmpl.JobTimeout()
+	require.NoError(t, err)
+	require.Equal(t, timeout, time.Hour)
+
+	tmpl_res := tmpl.Overlay(&Template{Timeout: "30m"})
+
+	timeout, err = tmpl_res.JobTimeout()
+	require.NoError(t, err)
+	require.Equal(t, timeout, 30*time.Minute)
+
+	hash, err := tmpl.Fingerprint("")
+	require.NoError(t, err)
+	hash_res, err := tmpl_res.Fingerprint("")
+	require.NoError(t, err)
+	require.Equal(t, hash, hash_res)
+
+	tmpl_res = tmpl.Overlay(&Template{Timeout: "soon"})
+
+	_, err = tmpl_res.JobTimeout()
+	require.Error(t, err)
+}
+
+func TestTemplatePullPolicy(t *testing.T) {
+	tmpl := Template{Image: "alpine"}
+
+	policy, err := tmpl.ImagePullPolicy()
+	require.NoError(t, err)
+	require.Equal(t, PullMissing, policy)
+
+	tmpl_res := tmpl.Overlay(&Template{PullPolicy: PullNever})
+
+	policy, err = tmpl_res.ImagePullPolicy()
+	require.NoError(t, err)
+	require.Equal(t, PullNever, policy)
+
+	_, err = tmpl.Overlay(&Template{PullPolicy: "sometimes"}).ImagePullPolicy()
+	require.Error(t, err)
+}
+
+func TestTemplateParseBuildOptions(t *testing.T) {
+	f, err := os.CreateTemp("", "test_tmpl")
+	require.NoError(t, err)
+
+	defer f.Close()
+	defer os.Remove(f.Name())
+
+	f.WriteString(`build:
+  context: /ctx
+  target: backup
+  labels:
+    - lbl=val
+  network: host
+  no_cache: true
+  pull: true
+  cache_from:
+    - registry.example.com/backup:cache
+  extra_hosts:
+    - "db:10.0.0.2"
+  shm_size: 128mb
+  platforms:
+    - linux/arm64
+  secrets:
+    npm_token: /run/secrets/npm
+  ssh:
+    - default
+    - repo=/keys/id_rsa
+`)
+
+	tmpl, err := ReadTemplateFromFile(f.Name(), true)
+	require.NoError(t, err)
+
+	require.Equal(t, BuildInfo{
+		Context:    "/ctx",
+		Target:     "backup",
+		Labels:     StringMapOrArray{"lbl": "val"},
+		Network:    "host",
+		NoCache:    true,
+		Pull:       true,
+		CacheFrom:  []string{"registry.example.com/backup:cache"},
+		ExtraHosts: []string{"db:10.0.0.2"},
+		ShmSize:    "128mb",
+		Platforms:  []string{"linux/arm64"},
+		Secrets:    StringMapOrArray{"npm_token": "/run/secrets/npm"},
+		SSH:        []string{"default", "repo=/keys/id_rsa"},
+	}, tmpl.Build)
+
+	size, err := tmpl.Build.ShmSizeBytes()
+	require.NoError(t, err)
+	require.Equal(t, int64(128*1024*1024), size)
+
+	agents, err := tmpl.Build.SSHAgents()
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{"default": {}, "repo": {"/keys/id_rsa"}}, agents)
+
+	// build options are a part of build, so they are inherited with it
+	res := (&Template{Image: "alpine"}).Overlay(tmpl)
+	require.Equal(t, tmpl.Build, res.Build)
+
+	for _, invalid := range []string{
+		"build:\n  context: .\n  shm_size: lots\n",
+		"build:\n  context: .\n  platforms: [linux/amd64, linux/arm64]\n",
+		"build:\n  context: .\n  ssh: [default, default]\n",
+		"build:\n  context: .\n  ssh: ['=/key']\n",
+	} {
+		f.Truncate(0)
+		f.Seek(0, 0)
+		f.WriteString(invalid)
+
+		_, err = ReadTemplateFromFile(f.Name(), true)
+		require.Error(t, err, invalid)
+	}
+}
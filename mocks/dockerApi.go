@@ -1,4 +1,4 @@
-// Code generated by mockery v2.50.2. DO NOT EDIT.
+// Code generated by mockery v2.53.7. DO NOT EDIT.
 
 package mocks
 
@@ -15,8 +15,12 @@ import (
 
 	mock "github.com/stretchr/testify/mock"
 
+	net "net"
+
 	network "github.com/docker/docker/api/types/network"
 
+	swarm "github.com/docker/docker/api/types/swarm"
+
 	types "github.com/docker/docker/api/types"
 
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -96,6 +100,63 @@ func (_c *DockerApi_ContainerCreate_Call) RunAndReturn(run func(context.Context,
 	return _c
 }
 
+// ContainerInspect provides a mock function with given fields: ctx, containerID
+func (_m *DockerApi) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	ret := _m.Called(ctx, containerID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ContainerInspect")
+	}
+
+	var r0 types.ContainerJSON
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (types.ContainerJSON, error)); ok {
+		return rf(ctx, containerID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) types.ContainerJSON); ok {
+		r0 = rf(ctx, containerID)
+	} else {
+		r0 = ret.Get(0).(types.ContainerJSON)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, containerID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DockerApi_ContainerInspect_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ContainerInspect'
+type DockerApi_ContainerInspect_Call struct {
+	*mock.Call
+}
+
+// ContainerInspect is a helper method to define mock.On call
+//   - ctx context.Context
+//   - containerID string
+func (_e *DockerApi_Expecter) ContainerInspect(ctx interface{}, containerID interface{}) *DockerApi_ContainerInspect_Call {
+	return &DockerApi_ContainerInspect_Call{Call: _e.mock.On("ContainerInspect", ctx, containerID)}
+}
+
+func (_c *DockerApi_ContainerInspect_Call) Run(run func(ctx context.Context, containerID string)) *DockerApi_ContainerInspect_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *DockerApi_ContainerInspect_Call) Return(_a0 types.ContainerJSON, _a1 error) *DockerApi_ContainerInspect_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *DockerApi_ContainerInspect_Call) RunAndReturn(run func(context.Context, string) (types.ContainerJSON, error)) *DockerApi_ContainerInspect_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // ContainerList provides a mock function with given fields: ctx, options
 func (_m *DockerApi) ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error) {
 	ret := _m.Called(ctx, options)
@@ -155,6 +216,66 @@ func (_c *DockerApi_ContainerList_Call) RunAndReturn(run func(context.Context, c
 	return _c
 }
 
+// ContainerLogs provides a mock function with given fields: ctx, containerID, options
+func (_m *DockerApi) ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error) {
+	ret := _m.Called(ctx, containerID, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ContainerLogs")
+	}
+
+	var r0 io.ReadCloser
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, container.LogsOptions) (io.ReadCloser, error)); ok {
+		return rf(ctx, containerID, options)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, container.LogsOptions) io.ReadCloser); ok {
+		r0 = rf(ctx, containerID, options)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(io.ReadCloser)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, container.LogsOptions) error); ok {
+		r1 = rf(ctx, containerID, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DockerApi_ContainerLogs_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ContainerLogs'
+type DockerApi_ContainerLogs_Call struct {
+	*mock.Call
+}
+
+// ContainerLogs is a helper method to define mock.On call
+//   - ctx context.Context
+//   - containerID string
+//   - options container.LogsOptions
+func (_e *DockerApi_Expecter) ContainerLogs(ctx interface{}, containerID interface{}, options interface{}) *DockerApi_ContainerLogs_Call {
+	return &DockerApi_ContainerLogs_Call{Call: _e.mock.On("ContainerLogs", ctx, containerID, options)}
+}
+
+func (_c *DockerApi_ContainerLogs_Call) Run(run func(ctx context.Context, containerID string, options container.LogsOptions)) *DockerApi_ContainerLogs_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(container.LogsOptions))
+	})
+	return _c
+}
+
+func (_c *DockerApi_ContainerLogs_Call) Return(_a0 io.ReadCloser, _a1 error) *DockerApi_ContainerLogs_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *DockerApi_ContainerLogs_Call) RunAndReturn(run func(context.Context, string, container.LogsOptions) (io.ReadCloser, error)) *DockerApi_ContainerLogs_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // ContainerRemove provides a mock function with given fields: ctx, containerID, options
 func (_m *DockerApi) ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error {
 	ret := _m.Called(ctx, containerID, options)
@@ -299,6 +420,67 @@ func (_c *DockerApi_ContainerStop_Call) RunAndReturn(run func(context.Context, s
 	return _c
 }
 
+// DialHijack provides a mock function with given fields: ctx, url, proto, meta
+func (_m *DockerApi) DialHijack(ctx context.Context, url string, proto string, meta map[string][]string) (net.Conn, error) {
+	ret := _m.Called(ctx, url, proto, meta)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DialHijack")
+	}
+
+	var r0 net.Conn
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, map[string][]string) (net.Conn, error)); ok {
+		return rf(ctx, url, proto, meta)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, map[string][]string) net.Conn); ok {
+		r0 = rf(ctx, url, proto, meta)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(net.Conn)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, map[string][]string) error); ok {
+		r1 = rf(ctx, url, proto, meta)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DockerApi_DialHijack_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DialHijack'
+type DockerApi_DialHijack_Call struct {
+	*mock.Call
+}
+
+// DialHijack is a helper method to define mock.On call
+//   - ctx context.Context
+//   - url string
+//   - proto string
+//   - meta map[string][]string
+func (_e *DockerApi_Expecter) DialHijack(ctx interface{}, url interface{}, proto interface{}, meta interface{}) *DockerApi_DialHijack_Call {
+	return &DockerApi_DialHijack_Call{Call: _e.mock.On("DialHijack", ctx, url, proto, meta)}
+}
+
+func (_c *DockerApi_DialHijack_Call) Run(run func(ctx context.Context, url string, proto string, meta map[string][]string)) *DockerApi_DialHijack_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(string), args[3].(map[string][]string))
+	})
+	return _c
+}
+
+func (_c *DockerApi_DialHijack_Call) Return(_a0 net.Conn, _a1 error) *DockerApi_DialHijack_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *DockerApi_DialHijack_Call) RunAndReturn(run func(context.Context, string, string, map[string][]string) (net.Conn, error)) *DockerApi_DialHijack_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Events provides a mock function with given fields: ctx, options
 func (_m *DockerApi) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
 	ret := _m.Called(ctx, options)
@@ -418,6 +600,72 @@ func (_c *DockerApi_ImageBuild_Call) RunAndReturn(run func(context.Context, io.R
 	return _c
 }
 
+// ImageInspectWithRaw provides a mock function with given fields: ctx, imageID
+func (_m *DockerApi) ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+	ret := _m.Called(ctx, imageID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ImageInspectWithRaw")
+	}
+
+	var r0 types.ImageInspect
+	var r1 []byte
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (types.ImageInspect, []byte, error)); ok {
+		return rf(ctx, imageID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) types.ImageInspect); ok {
+		r0 = rf(ctx, imageID)
+	} else {
+		r0 = ret.Get(0).(types.ImageInspect)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) []byte); ok {
+		r1 = rf(ctx, imageID)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).([]byte)
+		}
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string) error); ok {
+		r2 = rf(ctx, imageID)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// DockerApi_ImageInspectWithRaw_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ImageInspectWithRaw'
+type DockerApi_ImageInspectWithRaw_Call struct {
+	*mock.Call
+}
+
+// ImageInspectWithRaw is a helper method to define mock.On call
+//   - ctx context.Context
+//   - imageID string
+func (_e *DockerApi_Expecter) ImageInspectWithRaw(ctx interface{}, imageID interface{}) *DockerApi_ImageInspectWithRaw_Call {
+	return &DockerApi_ImageInspectWithRaw_Call{Call: _e.mock.On("ImageInspectWithRaw", ctx, imageID)}
+}
+
+func (_c *DockerApi_ImageInspectWithRaw_Call) Run(run func(ctx context.Context, imageID string)) *DockerApi_ImageInspectWithRaw_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *DockerApi_ImageInspectWithRaw_Call) Return(_a0 types.ImageInspect, _a1 []byte, _a2 error) *DockerApi_ImageInspectWithRaw_Call {
+	_c.Call.Return(_a0, _a1, _a2)
+	return _c
+}
+
+func (_c *DockerApi_ImageInspectWithRaw_Call) RunAndReturn(run func(context.Context, string) (types.ImageInspect, []byte, error)) *DockerApi_ImageInspectWithRaw_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // ImageList provides a mock function with given fields: ctx, options
 func (_m *DockerApi) ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error) {
 	ret := _m.Called(ctx, options)
@@ -537,6 +785,405 @@ func (_c *DockerApi_ImagePull_Call) RunAndReturn(run func(context.Context, strin
 	return _c
 }
 
+// ServerVersion provides a mock function with given fields: ctx
+func (_m *DockerApi) ServerVersion(ctx context.Context) (types.Version, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ServerVersion")
+	}
+
+	var r0 types.Version
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (types.Version, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) types.Version); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(types.Version)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DockerApi_ServerVersion_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ServerVersion'
+type DockerApi_ServerVersion_Call struct {
+	*mock.Call
+}
+
+// ServerVersion is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *DockerApi_Expecter) ServerVersion(ctx interface{}) *DockerApi_ServerVersion_Call {
+	return &DockerApi_ServerVersion_Call{Call: _e.mock.On("ServerVersion", ctx)}
+}
+
+func (_c *DockerApi_ServerVersion_Call) Run(run func(ctx context.Context)) *DockerApi_ServerVersion_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context))
+	})
+	return _c
+}
+
+func (_c *DockerApi_ServerVersion_Call) Return(_a0 types.Version, _a1 error) *DockerApi_ServerVersion_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *DockerApi_ServerVersion_Call) RunAndReturn(run func(context.Context) (types.Version, error)) *DockerApi_ServerVersion_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ServiceCreate provides a mock function with given fields: ctx, service, options
+func (_m *DockerApi) ServiceCreate(ctx context.Context, service swarm.ServiceSpec, options types.ServiceCreateOptions) (swarm.ServiceCreateResponse, error) {
+	ret := _m.Called(ctx, service, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ServiceCreate")
+	}
+
+	var r0 swarm.ServiceCreateResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, swarm.ServiceSpec, types.ServiceCreateOptions) (swarm.ServiceCreateResponse, error)); ok {
+		return rf(ctx, service, options)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, swarm.ServiceSpec, types.ServiceCreateOptions) swarm.ServiceCreateResponse); ok {
+		r0 = rf(ctx, service, options)
+	} else {
+		r0 = ret.Get(0).(swarm.ServiceCreateResponse)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, swarm.ServiceSpec, types.ServiceCreateOptions) error); ok {
+		r1 = rf(ctx, service, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DockerApi_ServiceCreate_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ServiceCreate'
+type DockerApi_ServiceCreate_Call struct {
+	*mock.Call
+}
+
+// ServiceCreate is a helper method to define mock.On call
+//   - ctx context.Context
+//   - service swarm.ServiceSpec
+//   - options types.ServiceCreateOptions
+func (_e *DockerApi_Expecter) ServiceCreate(ctx interface{}, service interface{}, options interface{}) *DockerApi_ServiceCreate_Call {
+	return &DockerApi_ServiceCreate_Call{Call: _e.mock.On("ServiceCreate", ctx, service, options)}
+}
+
+func (_c *DockerApi_ServiceCreate_Call) Run(run func(ctx context.Context, service swarm.ServiceSpec, options types.ServiceCreateOptions)) *DockerApi_ServiceCreate_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(swarm.ServiceSpec), args[2].(types.ServiceCreateOptions))
+	})
+	return _c
+}
+
+func (_c *DockerApi_ServiceCreate_Call) Return(_a0 swarm.ServiceCreateResponse, _a1 error) *DockerApi_ServiceCreate_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *DockerApi_ServiceCreate_Call) RunAndReturn(run func(context.Context, swarm.ServiceSpec, types.ServiceCreateOptions) (swarm.ServiceCreateResponse, error)) *DockerApi_ServiceCreate_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ServiceList provides a mock function with given fields: ctx, options
+func (_m *DockerApi) ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error) {
+	ret := _m.Called(ctx, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ServiceList")
+	}
+
+	var r0 []swarm.Service
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, types.ServiceListOptions) ([]swarm.Service, error)); ok {
+		return rf(ctx, options)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, types.ServiceListOptions) []swarm.Service); ok {
+		r0 = rf(ctx, options)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]swarm.Service)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, types.ServiceListOptions) error); ok {
+		r1 = rf(ctx, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DockerApi_ServiceList_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ServiceList'
+type DockerApi_ServiceList_Call struct {
+	*mock.Call
+}
+
+// ServiceList is a helper method to define mock.On call
+//   - ctx context.Context
+//   - options types.ServiceListOptions
+func (_e *DockerApi_Expecter) ServiceList(ctx interface{}, options interface{}) *DockerApi_ServiceList_Call {
+	return &DockerApi_ServiceList_Call{Call: _e.mock.On("ServiceList", ctx, options)}
+}
+
+func (_c *DockerApi_ServiceList_Call) Run(run func(ctx context.Context, options types.ServiceListOptions)) *DockerApi_ServiceList_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(types.ServiceListOptions))
+	})
+	return _c
+}
+
+func (_c *DockerApi_ServiceList_Call) Return(_a0 []swarm.Service, _a1 error) *DockerApi_ServiceList_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *DockerApi_ServiceList_Call) RunAndReturn(run func(context.Context, types.ServiceListOptions) ([]swarm.Service, error)) *DockerApi_ServiceList_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ServiceLogs provides a mock function with given fields: ctx, serviceID, options
+func (_m *DockerApi) ServiceLogs(ctx context.Context, serviceID string, options container.LogsOptions) (io.ReadCloser, error) {
+	ret := _m.Called(ctx, serviceID, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ServiceLogs")
+	}
+
+	var r0 io.ReadCloser
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, container.LogsOptions) (io.ReadCloser, error)); ok {
+		return rf(ctx, serviceID, options)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, container.LogsOptions) io.ReadCloser); ok {
+		r0 = rf(ctx, serviceID, options)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(io.ReadCloser)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, container.LogsOptions) error); ok {
+		r1 = rf(ctx, serviceID, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DockerApi_ServiceLogs_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ServiceLogs'
+type DockerApi_ServiceLogs_Call struct {
+	*mock.Call
+}
+
+// ServiceLogs is a helper method to define mock.On call
+//   - ctx context.Context
+//   - serviceID string
+//   - options container.LogsOptions
+func (_e *DockerApi_Expecter) ServiceLogs(ctx interface{}, serviceID interface{}, options interface{}) *DockerApi_ServiceLogs_Call {
+	return &DockerApi_ServiceLogs_Call{Call: _e.mock.On("ServiceLogs", ctx, serviceID, options)}
+}
+
+func (_c *DockerApi_ServiceLogs_Call) Run(run func(ctx context.Context, serviceID string, options container.LogsOptions)) *DockerApi_ServiceLogs_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(container.LogsOptions))
+	})
+	return _c
+}
+
+func (_c *DockerApi_ServiceLogs_Call) Return(_a0 io.ReadCloser, _a1 error) *DockerApi_ServiceLogs_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *DockerApi_ServiceLogs_Call) RunAndReturn(run func(context.Context, string, container.LogsOptions) (io.ReadCloser, error)) *DockerApi_ServiceLogs_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ServiceRemove provides a mock function with given fields: ctx, serviceID
+func (_m *DockerApi) ServiceRemove(ctx context.Context, serviceID string) error {
+	ret := _m.Called(ctx, serviceID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ServiceRemove")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, serviceID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DockerApi_ServiceRemove_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ServiceRemove'
+type DockerApi_ServiceRemove_Call struct {
+	*mock.Call
+}
+
+// ServiceRemove is a helper method to define mock.On call
+//   - ctx context.Context
+//   - serviceID string
+func (_e *DockerApi_Expecter) ServiceRemove(ctx interface{}, serviceID interface{}) *DockerApi_ServiceRemove_Call {
+	return &DockerApi_ServiceRemove_Call{Call: _e.mock.On("ServiceRemove", ctx, serviceID)}
+}
+
+func (_c *DockerApi_ServiceRemove_Call) Run(run func(ctx context.Context, serviceID string)) *DockerApi_ServiceRemove_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *DockerApi_ServiceRemove_Call) Return(_a0 error) *DockerApi_ServiceRemove_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *DockerApi_ServiceRemove_Call) RunAndReturn(run func(context.Context, string) error) *DockerApi_ServiceRemove_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ServiceUpdate provides a mock function with given fields: ctx, serviceID, version, service, options
+func (_m *DockerApi) ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, service swarm.ServiceSpec, options types.ServiceUpdateOptions) (swarm.ServiceUpdateResponse, error) {
+	ret := _m.Called(ctx, serviceID, version, service, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ServiceUpdate")
+	}
+
+	var r0 swarm.ServiceUpdateResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, swarm.Version, swarm.ServiceSpec, types.ServiceUpdateOptions) (swarm.ServiceUpdateResponse, error)); ok {
+		return rf(ctx, serviceID, version, service, options)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, swarm.Version, swarm.ServiceSpec, types.ServiceUpdateOptions) swarm.ServiceUpdateResponse); ok {
+		r0 = rf(ctx, serviceID, version, service, options)
+	} else {
+		r0 = ret.Get(0).(swarm.ServiceUpdateResponse)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, swarm.Version, swarm.ServiceSpec, types.ServiceUpdateOptions) error); ok {
+		r1 = rf(ctx, serviceID, version, service, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DockerApi_ServiceUpdate_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ServiceUpdate'
+type DockerApi_ServiceUpdate_Call struct {
+	*mock.Call
+}
+
+// ServiceUpdate is a helper method to define mock.On call
+//   - ctx context.Context
+//   - serviceID string
+//   - version swarm.Version
+//   - service swarm.ServiceSpec
+//   - options types.ServiceUpdateOptions
+func (_e *DockerApi_Expecter) ServiceUpdate(ctx interface{}, serviceID interface{}, version interface{}, service interface{}, options interface{}) *DockerApi_ServiceUpdate_Call {
+	return &DockerApi_ServiceUpdate_Call{Call: _e.mock.On("ServiceUpdate", ctx, serviceID, version, service, options)}
+}
+
+func (_c *DockerApi_ServiceUpdate_Call) Run(run func(ctx context.Context, serviceID string, version swarm.Version, service swarm.ServiceSpec, options types.ServiceUpdateOptions)) *DockerApi_ServiceUpdate_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(swarm.Version), args[3].(swarm.ServiceSpec), args[4].(types.ServiceUpdateOptions))
+	})
+	return _c
+}
+
+func (_c *DockerApi_ServiceUpdate_Call) Return(_a0 swarm.ServiceUpdateResponse, _a1 error) *DockerApi_ServiceUpdate_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *DockerApi_ServiceUpdate_Call) RunAndReturn(run func(context.Context, string, swarm.Version, swarm.ServiceSpec, types.ServiceUpdateOptions) (swarm.ServiceUpdateResponse, error)) *DockerApi_ServiceUpdate_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// TaskList provides a mock function with given fields: ctx, options
+func (_m *DockerApi) TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error) {
+	ret := _m.Called(ctx, options)
+
+	if len(ret) == 0 {
+		panic("no return value specified for TaskList")
+	}
+
+	var r0 []swarm.Task
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, types.TaskListOptions) ([]swarm.Task, error)); ok {
+		return rf(ctx, options)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, types.TaskListOptions) []swarm.Task); ok {
+		r0 = rf(ctx, options)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]swarm.Task)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, types.TaskListOptions) error); ok {
+		r1 = rf(ctx, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DockerApi_TaskList_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'TaskList'
+type DockerApi_TaskList_Call struct {
+	*mock.Call
+}
+
+// TaskList is a helper method to define mock.On call
+//   - ctx context.Context
+//   - options types.TaskListOptions
+func (_e *DockerApi_Expecter) TaskList(ctx interface{}, options interface{}) *DockerApi_TaskList_Call {
+	return &DockerApi_TaskList_Call{Call: _e.mock.On("TaskList", ctx, options)}
+}
+
+func (_c *DockerApi_TaskList_Call) Run(run func(ctx context.Context, options types.TaskListOptions)) *DockerApi_TaskList_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(types.TaskListOptions))
+	})
+	return _c
+}
+
+func (_c *DockerApi_TaskList_Call) Return(_a0 []swarm.Task, _a1 error) *DockerApi_TaskList_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *DockerApi_TaskList_Call) RunAndReturn(run func(context.Context, types.TaskListOptions) ([]swarm.Task, error)) *DockerApi_TaskList_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewDockerApi creates a new instance of DockerApi. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewDockerApi(t interface {